@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 审计日志记录的操作
+const (
+	AuditRegister         = "register"
+	AuditSubmissionNew    = "submission.new"
+	AuditSubmissionDelete = "submission.delete"
+	AuditSubmissionAmend  = "submission.amend"
+	// AuditSubmissionRestore 修改提交失败后重新发布了原提交
+	AuditSubmissionRestore = "submission.restore"
+	AuditServerImport      = "server.import"
+	AuditServerTrust       = "server.trust"
+	// AuditServerUpdate 修改服务器的信任等级, 名称, 启用状态或信任声明地址
+	AuditServerUpdate   = "server.update"
+	AuditServerRemove   = "server.remove"
+	AuditOverrideAdd    = "override.add"
+	AuditOverrideRemove = "override.remove"
+	// AuditBackupRestore 从备份恢复, 记录在恢复后的数据库中
+	AuditBackupRestore = "backup.restore"
+	AuditConfigSet     = "config.set"
+	AuditConfigUnset   = "config.unset"
+)
+
+// AuditEntry 审计日志中的一条记录
+type AuditEntry struct {
+	ID       int64  `json:"id"`
+	Time     int64  `json:"time"`
+	Operator string `json:"operator"`
+	Action   string `json:"action"`
+	// Target 操作的对象, 如提交uuid, 服务器uuid或玩家uuid
+	Target string `json:"target"`
+	// Detail 操作的详细内容, 为JSON对象
+	Detail json.RawMessage `json:"detail,omitempty"`
+}
+
+// AuditFilter 查询审计日志的条件, 零值表示不限制
+type AuditFilter struct {
+	operator string
+	// action 操作名称, 也可以只指定前缀, 如 server 匹配所有 server.* 操作
+	action string
+	target string
+	since  int64
+	until  int64
+	// limit 最多返回的条数(最新的), 为0时不限制
+	limit int
+}
+
+// where 生成对应的SQL条件和参数
+func (f AuditFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if f.operator != "" {
+		conditions = append(conditions, "operator = ?")
+		args = append(args, f.operator)
+	}
+	if f.action != "" {
+		conditions = append(conditions, "(action = ? OR action LIKE ? || '.%')")
+		args = append(args, f.action, f.action)
+	}
+	if f.target != "" {
+		conditions = append(conditions, "target = ?")
+		args = append(args, f.target)
+	}
+	if f.since != 0 {
+		conditions = append(conditions, "time >= ?")
+		args = append(args, f.since)
+	}
+	if f.until != 0 {
+		conditions = append(conditions, "time <= ?")
+		args = append(args, f.until)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// audit 以当前操作者的身份记录一次本地操作, detail 会被序列化为JSON
+//
+// 操作本身已经完成, 因此记录失败时只输出错误而不中断.
+func audit(action, target string, detail interface{}) {
+	entry := AuditEntry{
+		Time:     time.Now().Unix(),
+		Operator: currentOperator(),
+		Action:   action,
+		Target:   target,
+	}
+	if detail != nil {
+		data, err := json.Marshal(detail)
+		if err != nil {
+			logger.Error("无法记录审计日志", F("action", action), F("error", err))
+			return
+		}
+		entry.Detail = data
+	}
+	err := insertAudit(entry)
+	if err != nil {
+		logger.Error("无法记录审计日志", F("action", action), F("error", err))
+	}
+}
+
+// listAudit 按时间顺序列出审计日志, asJSON 为真时输出JSON数组
+func listAudit(filter AuditFilter, asJSON bool) error {
+	list, err := auditList(filter)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if list == nil {
+			list = []AuditEntry{}
+		}
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return errors.New(T("序列化错误: ") + err.Error())
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Println(T("时间\t\t\t|操作者\t\t|操作\t\t\t|对象\t\t\t\t\t|详细内容"))
+	for _, i := range list {
+		fmt.Println(fmt.Sprintf("%s\t|%s\t\t|%-16s\t|%-36s\t|%s", time.Unix(i.Time, 0).Format("2006-01-02 15:04:05"), i.Operator, i.Action, i.Target, string(i.Detail)))
+	}
+	logger.Info("已到达最底端")
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAuditList(t *testing.T) {
+	newTestDB(t)
+	const (
+		server = "00000000-0000-4000-8000-000000000002"
+		player = "252af321-89aa-426c-a534-399f551810ae"
+	)
+	day := time.Date(2021, 8, 1, 0, 0, 0, 0, time.Local)
+	entries := []AuditEntry{
+		{Time: day.Add(-time.Hour).Unix(), Operator: "alice", Action: AuditServerTrust, Target: server},
+		{Time: day.Add(9 * time.Hour).Unix(), Operator: "bob", Action: AuditSubmissionNew, Target: player},
+		{Time: day.Add(23*time.Hour + 30*time.Minute).Unix(), Operator: "alice", Action: AuditServerUpdate, Target: server},
+		{Time: day.AddDate(0, 0, 1).Unix(), Operator: "alice", Action: AuditOverrideAdd, Target: player},
+	}
+	for _, entry := range entries {
+		err := insertAudit(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// until 只有日期时包含当天的全部操作
+	until, err := parseUntil("2021-08-01", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []int
+	}{
+		{name: "all", want: []int{0, 1, 2, 3}},
+		{name: "operator", filter: AuditFilter{operator: "alice"}, want: []int{0, 2, 3}},
+		{name: "action", filter: AuditFilter{action: AuditSubmissionNew}, want: []int{1}},
+		{name: "action prefix", filter: AuditFilter{action: "server"}, want: []int{0, 2}},
+		{name: "not a prefix", filter: AuditFilter{action: "serv"}},
+		{name: "target", filter: AuditFilter{target: player}, want: []int{1, 3}},
+		{name: "since", filter: AuditFilter{since: day.Unix()}, want: []int{1, 2, 3}},
+		{name: "until end of day", filter: AuditFilter{since: day.Unix(), until: until}, want: []int{1, 2}},
+		{name: "limit keeps the latest", filter: AuditFilter{operator: "alice", limit: 2}, want: []int{2, 3}},
+	}
+	for _, tt := range tests {
+		list, err := auditList(tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(list) != len(tt.want) {
+			t.Errorf("%s: auditList() = %+v, want entries %v", tt.name, list, tt.want)
+			continue
+		}
+		for i, j := range tt.want {
+			if list[i].Time != entries[j].Time || list[i].Action != entries[j].Action || list[i].Target != entries[j].Target {
+				t.Errorf("%s: entry %d = %+v, want %+v", tt.name, i, list[i], entries[j])
+			}
+		}
+	}
+	if _, err := auditList(AuditFilter{limit: -1}); err == nil {
+		t.Error("auditList() with a negative limit succeeded")
+	}
+}
+
+func TestAudit(t *testing.T) {
+	newTestDB(t)
+	setOperator(t, "alice")
+	start := time.Now().Unix()
+	audit(AuditConfigSet, "report.threshold", map[string]string{"value": "-1"})
+	audit(AuditConfigUnset, "report.threshold", nil)
+
+	list, err := auditList(AuditFilter{action: "config"})
+	if err != nil || len(list) != 2 {
+		t.Fatalf("auditList() = %+v, %v", list, err)
+	}
+	var detail map[string]string
+	err = json.Unmarshal(list[0].Detail, &detail)
+	if err != nil || detail["value"] != "-1" || list[0].Operator != "alice" || list[0].Time < start || list[0].Target != "report.threshold" {
+		t.Errorf("audit entry = %+v, %v", list[0], err)
+	}
+	// 没有详细内容时JSON中省略 detail
+	data, err := json.Marshal(list[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	if _, ok := fields["detail"]; err != nil || ok || list[1].Action != AuditConfigUnset {
+		t.Errorf("JSON of an entry without detail = %s", data)
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/term"
+)
+
+// backupVersion 备份格式的版本
+const backupVersion = 1
+
+// 备份中的文件
+const (
+	backupManifest  = "manifest.json"
+	backupSignature = "manifest.json.sig"
+	backupDB        = "OpenMPRDB.db"
+	backupPrivKey   = "rsa-priv.pem"
+	backupPubKey    = "rsa-pub.pem"
+	// backupConfig 配置文件, 只在存在时备份
+	backupConfig = "config.yaml"
+)
+
+// BackupManifest 备份的清单, 由本服务器的私钥签名
+type BackupManifest struct {
+	Version  int    `json:"version"`
+	Created  int64  `json:"created"`
+	Operator string `json:"operator"`
+	// Fingerprint 备份中密钥的指纹
+	Fingerprint string `json:"fingerprint"`
+	// Files 备份中各文件的SHA-256
+	Files map[string]string `json:"files"`
+}
+
+// BackupFile 备份中的一个文件, path 为恢复时写入的位置
+type BackupFile struct {
+	name string
+	path string
+	data []byte
+	perm os.FileMode
+}
+
+// readPassphrase 读取备份密码, 依次使用密码文件, 环境变量 OPENMPRDB_BACKUP_PASSPHRASE 和终端输入
+//
+// twice 为真时在终端上要求输入两次.
+func readPassphrase(file string, twice bool) ([]byte, error) {
+	var passphrase string
+	switch {
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.New(T("读取密码文件错误: ") + err.Error())
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	case os.Getenv("OPENMPRDB_BACKUP_PASSPHRASE") != "":
+		passphrase = os.Getenv("OPENMPRDB_BACKUP_PASSPHRASE")
+	case term.IsTerminal(int(os.Stdin.Fd())):
+		read := func(prompt string) (string, error) {
+			fmt.Fprint(os.Stderr, prompt)
+			data, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			return string(data), err
+		}
+		var err error
+		passphrase, err = read(T("请输入备份密码: "))
+		if err != nil {
+			return nil, errors.New(T("读取密码错误: ") + err.Error())
+		}
+		if twice {
+			again, err := read(T("请再次输入备份密码: "))
+			if err != nil {
+				return nil, errors.New(T("读取密码错误: ") + err.Error())
+			}
+			if again != passphrase {
+				return nil, errors.New(T("两次输入的密码不一致"))
+			}
+		}
+	default:
+		return nil, errors.New(T("请通过 passphrase-file 或环境变量 OPENMPRDB_BACKUP_PASSPHRASE 指定备份密码"))
+	}
+	if passphrase == "" {
+		return nil, errors.New(T("备份密码不能为空"))
+	}
+	return []byte(passphrase), nil
+}
+
+// snapshotDB 使用SQLite的在线备份将当前数据库复制到path, 复制期间数据库仍可正常使用
+func snapshotDB(path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer srcConn.Close()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer destConn.Close()
+
+	err = destConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			backup, err := d.(*sqlite3.SQLiteConn).Backup("main", s.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			_, err = backup.Step(-1)
+			if err != nil {
+				backup.Close()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return errors.New(T("数据库备份错误: ") + err.Error())
+	}
+	return nil
+}
+
+// backupFiles 收集需要备份的文件: 数据库快照, 本地密钥和配置文件
+func backupFiles() ([]BackupFile, error) {
+	dir, err := os.MkdirTemp("", "openmprdb-backup")
+	if err != nil {
+		return nil, errors.New(T("数据库备份错误: ") + err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	snapshot := filepath.Join(dir, backupDB)
+	err = snapshotDB(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		return nil, errors.New(T("数据库备份错误: ") + err.Error())
+	}
+
+	// 签名使用的是数据库中的密钥, 以其为准
+	var privkey, pubkey string
+	err = db.QueryRow("SELECT private_key, public_key FROM Config").Scan(&privkey, &pubkey)
+	if err != nil {
+		return nil, errors.New(T("无法读取本地私钥: ") + err.Error())
+	}
+	files := []BackupFile{
+		{name: backupDB, path: SqlPath, data: data, perm: 0600},
+		{name: backupPrivKey, path: "rsa-priv.pem", data: []byte(privkey), perm: 0600},
+		{name: backupPubKey, path: "rsa-pub.pem", data: []byte(pubkey), perm: 0644},
+	}
+	if Exists(ConfigPath) {
+		config, err := os.ReadFile(ConfigPath)
+		if err != nil {
+			return nil, errors.New(T("读取配置文件错误: ") + err.Error())
+		}
+		files = append(files, BackupFile{name: backupConfig, path: ConfigPath, data: config, perm: 0644})
+	}
+	return files, nil
+}
+
+// createBackup 生成加密并签名的备份, 写入path
+//
+// 备份为一个tar包, 包含清单, 清单的签名和各文件, 整体使用密码加密.
+func createBackup(path string, passphrase []byte, force bool) (BackupManifest, error) {
+	var manifest BackupManifest
+	if !force && Exists(path) {
+		return manifest, errors.New(T("文件已存在, 使用 force 覆盖: ") + path)
+	}
+	files, err := backupFiles()
+	if err != nil {
+		return manifest, err
+	}
+
+	var privkey string
+	manifest = BackupManifest{
+		Version:  backupVersion,
+		Created:  time.Now().Unix(),
+		Operator: currentOperator(),
+		Files:    make(map[string]string),
+	}
+	for _, f := range files {
+		sum := sha256.Sum256(f.data)
+		manifest.Files[f.name] = hex.EncodeToString(sum[:])
+		if f.name == backupPrivKey {
+			privkey = string(f.data)
+		}
+	}
+	key, err := crypto.NewKeyFromArmored(privkey)
+	if err != nil {
+		return manifest, errors.New(T("无法读取本地私钥: ") + err.Error())
+	}
+	manifest.Fingerprint = key.GetFingerprint()
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, errors.New(T("序列化错误: ") + err.Error())
+	}
+
+	// 签名清单, 清单中的SHA-256保证了各文件的完整性
+	keyRing, err := crypto.NewKeyRing(key)
+	if err != nil {
+		return manifest, errors.New(T("签名时发生错误: ") + err.Error())
+	}
+	signature, err := keyRing.SignDetached(crypto.NewPlainMessage(content))
+	if err != nil {
+		return manifest, errors.New(T("签名时发生错误: ") + err.Error())
+	}
+	armored, err := signature.GetArmored()
+	if err != nil {
+		return manifest, errors.New(T("签名时发生错误: ") + err.Error())
+	}
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	entries := append([]BackupFile{
+		{name: backupManifest, data: content},
+		{name: backupSignature, data: []byte(armored)},
+	}, files...)
+	for _, f := range entries {
+		err = tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0600, Size: int64(len(f.data)), ModTime: time.Unix(manifest.Created, 0)})
+		if err == nil {
+			_, err = tw.Write(f.data)
+		}
+		if err != nil {
+			return manifest, errors.New(T("打包备份错误: ") + err.Error())
+		}
+	}
+	err = tw.Close()
+	if err != nil {
+		return manifest, errors.New(T("打包备份错误: ") + err.Error())
+	}
+
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(archive.Bytes()), passphrase)
+	if err != nil {
+		return manifest, errors.New(T("加密备份错误: ") + err.Error())
+	}
+	err = writeFileAtomic(path, encrypted.GetBinary(), 0600)
+	if err != nil {
+		return manifest, errors.New(T("文件写入错误: ") + err.Error())
+	}
+	return manifest, nil
+}
+
+// openBackup 解密备份并校验签名和各文件的完整性
+//
+// pubkey 为空时使用备份中的公钥校验签名, 此时只能保证备份未被篡改, 不能证明备份的来源.
+func openBackup(path string, passphrase []byte, pubkey string) (BackupManifest, map[string][]byte, error) {
+	var manifest BackupManifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, nil, errors.New(T("读取备份错误: ") + err.Error())
+	}
+	archive, err := crypto.DecryptMessageWithPassword(crypto.NewPGPMessage(data), passphrase)
+	if err != nil {
+		return manifest, nil, errors.New(T("解密备份错误, 请检查密码: ") + err.Error())
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(bytes.NewReader(archive.GetBinary()))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, nil, errors.New(T("备份格式错误: ") + err.Error())
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return manifest, nil, errors.New(T("备份格式错误: ") + err.Error())
+		}
+		files[header.Name] = content
+	}
+
+	err = json.Unmarshal(files[backupManifest], &manifest)
+	if err != nil {
+		return manifest, nil, errors.New(T("备份格式错误: ") + err.Error())
+	}
+	if manifest.Version != backupVersion {
+		return manifest, nil, fmt.Errorf(T("不支持的备份版本: %d"), manifest.Version)
+	}
+
+	if pubkey == "" {
+		pubkey = string(files[backupPubKey])
+	}
+	key, err := crypto.NewKeyFromArmored(pubkey)
+	if err != nil {
+		return manifest, nil, errors.New(T("无法解析公钥: ") + err.Error())
+	}
+	keyRing, err := crypto.NewKeyRing(key)
+	if err != nil {
+		return manifest, nil, errors.New(T("无法解析公钥: ") + err.Error())
+	}
+	signature, err := crypto.NewPGPSignatureFromArmored(string(files[backupSignature]))
+	if err == nil {
+		err = keyRing.VerifyDetached(crypto.NewPlainMessage(files[backupManifest]), signature, crypto.GetUnixTime())
+	}
+	if err != nil {
+		return manifest, nil, errors.New(T("备份签名校验失败: ") + err.Error())
+	}
+
+	// 校验清单中列出的文件, 并丢弃清单以外的内容
+	verified := make(map[string][]byte)
+	for name, sum := range manifest.Files {
+		content, ok := files[name]
+		if !ok {
+			return manifest, nil, errors.New(T("备份中缺少文件: ") + name)
+		}
+		actual := sha256.Sum256(content)
+		if hex.EncodeToString(actual[:]) != sum {
+			return manifest, nil, errors.New(T("备份中的文件已损坏: ") + name)
+		}
+		verified[name] = content
+	}
+	for _, name := range []string{backupDB, backupPrivKey, backupPubKey} {
+		if _, ok := verified[name]; !ok {
+			return manifest, nil, errors.New(T("备份中缺少文件: ") + name)
+		}
+	}
+	fingerprint, err := keyFingerprint(string(verified[backupPrivKey]))
+	if err != nil {
+		return manifest, nil, err
+	}
+	if fingerprint != manifest.Fingerprint {
+		return manifest, nil, errors.New(T("备份中的私钥与清单不符"))
+	}
+	return manifest, verified, nil
+}
+
+// restoreBackup 校验并恢复备份, 本地已有数据时需要force
+//
+// 默认使用本地数据库中的公钥校验签名, 也可以通过pubkeyPath指定公钥;
+// 只有 trustEmbedded 为真时才使用备份中的公钥, 否则重新签名的备份也能通过校验.
+// 恢复后重新打开数据库, 并在恢复的数据库中记录本次恢复.
+func restoreBackup(path string, passphrase []byte, pubkeyPath string, trustEmbedded, force bool) (BackupManifest, error) {
+	var pubkey string
+	switch {
+	case pubkeyPath != "":
+		data, err := os.ReadFile(pubkeyPath)
+		if err != nil {
+			return BackupManifest{}, errors.New(T("读取指定公钥错误: ") + err.Error())
+		}
+		pubkey = string(data)
+	case !trustEmbedded:
+		err := db.QueryRow("SELECT IFNULL(public_key, '') FROM Config").Scan(&pubkey)
+		if err != nil {
+			return BackupManifest{}, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		if pubkey == "" {
+			return BackupManifest{}, errors.New(T("本地没有公钥, 请使用 pubkey 指定签名备份的公钥"))
+		}
+	}
+	manifest, files, err := openBackup(path, passphrase, pubkey)
+	if err != nil {
+		if pubkeyPath == "" && !trustEmbedded {
+			return manifest, fmt.Errorf(T("%s (已使用本地公钥校验; 在新目录中恢复时, 请使用 pubkey 指定原服务器的公钥, 或使用 trust-embedded-key 信任备份中的公钥)"), err)
+		}
+		return manifest, err
+	}
+	if trustEmbedded && pubkeyPath == "" {
+		logger.Warn("已使用备份中的公钥校验签名, 只能保证备份未被篡改, 不能证明备份的来源", F("fingerprint", manifest.Fingerprint))
+	}
+
+	// 新建的数据库中只有自动生成的密钥, 可以直接覆盖
+	exists, err := hasLocalData()
+	if err != nil {
+		return manifest, err
+	}
+	if exists && !force {
+		return manifest, errors.New(T("本地已有数据, 恢复将覆盖数据库和密钥, 请使用 force 确认"))
+	}
+
+	err = db.Close()
+	if err != nil {
+		return manifest, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	for _, f := range []BackupFile{
+		{name: backupDB, path: SqlPath, perm: 0600},
+		{name: backupPrivKey, path: "rsa-priv.pem", perm: 0600},
+		{name: backupPubKey, path: "rsa-pub.pem", perm: 0644},
+		{name: backupConfig, path: ConfigPath, perm: 0644},
+	} {
+		if _, ok := files[f.name]; !ok {
+			continue
+		}
+		err = writeFileAtomic(f.path, files[f.name], f.perm)
+		if err != nil {
+			return manifest, errors.New(T("文件写入错误: ") + err.Error())
+		}
+	}
+
+	err = openDB()
+	if err != nil {
+		return manifest, err
+	}
+	audit(AuditBackupRestore, manifest.Fingerprint, map[string]interface{}{"path": path, "created": manifest.Created, "operator": manifest.Operator})
+	return manifest, nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名, 避免中途失败时留下不完整的文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
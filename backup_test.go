@@ -0,0 +1,240 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+// rewriteBackup 用同一密码解密备份, 修改其中的一个文件后重新加密
+func rewriteBackup(t *testing.T, path string, passphrase []byte, name string, edit func([]byte) []byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := crypto.DecryptMessageWithPassword(crypto.NewPGPMessage(data), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	tr := tar.NewReader(bytes.NewReader(archive.GetBinary()))
+	tw := tar.NewWriter(&out)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Name == name {
+			content = edit(content)
+			header.Size = int64(len(content))
+		}
+		if err = tw.WriteHeader(header); err == nil {
+			_, err = tw.Write(content)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := crypto.EncryptMessageWithPassword(crypto.NewPlainMessage(out.Bytes()), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, encrypted.GetBinary(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useOtherKey 将本地数据库中的密钥换成新生成的密钥, 模拟在新目录中初始化的服务器
+func useOtherKey(t *testing.T) {
+	t.Helper()
+	private, public := newTestKey(t)
+	_, err := db.Exec("UPDATE Config SET private_key = ?, public_key = ?", private, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	const player = "252af321-89aa-426c-a534-399f551810ae"
+	passphrase := []byte("correct horse battery staple")
+	backups := t.TempDir()
+	path := filepath.Join(backups, "openmprdb.backup")
+
+	newTestDB(t)
+	setOperator(t, "alice")
+	err := os.WriteFile(ConfigPath, []byte("report:\n  threshold: -1\n"), 0644)
+	if err == nil {
+		err = addOverride(OverrideDeny, player, "banned in game", "")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := createBackup(path, passphrase, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := keyFingerprint(testLocalKey.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version != backupVersion || manifest.Operator != "alice" || manifest.Fingerprint != fingerprint || len(manifest.Files) != 4 || manifest.Files[backupConfig] == "" {
+		t.Errorf("createBackup() = %+v", manifest)
+	}
+	if _, err := createBackup(path, passphrase, false); err == nil {
+		t.Error("createBackup() over an existing file succeeded without force")
+	}
+
+	t.Run("restore", func(t *testing.T) {
+		// 备份之后的修改在恢复后被丢弃
+		err := addOverride(OverrideAllow, "00000000-0000-4000-8000-00000000000a", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := restoreBackup(path, passphrase, "", false, false); err == nil {
+			t.Error("restoreBackup() over local data succeeded without force")
+		}
+		if _, err := restoreBackup(path, []byte("wrong"), "", false, true); err == nil {
+			t.Error("restoreBackup() with a wrong passphrase succeeded")
+		}
+		_, err = restoreBackup(path, passphrase, "", false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := overrideList("")
+		if err != nil || len(list) != 1 || list[0].player_uuid != player || list[0].note != "banned in game" {
+			t.Errorf("overrides after restore = %+v, %v", list, err)
+		}
+		entries, err := auditList(AuditFilter{action: AuditBackupRestore})
+		if err != nil || len(entries) != 1 || entries[0].Target != fingerprint || entries[0].Operator != "alice" {
+			t.Errorf("audit log after restore = %+v, %v", entries, err)
+		}
+	})
+
+	t.Run("fresh directory", func(t *testing.T) {
+		pubkey := filepath.Join(backups, "rsa-pub.pem")
+		err := os.WriteFile(pubkey, []byte(testLocalKey.public), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range []struct {
+			name          string
+			pubkey        string
+			trustEmbedded bool
+		}{
+			{name: "pubkey", pubkey: pubkey},
+			{name: "trust embedded key", trustEmbedded: true},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				newTestDB(t)
+				useOtherKey(t)
+				// 新目录中的密钥与备份不同, 默认的校验失败
+				_, err := restoreBackup(path, passphrase, "", false, false)
+				if err == nil || !strings.Contains(err.Error(), "trust-embedded-key") {
+					t.Errorf("restoreBackup() with the local key = %v", err)
+				}
+				_, err = restoreBackup(path, passphrase, tt.pubkey, tt.trustEmbedded, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var private string
+				err = db.QueryRow("SELECT private_key FROM Config").Scan(&private)
+				if err != nil || private != testLocalKey.private {
+					t.Errorf("private key after restore differs from the backup (%v)", err)
+				}
+				for name, want := range map[string]string{"rsa-priv.pem": testLocalKey.private, ConfigPath: "report:\n  threshold: -1\n"} {
+					data, err := os.ReadFile(name)
+					if err != nil || string(data) != want {
+						t.Errorf("%s after restore = %q, %v", name, data, err)
+					}
+				}
+				list, err := overrideList("")
+				if err != nil || len(list) != 1 {
+					t.Errorf("overrides after restore = %+v, %v", list, err)
+				}
+			})
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			file string
+			edit func([]byte) []byte
+		}{
+			{name: "database", file: backupDB, edit: func(b []byte) []byte { return append(b, 0) }},
+			{name: "manifest", file: backupManifest, edit: func(b []byte) []byte {
+				return bytes.Replace(b, []byte(`"alice"`), []byte(`"mallory"`), 1)
+			}},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				newTestDB(t)
+				tampered := filepath.Join(t.TempDir(), "tampered.backup")
+				data, err := os.ReadFile(path)
+				if err == nil {
+					err = os.WriteFile(tampered, data, 0600)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				rewriteBackup(t, tampered, passphrase, tt.file, tt.edit)
+				for _, trustEmbedded := range []bool{false, true} {
+					if _, err := restoreBackup(tampered, passphrase, "", trustEmbedded, true); err == nil {
+						t.Errorf("restoreBackup(trustEmbedded=%v) of a tampered backup succeeded", trustEmbedded)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestReadPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "passphrase")
+	empty := filepath.Join(dir, "empty")
+	err := os.WriteFile(file, []byte("secret\r\n"), 0600)
+	if err == nil {
+		err = os.WriteFile(empty, []byte("\n"), 0600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, ok := os.LookupEnv("OPENMPRDB_BACKUP_PASSPHRASE")
+	os.Setenv("OPENMPRDB_BACKUP_PASSPHRASE", "from env")
+	defer func() {
+		if ok {
+			os.Setenv("OPENMPRDB_BACKUP_PASSPHRASE", old)
+		} else {
+			os.Unsetenv("OPENMPRDB_BACKUP_PASSPHRASE")
+		}
+	}()
+
+	// 密码文件优先于环境变量
+	if got, err := readPassphrase(file, true); err != nil || string(got) != "secret" {
+		t.Errorf("readPassphrase(file) = %q, %v", got, err)
+	}
+	if got, err := readPassphrase("", true); err != nil || string(got) != "from env" {
+		t.Errorf("readPassphrase() = %q, %v", got, err)
+	}
+	for _, name := range []string{empty, filepath.Join(dir, "missing")} {
+		if _, err := readPassphrase(name, false); err == nil {
+			t.Errorf("readPassphrase(%s) succeeded", filepath.Base(name))
+		}
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigPath 配置文件的路径, 默认与数据库在同一目录下
+var ConfigPath = filepath.Join(filepath.Dir(SqlPath), "config.yaml")
+
+// fileConfig 从配置文件中读取的配置, 以 update.threshold 这样的完整名称为键
+var fileConfig = make(map[string]string)
+
+// 配置的取值类型
+const (
+	SettingString   = "string"
+	SettingInt      = "int"
+	SettingFloat    = "float"
+	SettingDuration = "duration"
+)
+
+// 配置的来源, 优先级从高到低
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDB      = "db"
+	SourceDefault = "default"
+)
+
+// Setting 一个配置项, 依次从命令行参数, 环境变量, 配置文件和数据库中读取, 都没有时使用默认值
+type Setting struct {
+	key  string
+	kind string
+	// flag 对应的命令行参数, 只在有该参数的命令中生效
+	flag string
+	env  string
+	def  string
+	// check 检查取值是否有效, 为nil时只检查类型
+	check func(string) error
+	// db 从数据库中读取取值, 为nil时没有对应的数据
+	db func(c *cli.Context) (string, error)
+	// secret 为真时 config list 不显示取值
+	secret bool
+}
+
+// settings 所有的配置项, 按显示的顺序排列
+var settings = []Setting{
+	{key: "operator", kind: SettingString, flag: "operator", env: "OPENMPRDB_OPERATOR"},
+	{key: "log.level", kind: SettingString, flag: "log-level", env: "OPENMPRDB_LOG_LEVEL", def: "info", check: func(v string) error {
+		_, err := parseLevel(v)
+		return err
+	}},
+	{key: "log.format", kind: SettingString, flag: "log-format", env: "OPENMPRDB_LOG_FORMAT", def: LogFormatText, check: checkLogFormat},
+	{key: "log.lang", kind: SettingString, flag: "log-lang", env: "OPENMPRDB_LOG_LANG", check: checkLanguage},
+	{key: "http.timeout", kind: SettingDuration, flag: "http-timeout", env: "OPENMPRDB_HTTP_TIMEOUT", def: "30s"},
+	{key: "server.name", kind: SettingString, flag: "server_name", env: "OPENMPRDB_SERVER_NAME", db: func(c *cli.Context) (string, error) {
+		instance, err := contextInstance(c)
+		return instance.server_name, err
+	}},
+	{key: "server.address", kind: SettingString, flag: "remote", env: "OPENMPRDB_SERVER_ADDRESS", db: func(c *cli.Context) (string, error) {
+		instance, err := contextInstance(c)
+		return instance.server_address, err
+	}},
+	{key: "update.threshold", kind: SettingFloat, flag: "less", env: "OPENMPRDB_UPDATE_THRESHOLD"},
+	{key: "update.export", kind: SettingString, flag: "export", env: "OPENMPRDB_UPDATE_EXPORT"},
+	{key: "update.on-server-error", kind: SettingString, flag: "on-server-error", env: "OPENMPRDB_UPDATE_ON_SERVER_ERROR", def: OnErrorFail, check: checkOnError},
+	{key: "update.metrics-file", kind: SettingString, flag: "metrics-file", env: "OPENMPRDB_METRICS_FILE"},
+	{key: "rcon.address", kind: SettingString, flag: "rcon", env: "OPENMPRDB_RCON_ADDRESS"},
+	{key: "rcon.password", kind: SettingString, env: "OPENMPRDB_RCON_PASSWORD", secret: true},
+	{key: "rcon.ban-command", kind: SettingString, env: "OPENMPRDB_RCON_BAN_COMMAND", def: "ban {{.UUID}} OpenMPRDB-CLI Ban", check: checkCommandTemplate},
+	{key: "rcon.pardon-command", kind: SettingString, env: "OPENMPRDB_RCON_PARDON_COMMAND", def: "pardon {{.UUID}}", check: checkCommandTemplate},
+	{key: "daemon.listen", kind: SettingString, flag: "listen", env: "OPENMPRDB_DAEMON_LISTEN", def: ":9477"},
+	{key: "daemon.interval", kind: SettingDuration, flag: "interval", env: "OPENMPRDB_DAEMON_INTERVAL", def: "1h"},
+	{key: "trust.level", kind: SettingInt, flag: "level", env: "OPENMPRDB_TRUST_LEVEL", check: func(v string) error {
+		level, _ := strconv.Atoi(v)
+		return checkLevel(level)
+	}},
+	{key: "trust.depth", kind: SettingInt, flag: "trust-depth", env: "OPENMPRDB_TRUST_DEPTH", def: "1", check: func(v string) error {
+		if depth, _ := strconv.Atoi(v); depth < 1 {
+			return fmt.Errorf(T("信任深度必须大于等于 1: %d"), depth)
+		}
+		return nil
+	}},
+	{key: "trust.attenuation", kind: SettingFloat, flag: "trust-attenuation", env: "OPENMPRDB_TRUST_ATTENUATION", def: "0.5", check: func(v string) error {
+		if attenuation, _ := strconv.ParseFloat(v, 64); attenuation < 0 || attenuation > 1 {
+			return fmt.Errorf(T("衰减系数必须在 0 ~ 1 之间: %g"), attenuation)
+		}
+		return nil
+	}},
+}
+
+// findSetting 按名称查找配置项
+func findSetting(key string) (Setting, error) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, nil
+		}
+	}
+	return Setting{}, errors.New(T("未知的配置项: ") + key)
+}
+
+// validate 检查取值的类型以及是否有效
+func (s Setting) validate(value string) error {
+	var err error
+	switch s.kind {
+	case SettingInt:
+		_, err = strconv.Atoi(value)
+	case SettingFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case SettingDuration:
+		var d time.Duration
+		d, err = time.ParseDuration(value)
+		if err == nil && d <= 0 {
+			err = errors.New(T("必须大于 0"))
+		}
+	}
+	if err == nil && s.check != nil {
+		err = s.check(value)
+	}
+	if err != nil {
+		return fmt.Errorf(T("配置项 %s 的取值无效: %s"), s.key, err)
+	}
+	return nil
+}
+
+// resolve 按 参数 > 环境变量 > 配置文件 > 数据库 > 默认值 的顺序读取配置, 返回取值和来源
+func (s Setting) resolve(c *cli.Context) (string, string, error) {
+	// 环境变量由 s.env 读取, 对应的参数不能再声明 EnvVars, 否则 IsSet 为真, 来源会被误报为参数
+	if c != nil && s.flag != "" && c.IsSet(s.flag) {
+		// String 对任意类型的参数都返回其文本形式, 并会查找上级命令的参数
+		return c.String(s.flag), SourceFlag, nil
+	}
+	if value := os.Getenv(s.env); s.env != "" && value != "" {
+		return value, SourceEnv, nil
+	}
+	if value, ok := fileConfig[s.key]; ok {
+		return value, SourceFile, nil
+	}
+	if s.db != nil {
+		value, err := s.db(c)
+		if err != nil {
+			return "", "", err
+		}
+		if value != "" {
+			return value, SourceDB, nil
+		}
+	}
+	return s.def, SourceDefault, nil
+}
+
+// settingValue 读取配置并检查取值, 未设置时返回空字符串
+func settingValue(c *cli.Context, key string) (string, error) {
+	s, err := findSetting(key)
+	if err != nil {
+		return "", err
+	}
+	value, _, err := s.resolve(c)
+	if err != nil || value == "" {
+		return "", err
+	}
+	return value, s.validate(value)
+}
+
+// settingString 读取字符串类型的配置, 出错时返回空字符串
+func settingString(c *cli.Context, key string) string {
+	value, err := settingValue(c, key)
+	if err != nil {
+		logger.Warn("配置项无效, 已忽略", F("key", key), F("error", err))
+		return ""
+	}
+	return value
+}
+
+// settingInt 读取整数类型的配置, 未设置时返回0
+func settingInt(c *cli.Context, key string) (int, error) {
+	value, err := settingValue(c, key)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// settingFloat 读取小数类型的配置, 未设置时返回nil
+func settingFloat(c *cli.Context, key string) (*float64, error) {
+	value, err := settingValue(c, key)
+	if err != nil || value == "" {
+		return nil, err
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// settingDuration 读取时长类型的配置, 未设置时返回0
+func settingDuration(c *cli.Context, key string) (time.Duration, error) {
+	value, err := settingValue(c, key)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	return time.ParseDuration(value)
+}
+
+// contextInstance 读取命令中指定的中心服务器, 未注册时返回空的记录
+func contextInstance(c *cli.Context) (Instance, error) {
+	name := defaultInstance
+	if c != nil && c.String("instance") != "" {
+		name = c.String("instance")
+	}
+	list, err := instanceList()
+	if err != nil {
+		return Instance{}, err
+	}
+	for _, i := range list {
+		if i.name == name {
+			return i, nil
+		}
+	}
+	return Instance{}, nil
+}
+
+// checkLogFormat 检查日志格式
+func checkLogFormat(format string) error {
+	if format != LogFormatText && format != LogFormatJSON {
+		return fmt.Errorf(T("未知的日志格式: %s (可选 %s, %s)"), format, LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
+
+// checkLanguage 检查语言
+func checkLanguage(lang string) error {
+	if normalizeLanguage(lang) == "" {
+		return fmt.Errorf(T("未知的语言: %s (可选 zh-CN, en-US)"), lang)
+	}
+	return nil
+}
+
+// checkOnError 检查服务器获取失败时的处理方式
+func checkOnError(onError string) error {
+	switch onError {
+	case OnErrorFail, OnErrorSkip, OnErrorUseCache:
+		return nil
+	}
+	return fmt.Errorf(T("未知的处理方式: %s (可选 %s, %s, %s)"), onError, OnErrorFail, OnErrorSkip, OnErrorUseCache)
+}
+
+// loadConfig 读取配置文件, 文件不存在时不做任何事
+func loadConfig(path string) error {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.New(T("读取配置文件错误: ") + err.Error())
+	}
+	var data yaml.MapSlice
+	err = yaml.Unmarshal(content, &data)
+	if err != nil {
+		return errors.New(T("配置文件格式错误: ") + err.Error())
+	}
+	config := make(map[string]string)
+	flattenConfig("", data, config)
+	for key := range config {
+		if _, err := findSetting(key); err != nil {
+			logger.Warn("配置文件中有未知的配置项, 已忽略", F("key", key), F("path", path))
+			delete(config, key)
+		}
+	}
+	fileConfig = config
+	return nil
+}
+
+// flattenConfig 将嵌套的配置展开为 update.threshold 这样的完整名称
+func flattenConfig(prefix string, data yaml.MapSlice, out map[string]string) {
+	for _, item := range data {
+		key := prefix + fmt.Sprint(item.Key)
+		switch value := item.Value.(type) {
+		case yaml.MapSlice:
+			flattenConfig(key+".", value, out)
+		case nil:
+		default:
+			out[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// saveConfig 将配置写入配置文件, 按配置项的顺序分组
+//
+// 配置文件会被重新生成, 其中的注释不会保留.
+func saveConfig(path string, config map[string]string) error {
+	var data yaml.MapSlice
+	groups := make(map[string]int)
+	for _, s := range settings {
+		raw, ok := config[s.key]
+		if !ok {
+			continue
+		}
+		var value interface{} = raw
+		switch s.kind {
+		case SettingInt:
+			value, _ = strconv.Atoi(raw)
+		case SettingFloat:
+			value, _ = strconv.ParseFloat(raw, 64)
+		}
+		parts := strings.SplitN(s.key, ".", 2)
+		if len(parts) == 1 {
+			data = append(data, yaml.MapItem{Key: s.key, Value: value})
+			continue
+		}
+		i, ok := groups[parts[0]]
+		if !ok {
+			i = len(data)
+			groups[parts[0]] = i
+			data = append(data, yaml.MapItem{Key: parts[0], Value: yaml.MapSlice{}})
+		}
+		data[i].Value = append(data[i].Value.(yaml.MapSlice), yaml.MapItem{Key: parts[1], Value: value})
+	}
+	content, err := yaml.Marshal(data)
+	if err != nil {
+		return errors.New(T("序列化错误: ") + err.Error())
+	}
+	err = writeFileAtomic(path, content, 0644)
+	if err != nil {
+		return errors.New(T("文件写入错误: ") + err.Error())
+	}
+	return nil
+}
+
+// setConfig 修改配置文件中的一项, value为nil时删除该项
+func setConfig(key string, value *string) error {
+	s, err := findSetting(key)
+	if err != nil {
+		return err
+	}
+	config := make(map[string]string)
+	for k, v := range fileConfig {
+		config[k] = v
+	}
+	if value == nil {
+		if _, ok := config[key]; !ok {
+			return errors.New(T("配置文件中没有该配置项: ") + key)
+		}
+		delete(config, key)
+	} else {
+		err = s.validate(*value)
+		if err != nil {
+			return err
+		}
+		config[key] = *value
+	}
+	err = saveConfig(ConfigPath, config)
+	if err != nil {
+		return err
+	}
+	fileConfig = config
+	if value == nil {
+		audit(AuditConfigUnset, key, nil)
+	} else {
+		audit(AuditConfigSet, key, map[string]interface{}{"value": *value})
+	}
+	return nil
+}
+
+// listConfig 列出所有配置项的当前取值和来源
+func listConfig(c *cli.Context) error {
+	fmt.Println(T("配置项\t\t\t|来源\t\t|取值"))
+	for _, s := range settings {
+		value, source, err := s.resolve(c)
+		if err != nil {
+			return err
+		}
+		if source == SourceDefault && value == "" {
+			value = T("(未设置)")
+		} else if s.secret && value != "" {
+			value = "******"
+		}
+		fmt.Println(fmt.Sprintf("%-24s|%s\t\t|%s", s.key, T(source), value))
+	}
+	logger.Info("已到达最底端", F("path", ConfigPath))
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// setEnv 设置环境变量, 测试结束后恢复
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+	old, ok := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+	os.Setenv(key, value)
+}
+
+// setFileConfig 替换配置文件中读取的配置, 测试结束后恢复
+func setFileConfig(t *testing.T, config map[string]string) {
+	t.Helper()
+	old := fileConfig
+	t.Cleanup(func() { fileConfig = old })
+	fileConfig = config
+}
+
+// newTestContext 用给定的命令行参数创建命令的上下文
+func newTestContext(t *testing.T, args ...string) *cli.Context {
+	t.Helper()
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("remote", "", "")
+	set.String("instance", "", "")
+	set.Int("trust-depth", 0, "")
+	err := set.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+func TestSettingResolve(t *testing.T) {
+	newTestDB(t)
+	setFileConfig(t, map[string]string{})
+	setEnv(t, "OPENMPRDB_SERVER_ADDRESS", "")
+	for name, address := range map[string]string{defaultInstance: "https://db.example.com", "mirror": "https://mirror.example.com"} {
+		err := registerServer(name, "Neko", testLocalUUID, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := findSetting("server.address")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 依次加入优先级更高的来源
+	steps := []struct {
+		name   string
+		set    func()
+		args   []string
+		value  string
+		source string
+	}{
+		{name: "db", value: "https://db.example.com", source: SourceDB},
+		{name: "db of another instance", args: []string{"--instance", "mirror"}, value: "https://mirror.example.com", source: SourceDB},
+		{name: "file", set: func() { fileConfig["server.address"] = "https://file.example.com" }, value: "https://file.example.com", source: SourceFile},
+		{name: "env", set: func() { os.Setenv("OPENMPRDB_SERVER_ADDRESS", "https://env.example.com") }, value: "https://env.example.com", source: SourceEnv},
+		{name: "flag", args: []string{"--remote", "https://flag.example.com"}, value: "https://flag.example.com", source: SourceFlag},
+	}
+	for _, step := range steps {
+		if step.set != nil {
+			step.set()
+		}
+		value, source, err := s.resolve(newTestContext(t, step.args...))
+		if err != nil || value != step.value || source != step.source {
+			t.Errorf("%s: resolve() = %q, %q, %v, want %q from %s", step.name, value, source, err, step.value, step.source)
+		}
+	}
+
+	// 没有上下文时不读取参数
+	if value, source, err := s.resolve(nil); err != nil || source != SourceEnv || value != "https://env.example.com" {
+		t.Errorf("resolve(nil) = %q, %q, %v", value, source, err)
+	}
+	depth, err := findSetting("trust.depth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, source, err := depth.resolve(newTestContext(t)); err != nil || value != "1" || source != SourceDefault {
+		t.Errorf("resolve() of an unset setting = %q, %q, %v", value, source, err)
+	}
+}
+
+func TestSettingValue(t *testing.T) {
+	setFileConfig(t, map[string]string{"trust.depth": "3", "update.threshold": "-1.5", "http.timeout": "10s", "log.format": "xml"})
+	c := newTestContext(t)
+	if got, err := settingInt(c, "trust.depth"); err != nil || got != 3 {
+		t.Errorf("settingInt() = %d, %v", got, err)
+	}
+	if got, err := settingInt(newTestContext(t, "--trust-depth", "2"), "trust.depth"); err != nil || got != 2 {
+		t.Errorf("settingInt() with a flag = %d, %v", got, err)
+	}
+	if got, err := settingFloat(c, "update.threshold"); err != nil || got == nil || *got != -1.5 {
+		t.Errorf("settingFloat() = %v, %v", got, err)
+	}
+	if got, err := settingFloat(c, "update.export"); err != nil || got != nil {
+		t.Errorf("settingFloat() of an unset setting = %v, %v", got, err)
+	}
+	if got, err := settingDuration(c, "http.timeout"); err != nil || got.Seconds() != 10 {
+		t.Errorf("settingDuration() = %v, %v", got, err)
+	}
+	// 无效的取值
+	if _, err := settingValue(c, "log.format"); err == nil {
+		t.Error("settingValue() of an invalid value succeeded")
+	}
+	if got := settingString(c, "log.format"); got != "" {
+		t.Errorf("settingString() of an invalid value = %q", got)
+	}
+	if _, err := settingInt(newTestContext(t, "--trust-depth", "0"), "trust.depth"); err == nil {
+		t.Error("settingInt() of a depth below 1 succeeded")
+	}
+	if _, err := settingValue(c, "no.such.key"); err == nil {
+		t.Error("settingValue() of an unknown key succeeded")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	setFileConfig(t, map[string]string{})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(path, []byte("operator: alice\nupdate:\n  threshold: -1\n  export:\ntrust:\n  depth: 2\nunknown:\n  key: 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 空值和未知的配置项被忽略
+	want := map[string]string{"operator": "alice", "update.threshold": "-1", "trust.depth": "2"}
+	if len(fileConfig) != len(want) {
+		t.Errorf("loadConfig() = %v, want %v", fileConfig, want)
+	}
+	for key, value := range want {
+		if fileConfig[key] != value {
+			t.Errorf("loadConfig() = %v, want %v", fileConfig, want)
+			break
+		}
+	}
+
+	// 文件不存在时保留原有的配置
+	if err := loadConfig(filepath.Join(dir, "missing.yaml")); err != nil || fileConfig["operator"] != "alice" {
+		t.Errorf("loadConfig() of a missing file = %v, %v", fileConfig, err)
+	}
+	err = os.WriteFile(path, []byte("update: [\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(path); err == nil {
+		t.Error("loadConfig() of an invalid file succeeded")
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	newTestDB(t)
+	setFileConfig(t, map[string]string{})
+	setOperator(t, "alice")
+	threshold := "-1.5"
+	depth := "2"
+	for key, value := range map[string]*string{"update.threshold": &threshold, "trust.depth": &depth} {
+		err := setConfig(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(ConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 按配置项的顺序分组, 数值不加引号
+	if want := "update:\n  threshold: -1.5\ntrust:\n  depth: 2\n"; string(data) != want {
+		t.Errorf("config file = %q, want %q", data, want)
+	}
+
+	invalid := "0"
+	if err := setConfig("trust.depth", &invalid); err == nil {
+		t.Error("setConfig() of an invalid value succeeded")
+	}
+	if err := setConfig("no.such.key", &depth); err == nil {
+		t.Error("setConfig() of an unknown key succeeded")
+	}
+	err = setConfig("update.threshold", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setConfig("update.threshold", nil); err == nil {
+		t.Error("setConfig() removing a missing key succeeded")
+	}
+
+	// 重新读取的配置与修改后的一致
+	setFileConfig(t, map[string]string{})
+	err = loadConfig(ConfigPath)
+	if err != nil || len(fileConfig) != 1 || fileConfig["trust.depth"] != "2" {
+		t.Errorf("loadConfig() after setConfig() = %v, %v", fileConfig, err)
+	}
+	list, err := auditList(AuditFilter{action: "config"})
+	if err != nil || len(list) != 3 || list[2].Action != AuditConfigUnset || list[2].Target != "update.threshold" || list[2].Operator != "alice" {
+		t.Errorf("audit log = %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+)
+
+// 检查结果的状态
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// doctor 的退出码, 与 Nagios 插件的约定相同
+const (
+	ExitOK      = 0
+	ExitWarning = 1
+	ExitFailure = 2
+	// ExitUnknown 无法完成检查
+	ExitUnknown = 3
+)
+
+// Check 一项检查的结果
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// DoctorOptions doctor 的参数
+type DoctorOptions struct {
+	// offline 为真时跳过需要访问中心服务器的检查
+	offline bool
+}
+
+// checkResult 根据错误生成检查结果, err为nil时为正常
+func checkResult(name, status string, err error, detail string) Check {
+	if err != nil {
+		return Check{Name: name, Status: status, Detail: err.Error()}
+	}
+	return Check{Name: name, Status: CheckOK, Detail: detail}
+}
+
+// checkIntegrity 使用 PRAGMA integrity_check 检查数据库是否损坏
+func checkIntegrity() Check {
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return checkResult("database.integrity", CheckFail, errors.New(T("本地数据库错误: ")+err.Error()), "")
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		err := rows.Scan(&line)
+		if err != nil {
+			return checkResult("database.integrity", CheckFail, errors.New(T("本地数据库错误: ")+err.Error()), "")
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return checkResult("database.integrity", CheckFail, errors.New(T("本地数据库错误: ")+err.Error()), "")
+	}
+	if len(problems) > 0 {
+		return checkResult("database.integrity", CheckFail, errors.New(T("数据库已损坏: ")+strings.Join(problems, "; ")), "")
+	}
+	return checkResult("database.integrity", CheckOK, nil, SqlPath)
+}
+
+// checkSchema 检查数据库结构的版本
+func checkSchema() Check {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return checkResult("database.schema", CheckFail, errors.New(T("无法读取数据库版本: ")+err.Error()), "")
+	}
+	if version != len(migrations) {
+		return checkResult("database.schema", CheckFail, fmt.Errorf(T("数据库版本为 %d, 程序需要的版本为 %d"), version, len(migrations)), "")
+	}
+	return checkResult("database.schema", CheckOK, nil, fmt.Sprintf(T("版本 %d"), version))
+}
+
+// checkKeys 检查本地密钥: 私钥是否存在且可用, 公钥是否与私钥匹配, 以及密钥文件是否与数据库一致
+func checkKeys() []Check {
+	var privkey, pubkey string
+	err := db.QueryRow("SELECT IFNULL(private_key, ''), IFNULL(public_key, '') FROM Config").Scan(&privkey, &pubkey)
+	if err != nil {
+		return []Check{checkResult("key.private", CheckFail, errors.New(T("无法读取本地私钥: ")+err.Error()), "")}
+	}
+	if privkey == "" {
+		return []Check{checkResult("key.private", CheckFail, errors.New(T("数据库中没有私钥")), "")}
+	}
+	key, err := crypto.NewKeyFromArmored(privkey)
+	if err != nil {
+		return []Check{checkResult("key.private", CheckFail, errors.New(T("无法解析私钥: ")+err.Error()), "")}
+	}
+	if !key.IsPrivate() {
+		return []Check{checkResult("key.private", CheckFail, errors.New(T("数据库中保存的不是私钥")), "")}
+	}
+	if !key.CanVerify() {
+		return []Check{checkResult("key.private", CheckFail, errors.New(T("私钥已过期或被吊销")), "")}
+	}
+	checks := []Check{checkResult("key.private", CheckOK, nil, key.GetFingerprint())}
+
+	// 用私钥签名, 再用保存的公钥验证, 确认两者匹配
+	if pubkey == "" {
+		checks = append(checks, checkResult("key.public", CheckFail, errors.New(T("数据库中没有公钥")), ""))
+	} else {
+		signed, err := helper.SignCleartextMessageArmored(privkey, nil, "OpenMPRDB-CLI doctor")
+		if err == nil {
+			_, err = helper.VerifyCleartextMessageArmored(pubkey, signed, crypto.GetUnixTime())
+		}
+		if err != nil {
+			checks = append(checks, checkResult("key.public", CheckFail, errors.New(T("公钥与私钥不匹配: ")+err.Error()), ""))
+		} else {
+			checks = append(checks, checkResult("key.public", CheckOK, nil, T("与私钥匹配")))
+		}
+	}
+
+	// 密钥文件只是副本, 与数据库不一致时给出警告
+	var mismatched []string
+	for _, file := range []struct{ path, content string }{{"rsa-priv.pem", privkey}, {"rsa-pub.pem", pubkey}} {
+		data, err := os.ReadFile(file.path)
+		if err != nil || string(data) != file.content {
+			mismatched = append(mismatched, file.path)
+		}
+	}
+	if len(mismatched) > 0 {
+		checks = append(checks, checkResult("key.files", CheckWarn, errors.New(T("密钥文件缺失或与数据库不一致: ")+strings.Join(mismatched, ", ")), ""))
+	} else {
+		checks = append(checks, checkResult("key.files", CheckOK, nil, T("与数据库一致")))
+	}
+	return checks
+}
+
+// checkInstances 检查在各中心服务器上的注册信息, 不是离线模式时还会检查中心服务器能否访问以及登记的公钥
+func checkInstances(ctx context.Context, opts DoctorOptions) []Check {
+	list, err := instanceList()
+	if err != nil {
+		return []Check{checkResult("registration", CheckFail, err, "")}
+	}
+	if len(list) == 0 {
+		return []Check{checkResult("registration", CheckFail, errors.New(T("尚未在任何中心服务器上注册, 请先执行 register")), "")}
+	}
+	var pubkey string
+	err = db.QueryRow("SELECT IFNULL(public_key, '') FROM Config").Scan(&pubkey)
+	if err != nil {
+		return []Check{checkResult("registration", CheckFail, errors.New(T("本地数据库错误: ")+err.Error()), "")}
+	}
+	fingerprint, _ := keyFingerprint(pubkey)
+
+	var checks []Check
+	for _, instance := range list {
+		name := "instance." + instance.name
+		if instance.uuid == "" {
+			checks = append(checks, checkResult(name, CheckFail, fmt.Errorf(T("尚未在中心服务器 %s 上注册, 请先执行 register"), instance.name), ""))
+			continue
+		}
+		if opts.offline {
+			checks = append(checks, checkResult(name, CheckOK, nil, fmt.Sprintf(T("已注册: %s"), instance.uuid)))
+			continue
+		}
+
+		// 中心服务器上登记的公钥应当与本地的一致
+		remote, err := fetchServerKey(ctx, instance.server_address, instance.uuid)
+		if err != nil {
+			checks = append(checks, checkResult(name, CheckFail, fmt.Errorf(T("无法访问中心服务器 %s: %s"), instance.server_address, err), ""))
+			continue
+		}
+		remoteFingerprint, err := keyFingerprint(remote)
+		if err != nil {
+			checks = append(checks, checkResult(name, CheckFail, err, ""))
+			continue
+		}
+		if remoteFingerprint != fingerprint {
+			checks = append(checks, checkResult(name, CheckFail, fmt.Errorf(T("中心服务器上登记的公钥 %s 与本地的不一致"), remoteFingerprint), ""))
+			continue
+		}
+		checks = append(checks, checkResult(name, CheckOK, nil, fmt.Sprintf(T("已注册: %s"), instance.uuid)))
+	}
+	return checks
+}
+
+// checkServers 检查各信任的服务器的公钥, 不是离线模式时还会与中心服务器上登记的公钥比较
+func checkServers(ctx context.Context, opts DoctorOptions) []Check {
+	list, err := serverList()
+	if err != nil {
+		return []Check{checkResult("servers", CheckFail, err, "")}
+	}
+	instances, err := instanceList()
+	if err != nil {
+		return []Check{checkResult("servers", CheckFail, err, "")}
+	}
+	addresses := make(map[string]string)
+	for _, i := range instances {
+		addresses[i.name] = i.server_address
+	}
+
+	var checks []Check
+	for _, server := range list {
+		name := "server." + server.uuid
+		if server.disabled {
+			checks = append(checks, checkResult(name, CheckOK, nil, fmt.Sprintf(T("%s: 已停用, 跳过"), server.name)))
+			continue
+		}
+		key, err := crypto.NewKeyFromArmored(server.pubkey)
+		if err != nil {
+			checks = append(checks, checkResult(name, CheckFail, fmt.Errorf(T("%s: 无法解析公钥: %s"), server.name, err), ""))
+			continue
+		}
+		if !key.CanVerify() {
+			checks = append(checks, checkResult(name, CheckFail, fmt.Errorf(T("%s: 公钥已过期或被吊销, 无法验证签名"), server.name), ""))
+			continue
+		}
+		if key.IsPrivate() {
+			checks = append(checks, checkResult(name, CheckWarn, fmt.Errorf(T("%s: 导入的是私钥, 请只保存对方的公钥"), server.name), ""))
+			continue
+		}
+		fingerprint := key.GetFingerprint()
+		address, ok := addresses[server.instance]
+		if opts.offline || !ok {
+			checks = append(checks, checkResult(name, CheckOK, nil, fmt.Sprintf("%s: %s", server.name, fingerprint)))
+			continue
+		}
+
+		// 中心服务器上的公钥已更换时, 对方的新提交都会验签失败
+		remote, err := fetchServerKey(ctx, address, server.uuid)
+		if err != nil {
+			checks = append(checks, checkResult(name, CheckWarn, fmt.Errorf(T("%s: 无法从中心服务器获取公钥: %s"), server.name, err), ""))
+			continue
+		}
+		remoteFingerprint, err := keyFingerprint(remote)
+		if err == nil && remoteFingerprint != fingerprint {
+			err = fmt.Errorf(T("%s: 中心服务器上登记的公钥 %s 与本地保存的 %s 不一致"), server.name, remoteFingerprint, fingerprint)
+		}
+		if err != nil {
+			checks = append(checks, checkResult(name, CheckWarn, err, ""))
+			continue
+		}
+		checks = append(checks, checkResult(name, CheckOK, nil, fmt.Sprintf("%s: %s", server.name, fingerprint)))
+	}
+	return checks
+}
+
+// runDoctor 依次执行所有检查, 返回检查结果和对应的退出码
+func runDoctor(ctx context.Context, opts DoctorOptions) ([]Check, int) {
+	err := openDBReadOnly()
+	if err != nil {
+		return []Check{checkResult("database.open", CheckFail, err, "")}, ExitFailure
+	}
+	defer db.Close()
+	checks := []Check{checkIntegrity(), checkSchema()}
+	checks = append(checks, checkKeys()...)
+	checks = append(checks, checkInstances(ctx, opts)...)
+	checks = append(checks, checkServers(ctx, opts)...)
+
+	code := ExitOK
+	for _, c := range checks {
+		switch {
+		case c.Status == CheckFail:
+			code = ExitFailure
+		case c.Status == CheckWarn && code == ExitOK:
+			code = ExitWarning
+		}
+	}
+	return checks, code
+}
+
+// printChecks 输出检查结果, asJSON 为真时输出JSON
+func printChecks(checks []Check, code int, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(struct {
+			Status int     `json:"status"`
+			Checks []Check `json:"checks"`
+		}{code, checks}, "", "  ")
+		if err != nil {
+			return errors.New(T("序列化错误: ") + err.Error())
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	status := map[string]string{CheckOK: T("正常"), CheckWarn: T("警告"), CheckFail: T("失败")}
+	fmt.Println(T("检查项\t\t\t\t\t\t|状态\t|说明"))
+	for _, c := range checks {
+		fmt.Println(fmt.Sprintf("%-48s|%s\t|%s", c.Name, status[c.Status], c.Detail))
+	}
+	return nil
+}
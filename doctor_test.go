@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// doctorCase 一个 doctor 测试场景, setup 在健康的本地数据上制造问题
+type doctorCase struct {
+	name    string
+	offline bool
+	setup   func(t *testing.T, central *fakeCentral, server ServerList)
+	code    int
+	// status 应当出现的检查项及其状态
+	status map[string]string
+}
+
+func TestRunDoctor(t *testing.T) {
+	const trusted = "server.00000000-0000-4000-8000-000000000002"
+	tests := []doctorCase{
+		{name: "healthy", code: ExitOK, status: map[string]string{
+			"database.integrity": CheckOK, "database.schema": CheckOK, "key.private": CheckOK, "key.public": CheckOK, "key.files": CheckOK,
+			"instance." + defaultInstance: CheckOK, trusted: CheckOK,
+		}},
+		{name: "offline", offline: true, setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			central.Close()
+		}, code: ExitOK, status: map[string]string{"instance." + defaultInstance: CheckOK, trusted: CheckOK}},
+		{name: "missing key file", setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			if err := os.Remove("rsa-pub.pem"); err != nil {
+				t.Fatal(err)
+			}
+		}, code: ExitWarning, status: map[string]string{"key.files": CheckWarn, "key.public": CheckOK}},
+		{name: "trusted key changed", setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			_, pubkey := newTestKey(t)
+			central.mu.Lock()
+			defer central.mu.Unlock()
+			for i := range central.servers {
+				if central.servers[i].UUID == server.uuid {
+					central.servers[i].Public_key = pubkey
+				}
+			}
+		}, code: ExitWarning, status: map[string]string{trusted: CheckWarn, "instance." + defaultInstance: CheckOK}},
+		{name: "old schema", setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			if _, err := db.Exec("PRAGMA user_version = 1"); err != nil {
+				t.Fatal(err)
+			}
+		}, code: ExitFailure, status: map[string]string{"database.schema": CheckFail, "database.integrity": CheckOK}},
+		{name: "public key mismatch", setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			_, pubkey := newTestKey(t)
+			if _, err := db.Exec("UPDATE Config SET public_key = ?", pubkey); err != nil {
+				t.Fatal(err)
+			}
+		}, code: ExitFailure, status: map[string]string{"key.private": CheckOK, "key.public": CheckFail, "key.files": CheckWarn}},
+		{name: "registered key differs", setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			_, pubkey := newTestKey(t)
+			central.mu.Lock()
+			defer central.mu.Unlock()
+			central.servers[0].Public_key = pubkey
+		}, code: ExitFailure, status: map[string]string{"instance." + defaultInstance: CheckFail}},
+		{name: "central server unreachable", setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			central.Close()
+		}, code: ExitFailure, status: map[string]string{"instance." + defaultInstance: CheckFail, trusted: CheckWarn}},
+		{name: "not registered", setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			if _, err := db.Exec("DELETE FROM Instance"); err != nil {
+				t.Fatal(err)
+			}
+		}, code: ExitFailure, status: map[string]string{"registration": CheckFail, trusted: CheckOK}},
+		{name: "missing database", setup: func(t *testing.T, central *fakeCentral, server ServerList) {
+			SqlPath = filepath.Join(t.TempDir(), "missing.db")
+		}, code: ExitFailure, status: map[string]string{"database.open": CheckFail}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestDB(t)
+			central := newTestCentral(t)
+			central.register(testLocalUUID, "local", testLocalKey.public)
+			_, server := addTestServer(t, central, 2)
+			central.register(server.uuid, server.name, server.pubkey)
+			if tt.setup != nil {
+				tt.setup(t, central, server)
+			}
+			// runDoctor 以只读方式重新打开数据库
+			db.Close()
+			checks, code := runDoctor(context.Background(), DoctorOptions{offline: tt.offline})
+			status := make(map[string]string)
+			for _, c := range checks {
+				status[c.Name] = c.Status
+			}
+			if code != tt.code {
+				t.Errorf("runDoctor() = %d, want %d: %+v", code, tt.code, checks)
+			}
+			for name, want := range tt.status {
+				if status[name] != want {
+					t.Errorf("check %s = %q, want %q: %+v", name, status[name], want, checks)
+				}
+			}
+		})
+	}
+}
+
+func TestRunDoctorReadOnly(t *testing.T) {
+	newTestDB(t)
+	info, err := os.Stat(SqlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	runDoctor(context.Background(), DoctorOptions{offline: true})
+	// 不会修改数据库文件, 也不会执行迁移
+	after, err := os.Stat(SqlPath)
+	if err != nil || !after.ModTime().Equal(info.ModTime()) || after.Size() != info.Size() {
+		t.Errorf("database changed by doctor: %v -> %v, %v", info.ModTime(), after, err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 提交列表的排序方式
+const (
+	SortTime   = "time"
+	SortPoint  = "point"
+	SortPlayer = "player"
+)
+
+// SubmissionFilter 查询本地提交的条件, 零值表示不限制
+type SubmissionFilter struct {
+	uuid   string
+	player string
+	// since, until 签名时间的范围(包含), 为0时不限制; 升级前没有签名时间的提交不会被选中
+	since int64
+	until int64
+	// pointLt, pointGt 评分严格小于/大于该值
+	pointLt *float64
+	pointGt *float64
+	// comment 理由中包含的文本, 不区分大小写
+	comment  string
+	operator string
+	// sort 排序方式, 默认按签名时间
+	sort string
+	desc bool
+	// limit 最多返回的条数, 为0时不限制
+	limit  int
+	offset int
+}
+
+// parseTime 解析时间点, 支持 2006-01-02, 2006-01-02 15:04:05, RFC3339,
+// 以及 7d, 12h 这样表示若干时间之前的时长
+func parseTime(value string, now time.Time) (int64, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil && days >= 0 {
+			return now.AddDate(0, 0, -days).Unix(), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+		return now.Add(-duration).Unix(), nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix(), nil
+	}
+	return 0, errors.New(T("无法识别的时间: ") + value)
+}
+
+// parseUntil 解析作为上限的时间点, 只有日期时表示当天结束, 即次日零点前一秒
+func parseUntil(value string, now time.Time) (int64, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t.AddDate(0, 0, 1).Unix() - 1, nil
+	}
+	return parseTime(value, now)
+}
+
+// where 生成对应的SQL条件和参数
+func (f SubmissionFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if f.uuid != "" {
+		conditions = append(conditions, "uuid = ?")
+		args = append(args, f.uuid)
+	}
+	if f.player != "" {
+		conditions = append(conditions, "player_uuid = ?")
+		args = append(args, f.player)
+	}
+	if f.since != 0 {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, f.since)
+	}
+	if f.until != 0 {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, f.until)
+	}
+	if f.pointLt != nil {
+		conditions = append(conditions, "point < ?")
+		args = append(args, *f.pointLt)
+	}
+	if f.pointGt != nil {
+		conditions = append(conditions, "point > ?")
+		args = append(args, *f.pointGt)
+	}
+	if f.comment != "" {
+		conditions = append(conditions, "instr(lower(comment), lower(?)) > 0")
+		args = append(args, f.comment)
+	}
+	if f.operator != "" {
+		conditions = append(conditions, "operator = ?")
+		args = append(args, f.operator)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// orderBy 生成对应的SQL排序和分页
+func (f SubmissionFilter) orderBy() (string, error) {
+	var column string
+	switch f.sort {
+	case "", SortTime:
+		column = "IFNULL(timestamp, 0)"
+	case SortPoint:
+		column = "point"
+	case SortPlayer:
+		column = "player_uuid"
+	default:
+		return "", fmt.Errorf(T("未知的排序方式: %s (可选 %s, %s, %s)"), f.sort, SortTime, SortPoint, SortPlayer)
+	}
+	direction := "ASC"
+	if f.desc {
+		direction = "DESC"
+	}
+	clause := fmt.Sprintf(" ORDER BY %s %s, rowid %s", column, direction, direction)
+	if f.limit < 0 || f.offset < 0 {
+		return "", errors.New(T("limit 和 offset 不能为负数"))
+	}
+	if f.limit > 0 {
+		clause += fmt.Sprintf(" LIMIT %d OFFSET %d", f.limit, f.offset)
+	} else if f.offset > 0 {
+		clause += fmt.Sprintf(" LIMIT -1 OFFSET %d", f.offset)
+	}
+	return clause, nil
+}
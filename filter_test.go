@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSubmissionFilterWhere(t *testing.T) {
+	lt, gt := -0.5, 0.0
+	tests := []struct {
+		name   string
+		filter SubmissionFilter
+		want   string
+		args   []interface{}
+	}{
+		{name: "empty", filter: SubmissionFilter{}, want: "", args: nil},
+		{
+			name:   "player",
+			filter: SubmissionFilter{player: "2b0d7f3e-8c4a-4f19-a6e2-5d9c1b7e3f80"},
+			want:   " WHERE player_uuid = ?",
+			args:   []interface{}{"2b0d7f3e-8c4a-4f19-a6e2-5d9c1b7e3f80"},
+		},
+		{
+			name:   "time range",
+			filter: SubmissionFilter{since: 100, until: 200},
+			want:   " WHERE timestamp >= ? AND timestamp <= ?",
+			args:   []interface{}{int64(100), int64(200)},
+		},
+		{
+			name:   "zero point bound is kept",
+			filter: SubmissionFilter{pointLt: &lt, pointGt: &gt},
+			want:   " WHERE point < ? AND point > ?",
+			args:   []interface{}{-0.5, 0.0},
+		},
+		{
+			name:   "comment and operator",
+			filter: SubmissionFilter{comment: "Grief", operator: "alice"},
+			want:   " WHERE instr(lower(comment), lower(?)) > 0 AND operator = ?",
+			args:   []interface{}{"Grief", "alice"},
+		},
+		{
+			name:   "sort and limit do not add conditions",
+			filter: SubmissionFilter{player: "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", sort: SortPoint, desc: true, limit: 10, offset: 5},
+			want:   " WHERE player_uuid = ?",
+			args:   []interface{}{"6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, args := tt.filter.where()
+			if got != tt.want {
+				t.Errorf("where() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("where() args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2021, 8, 10, 12, 0, 0, 0, time.Local)
+	day := func(d, h, m, s int) int64 { return time.Date(2021, 8, d, h, m, s, 0, time.Local).Unix() }
+	tests := []struct {
+		value   string
+		since   int64
+		until   int64
+		wantErr bool
+	}{
+		{value: "7d", since: day(3, 12, 0, 0), until: day(3, 12, 0, 0)},
+		{value: "0d", since: now.Unix(), until: now.Unix()},
+		{value: "12h", since: day(10, 0, 0, 0), until: day(10, 0, 0, 0)},
+		{value: "90m", since: day(10, 10, 30, 0), until: day(10, 10, 30, 0)},
+		// 只有日期时, 作为上限表示当天结束
+		{value: "2021-08-01", since: day(1, 0, 0, 0), until: day(1, 23, 59, 59)},
+		{value: "2021-08-01 15:04:05", since: day(1, 15, 4, 5), until: day(1, 15, 4, 5)},
+		{value: "2021-08-01T00:00:00Z", since: 1627776000, until: 1627776000},
+		{value: "-1d", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "yesterday", wantErr: true},
+		{value: "2021-13-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		since, err := parseTime(tt.value, now)
+		if (err != nil) != tt.wantErr || since != tt.since {
+			t.Errorf("parseTime(%q) = %d, %v, want %d", tt.value, since, err, tt.since)
+		}
+		until, err := parseUntil(tt.value, now)
+		if (err != nil) != tt.wantErr || until != tt.until {
+			t.Errorf("parseUntil(%q) = %d, %v, want %d", tt.value, until, err, tt.until)
+		}
+	}
+}
+
+func TestSubmissionFilterOrderBy(t *testing.T) {
+	tests := []struct {
+		filter  SubmissionFilter
+		want    string
+		wantErr bool
+	}{
+		{filter: SubmissionFilter{}, want: " ORDER BY IFNULL(timestamp, 0) ASC, rowid ASC"},
+		{filter: SubmissionFilter{sort: SortPoint, desc: true}, want: " ORDER BY point DESC, rowid DESC"},
+		{filter: SubmissionFilter{sort: SortPlayer, limit: 10, offset: 20}, want: " ORDER BY player_uuid ASC, rowid ASC LIMIT 10 OFFSET 20"},
+		{filter: SubmissionFilter{offset: 5}, want: " ORDER BY IFNULL(timestamp, 0) ASC, rowid ASC LIMIT -1 OFFSET 5"},
+		{filter: SubmissionFilter{sort: "comment"}, wantErr: true},
+		{filter: SubmissionFilter{limit: -1}, wantErr: true},
+		{filter: SubmissionFilter{offset: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.filter.orderBy()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("orderBy(%+v) = %q, %v, want %q", tt.filter, got, err, tt.want)
+		}
+	}
+}
+
+func TestQuerySubmissions(t *testing.T) {
+	newTestDB(t)
+	const (
+		alex  = "00000000-0000-4000-8000-00000000000a"
+		steve = "00000000-0000-4000-8000-00000000000b"
+	)
+	at := func(d, h, m, s int) int64 { return time.Date(2021, 8, d, h, m, s, 0, time.Local).Unix() }
+	for i, s := range []SubList{
+		{player_uuid: steve, point: -1, comment: "Griefing spawn", operator: "alice", timestamp: at(1, 10, 0, 0)},
+		{player_uuid: alex, point: 0.5, comment: "helpful", operator: "bob", timestamp: at(1, 23, 59, 59)},
+		{player_uuid: steve, point: -0.5, comment: "griefing again", operator: "bob", timestamp: at(2, 0, 0, 0)},
+		{player_uuid: alex, point: -0.3, comment: "spam", operator: "alice", timestamp: at(3, 8, 0, 0)},
+	} {
+		s.uuid = fmt.Sprintf("11111111-0000-4000-8000-%012d", i+1)
+		s.nonce = s.uuid
+		s.instance = defaultInstance
+		err := insertSubmission(db, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	until, err := parseUntil("2021-08-01", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lt, gt := 0.0, -0.6
+	tests := []struct {
+		name   string
+		filter SubmissionFilter
+		want   []int
+	}{
+		{name: "all", filter: SubmissionFilter{}, want: []int{1, 2, 3, 4}},
+		{name: "uuid", filter: SubmissionFilter{uuid: "11111111-0000-4000-8000-000000000003"}, want: []int{3}},
+		{name: "player", filter: SubmissionFilter{player: steve}, want: []int{1, 3}},
+		{name: "until a date includes the whole day", filter: SubmissionFilter{until: until}, want: []int{1, 2}},
+		{name: "since", filter: SubmissionFilter{since: at(2, 0, 0, 0)}, want: []int{3, 4}},
+		{name: "point range", filter: SubmissionFilter{pointLt: &lt, pointGt: &gt}, want: []int{3, 4}},
+		{name: "comment is case-insensitive", filter: SubmissionFilter{comment: "GRIEF"}, want: []int{1, 3}},
+		{name: "operator", filter: SubmissionFilter{operator: "bob"}, want: []int{2, 3}},
+		{name: "combined", filter: SubmissionFilter{player: alex, operator: "alice"}, want: []int{4}},
+		{name: "sort by point", filter: SubmissionFilter{sort: SortPoint}, want: []int{1, 3, 4, 2}},
+		{name: "sort by player, descending", filter: SubmissionFilter{sort: SortPlayer, desc: true}, want: []int{3, 1, 4, 2}},
+		{name: "page", filter: SubmissionFilter{desc: true, limit: 2, offset: 1}, want: []int{3, 2}},
+		{name: "offset only", filter: SubmissionFilter{offset: 3}, want: []int{4}},
+		{name: "no match", filter: SubmissionFilter{player: alex, comment: "grief"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := querySubmissions(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, s := range list {
+				var n int
+				fmt.Sscanf(s.uuid[24:], "%d", &n)
+				got = append(got, n)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("querySubmissions() = %v, want %v", got, tt.want)
+			}
+			// 统计不受排序和分页的影响
+			tt.filter.sort, tt.filter.desc, tt.filter.limit, tt.filter.offset = "", false, 0, 0
+			all, err := querySubmissions(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count, err := countSubmissions(tt.filter)
+			if err != nil || count != len(all) {
+				t.Errorf("countSubmissions() = %d, %v, want %d", count, err, len(all))
+			}
+		})
+	}
+}
@@ -1,17 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"os"
+	"os/user"
 
-	"log"
-	"net/http"
-	"regexp"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
@@ -29,7 +29,7 @@ func register(server_name, server_address string) (string, error) {
 	var pubkey string
 	err = db.QueryRow("SELECT public_key FROM Config").Scan(&pubkey)
 	if err != nil {
-		return "", errors.New("无法读取本地私钥: " + err.Error())
+		return "", errors.New(T("无法读取本地私钥: ") + err.Error())
 	}
 
 	register["message"] = message
@@ -46,29 +46,51 @@ func register(server_name, server_address string) (string, error) {
 
 	err = json.Unmarshal(req, &data)
 	if err != nil {
-		return "", errors.New("序列化错误: " + err.Error())
+		return "", errors.New(T("序列化错误: ") + err.Error())
 	}
 	if data.Status == "NG" {
-		return "", errors.New("中心服务器返回异常: " + data.Reason)
+		return "", errors.New(T("中心服务器返回异常: ") + data.Reason)
 	}
 
 	// 返回得到的uuid
 	return data.UUID, nil
 }
 
-// newSubmit 在中心服务器上提交新玩家数据
-func newSubmit(player, comment string, point float64) (string, error) {
-	// 生成请求数据
-	message, err := SignatureData(fmt.Sprintf("uuid: %s\r\ntimestamp: %d\r\nplayer_uuid: %s\r\npoints: %.1f\r\ncomment: %s", uuid.Must(uuid.NewV4(), nil).String(), time.Now().Unix(), player, point, comment))
+// submitMessage 生成新提交的签名内容, 返回尚未提交的记录, 其中uuid和instance为空
+func submitMessage(player, comment string, point float64) (SubList, error) {
+	data := SubList{
+		player_uuid: player,
+		comment:     comment,
+		point:       point,
+		timestamp:   time.Now().Unix(),
+		nonce:       uuid.Must(uuid.NewV4(), nil).String(),
+		operator:    currentOperator(),
+	}
+	message, err := SignatureData(fmt.Sprintf("uuid: %s\r\ntimestamp: %d\r\nplayer_uuid: %s\r\npoints: %.1f\r\ncomment: %s", data.nonce, data.timestamp, player, point, comment))
 	if err != nil {
-		return "", err
+		return data, err
 	}
+	data.message = message
+	return data, nil
+}
 
-	var serverAddress string
-	err = db.QueryRow("SELECT server_Address FROM Config").Scan(&serverAddress)
-	if err != nil {
-		return "", errors.New("无法读取远程服务器地址: " + err.Error())
+// currentOperator 返回当前的操作者, 依次使用 operator 参数, 环境变量 OPENMPRDB_OPERATOR 和系统用户名
+func currentOperator() string {
+	if operatorName != "" {
+		return operatorName
 	}
+	if operator := os.Getenv("OPENMPRDB_OPERATOR"); operator != "" {
+		return operator
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// newSubmit 在中心服务器上提交新玩家数据
+func newSubmit(instance Instance, message string) (string, error) {
+	serverAddress := instance.server_address
 
 	// PUT请求: [API服务器地址]/v1/submit/new
 	req, err := httpRequest("PUT", "text/plain", serverAddress, "/v1/submit/new", bytes.NewBufferString(message))
@@ -81,28 +103,248 @@ func newSubmit(player, comment string, point float64) (string, error) {
 	// 序列化
 	err = json.Unmarshal(req, &data)
 	if err != nil {
-		return "", errors.New("序列化错误: " + err.Error())
+		return "", errors.New(T("序列化错误: ") + err.Error())
 	}
 	if data.Status == "NG" {
-		return "", errors.New("中心服务器返回异常: " + data.Reason)
+		return "", errors.New(T("中心服务器返回异常: ") + data.Reason)
 	}
 
 	return data.UUID, nil
 }
 
-// deleteSubmit 删除过去提交到服务器上的一条记录
-func deleteSubmit(uuid, comment string) error {
-	// 生成请求数据
-	message, err := SignatureData(fmt.Sprintf("timestamp: %d\r\ncomment: %s", time.Now().Unix(), comment))
+// submitToInstances 将一条新提交发往指定的各中心服务器, 并存入本地数据库
+//
+// 各中心服务器使用同一份签名内容; 部分中心服务器失败时, 成功的提交仍会被保存.
+func submitToInstances(names []string, player, comment string, point float64) error {
+	player, err := validateSubmission(player, point, comment)
+	if err != nil {
+		return err
+	}
+
+	var instances []Instance
+	for _, name := range names {
+		instance, err := getInstance(name)
+		if err != nil {
+			return err
+		}
+		instances = append(instances, instance)
+	}
+
+	data, err := submitMessage(player, comment, point)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, instance := range instances {
+		uuid, err := newSubmit(instance, data.message)
+		if err != nil {
+			logger.Error("向中心服务器提交失败", F("instance", instance.name), F("error", err))
+			failed = append(failed, instance.name)
+			continue
+		}
+
+		// 在数据库中存储提交数据
+		data.uuid = uuid
+		data.instance = instance.name
+		err = newSubmission(data)
+		if err != nil {
+			return err
+		}
+		logger.Info("玩家数据已提交到中心服务器", F("instance", instance.name), F("submission_uuid", uuid))
+		notify(EventSubmissionCreated, SubmissionEvent{UUID: uuid, Instance: instance.name, Player: player, Point: point, Comment: comment})
+		audit(AuditSubmissionNew, uuid, map[string]interface{}{"instance": instance.name, "player_uuid": player, "point": point, "comment": comment})
+	}
+	if len(failed) > 0 {
+		return errors.New(T("以下中心服务器提交失败: ") + strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// amendSubmission 修改一条本服务器的提交: 在中心服务器上撤回旧的提交, 再提交替代它的新提交
+//
+// point 和 comment 为nil时沿用旧提交的内容. 新提交在撤回之前签名, 签名失败不会影响旧提交;
+// 若新提交失败, 会以旧提交的内容重新签名并发布作为回滚, 本地记录改为重新发布后的uuid.
+func amendSubmission(uuid string, point *float64, comment *string, reason string) (SubList, error) {
+	list, err := querySubmissions(SubmissionFilter{uuid: uuid})
+	if err != nil {
+		return SubList{}, err
+	}
+	if len(list) == 0 {
+		return SubList{}, errors.New(T("本地数据库中没有该提交: ") + uuid)
+	}
+	old := list[0]
+	instance, err := getInstance(old.instance)
+	if err != nil {
+		return SubList{}, err
+	}
+
+	newPoint, newComment := old.point, old.comment
+	if point != nil {
+		newPoint = *point
+	}
+	if comment != nil {
+		newComment = *comment
+	}
+	if newPoint == old.point && newComment == old.comment {
+		return SubList{}, errors.New(T("新提交与原提交的内容相同"))
+	}
+	player, err := validateSubmission(old.player_uuid, newPoint, newComment)
+	if err != nil {
+		return SubList{}, err
+	}
+	data, err := submitMessage(player, newComment, newPoint)
+	if err != nil {
+		return SubList{}, err
+	}
+
+	// 第一步: 撤回旧的提交
+	err = deleteSubmit(instance, old.uuid, reason)
+	if err != nil {
+		return SubList{}, err
+	}
+	notify(EventSubmissionDeleted, SubmissionEvent{UUID: old.uuid, Instance: instance.name, Comment: reason})
+
+	// 第二步: 提交新的内容, 失败时重新发布旧提交
+	data.uuid, err = newSubmit(instance, data.message)
+	if err != nil {
+		restored, rollbackErr := restoreSubmission(instance, old)
+		if rollbackErr != nil && restored != "" {
+			// 已重新发布但无法更新本地记录, 错误中包含重新发布后的uuid
+			audit(AuditSubmissionRestore, restored, map[string]interface{}{"instance": instance.name, "revoked": old.uuid})
+			return SubList{}, fmt.Errorf(T("新提交失败: %s; %s"), err, rollbackErr)
+		}
+		if rollbackErr != nil {
+			// 旧提交已在中心服务器上撤回, 本地也不再保留
+			if err := deleteSubmission(old.uuid, reason); err != nil {
+				logger.Error("无法记录被撤回的提交", F("submission_uuid", old.uuid), F("error", err))
+			}
+			audit(AuditSubmissionDelete, old.uuid, map[string]interface{}{"instance": instance.name, "comment": reason})
+			return SubList{}, fmt.Errorf(T("新提交失败: %s; 恢复原提交也失败: %s, 原提交已被撤回"), err, rollbackErr)
+		}
+		audit(AuditSubmissionRestore, restored, map[string]interface{}{"instance": instance.name, "revoked": old.uuid})
+		return SubList{}, fmt.Errorf(T("新提交失败: %s; 已重新发布原提交, 新的操作uuid: %s"), err, restored)
+	}
+	data.instance = instance.name
+
+	err = replaceSubmission(old.uuid, reason, data)
+	if err != nil {
+		// 新提交已在中心服务器上生效, 需要告知其uuid以便手动处理
+		return SubList{}, fmt.Errorf(T("新提交 %s 已发布, 但无法写入本地数据库: %s"), data.uuid, err)
+	}
+	data.supersedes = old.uuid
+	notify(EventSubmissionCreated, SubmissionEvent{UUID: data.uuid, Instance: instance.name, Player: player, Point: newPoint, Comment: newComment})
+	audit(AuditSubmissionAmend, data.uuid, map[string]interface{}{"instance": instance.name, "supersedes": old.uuid, "player_uuid": player, "point": newPoint, "comment": newComment, "reason": reason})
+	return data, nil
+}
+
+// restoreSubmission 重新发布已撤回的提交, 返回新的操作uuid
+//
+// 原样发布旧的签名内容可能被中心服务器视为重放, 因此以相同的内容和新的时间戳, uuid重新签名.
+// 已发布但无法更新本地记录时, 同时返回新的uuid和错误.
+func restoreSubmission(instance Instance, old SubList) (string, error) {
+	data, err := submitMessage(old.player_uuid, old.comment, old.point)
+	if err != nil {
+		return "", err
+	}
+	data.uuid, err = newSubmit(instance, data.message)
+	if err != nil {
+		return "", err
+	}
+	err = updateRestoredSubmission(old.uuid, data)
+	if err != nil {
+		return data.uuid, fmt.Errorf(T("原提交已重新发布为 %s, 但无法写入本地数据库: %s"), data.uuid, err)
+	}
+	return data.uuid, nil
+}
+
+// revokeSubmission 在中心服务器上撤回一条提交, 并删除本地记录
+func revokeSubmission(instance Instance, uuid, comment string) error {
+	// 向中心服务器提交删除请求
+	err := deleteSubmit(instance, uuid, comment)
+	if err != nil {
+		return err
+	}
+
+	// 删除本地数据库中的记录
+	err = deleteSubmission(uuid, comment)
+	if err != nil {
+		return err
+	}
+	notify(EventSubmissionDeleted, SubmissionEvent{UUID: uuid, Instance: instance.name, Comment: comment})
+	audit(AuditSubmissionDelete, uuid, map[string]interface{}{"instance": instance.name, "comment": comment})
+	return nil
+}
+
+// revokeSubmissions 撤回所有符合条件的本地提交, 使用同一个撤回理由
+//
+// 撤回前会列出这些提交并要求确认, 之后逐条输出结果; 部分失败时其余的提交仍会被撤回.
+func revokeSubmissions(filter SubmissionFilter, comment string, yes bool) error {
+	if where, _ := filter.where(); where == "" {
+		return errors.New(T("请至少指定一个筛选条件"))
+	}
+	err := checkComment(comment)
+	if err != nil {
+		return err
+	}
+	list, err := querySubmissions(filter)
 	if err != nil {
 		return err
 	}
+	if len(list) == 0 {
+		return errors.New(T("没有符合条件的提交"))
+	}
+
+	// 预览
+	fmt.Println(T("\t\t操作uuid\t\t|\t\t玩家uuid\t\t|  评分\t|中心服务器\t|理由"))
+	for _, i := range list {
+		fmt.Println(fmt.Sprintf("%s\t|%s\t|   %.1f\t|%s\t|%s", i.uuid, i.player_uuid, i.point, i.instance, i.comment))
+	}
+	if !yes && !confirm(fmt.Sprintf(T("确认撤回以上 %d 条提交? 撤回理由: %s"), len(list), comment)) {
+		return errors.New(T("操作已取消"))
+	}
+
+	instances := make(map[string]Instance)
+	failed := 0
+	fmt.Println(T("\t\t操作uuid\t\t|结果"))
+	for _, i := range list {
+		err = nil
+		instance, ok := instances[i.instance]
+		if !ok {
+			instance, err = getInstance(i.instance)
+			if err == nil {
+				instances[i.instance] = instance
+			}
+		}
+		if err == nil {
+			err = revokeSubmission(instance, i.uuid, comment)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("%s\t|%s\n", i.uuid, T("失败: ")+err.Error())
+			continue
+		}
+		fmt.Printf("%s\t|%s\n", i.uuid, T("成功"))
+	}
+	if failed > 0 {
+		return fmt.Errorf(T("%d 条提交撤回失败, %d 条成功"), failed, len(list)-failed)
+	}
+	logger.Info("提交已全部撤回", F("count", len(list)))
+	return nil
+}
 
-	var serverAddress string
-	err = db.QueryRow("SELECT server_Address FROM Config").Scan(&serverAddress)
+// deleteSubmit 删除过去提交到服务器上的一条记录
+func deleteSubmit(instance Instance, uuid, comment string) error {
+	err := checkComment(comment)
 	if err != nil {
-		return errors.New("无法读取远程服务器地址: " + err.Error())
+		return err
+	}
+	// 生成请求数据
+	message, err := SignatureData(fmt.Sprintf("timestamp: %d\r\ncomment: %s", time.Now().Unix(), comment))
+	if err != nil {
+		return err
 	}
+	serverAddress := instance.server_address
 
 	// PUT请求: [API服务器地址]/v1/submit/uuid/<submit_uuid>
 	req, err := httpRequest("DELETE", "text/plain", serverAddress, "/v1/submit/uuid/"+uuid, bytes.NewBufferString(message))
@@ -118,35 +360,22 @@ func deleteSubmit(uuid, comment string) error {
 	// 序列化
 	err = json.Unmarshal(req, &data)
 	if err != nil {
-		return errors.New("序列化错误: " + err.Error())
+		return errors.New(T("序列化错误: ") + err.Error())
 	}
 	if data.Status == "NG" {
-		return errors.New("中心服务器返回异常: " + data.Reason)
+		return errors.New(T("中心服务器返回异常: ") + data.Reason)
 	}
 	return nil
 }
 
-// getServerData 获取指定服务器的数据
-func getServerData(uuid, pubkey string, level int, c chan SubList) {
-	var serverAddress string
-	err := db.QueryRow("SELECT server_Address FROM Config").Scan(&serverAddress)
-	if err != nil {
-		log.Panicln(errors.New("无法读取远程服务器地址: " + err.Error()))
-		return
-	}
+// getServerData 获取指定服务器的数据, 返回通过校验的提交以及被拒绝的提交
+//
+// serverAddress 为该服务器所在的中心服务器地址. 此函数不写入数据库, 被拒绝的提交由调用者记录.
+func getServerData(ctx context.Context, serverAddress string, server ServerList) ([]SubList, []Rejection, error) {
 	// GET请求: [API服务器地址]/v1/submit/server/<server_uuid>
-	resp, err := http.Get(serverAddress + "/v1/submit/server/" + uuid)
+	pageBytes, err := httpRequestContext(ctx, "GET", "application/json", serverAddress, "/v1/submit/server/"+server.uuid, nil)
 	if err != nil {
-		log.Panicf("发送请求错误: %s\n", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	// 读取返回值
-	pageBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Panicf("读取返回值错误: %s\n", err)
-		return
+		return nil, nil, err
 	}
 	type submits struct {
 		ID          int    `json:"id"`
@@ -164,137 +393,725 @@ func getServerData(uuid, pubkey string, level int, c chan SubList) {
 	// 序列化
 	err = json.Unmarshal(pageBytes, &Data)
 	if err != nil {
-		log.Panicf("序列化错误: %s\n", err)
-		return
+		return nil, nil, errors.New(T("序列化错误: ") + err.Error())
 	}
 	if Data.Status == "NG" {
-		log.Panicf("中心服务器返回异常: %s\n", Data.Reason)
-		return
+		return nil, nil, errors.New(T("中心服务器返回异常: ") + Data.Reason)
 	}
-	// log.Printf("正在加载服务器[%s]的数据\n", uuid)
+
+	var list []SubList
+	var rejected []Rejection
+	seen := make(map[string]bool)
 	for _, s := range Data.Submits {
-		// 对数据进行验签
-		verifiedPlainText, err := helper.VerifyCleartextMessageArmored(pubkey, s.Content, crypto.GetUnixTime())
+		// 验签并解析, 单条数据出错时跳过而不是中止整个更新
+		data, err := verifySubmission(server.pubkey, s.Content)
+		if err == nil && seen[data.uuid] {
+			err = errors.New(T("重复的提交uuid: ") + data.uuid)
+		}
 		if err != nil {
-			log.Panicf("消息验签失败: %s\n", err)
-			return
+			logger.Warn("已拒绝远程提交", F("server_uuid", server.uuid), F("submission_uuid", s.UUID), F("reason", err))
+			// 隔离该提交, 以便之后查看
+			rejected = append(rejected, Rejection{
+				server_uuid: server.uuid,
+				uuid:        s.UUID,
+				reason:      err.Error(),
+				content:     s.Content,
+				time:        time.Now().Unix(),
+			})
+			continue
 		}
-		// 提取数据
-		flysnowRegexp := regexp.MustCompile(`^uuid: (.{36})\ntimestamp: ([0-9]*)\nplayer_uuid: (.{36})\npoints: (.{1,4})\ncomment: (.*)$`)
-		params := flysnowRegexp.FindStringSubmatch(verifiedPlainText)
-		point, err := strconv.ParseFloat(params[4], 32)
+		seen[data.uuid] = true
+		data.level = server.weight
+		list = append(list, data)
+	}
+	logger.Debug("已获取服务器的数据", F("server_uuid", server.uuid), F("accepted", len(list)), F("rejected", len(rejected)))
+	return list, rejected, nil
+}
+
+// verifySubmission 对一条提交进行验签并解析其内容
+func verifySubmission(pubkey, content string) (SubList, error) {
+	verifiedPlainText, err := helper.VerifyCleartextMessageArmored(pubkey, content, crypto.GetUnixTime())
+	if err != nil {
+		metricVerifications.Add(1, "fail")
+		return SubList{}, errors.New(T("消息验签失败: ") + err.Error())
+	}
+	metricVerifications.Add(1, "ok")
+	payload, err := parsePayload(verifiedPlainText)
+	if err != nil {
+		return SubList{}, errors.New(T("内容解析失败: ") + err.Error())
+	}
+	if payload.point < -1 || payload.point > 1 {
+		return SubList{}, fmt.Errorf(T("评分超出范围: %g"), payload.point)
+	}
+	return SubList{
+		uuid:        payload.uuid,
+		player_uuid: payload.player_uuid,
+		comment:     payload.comment,
+		point:       payload.point,
+		timestamp:   payload.timestamp,
+	}, nil
+}
+
+// submissionList 按条件获取提交列表, verbose 为 true 时列出签名时间, 操作者和签名后的原始内容,
+// countOnly 为 true 时只输出符合条件的数量
+func submissionList(filter SubmissionFilter, verbose, countOnly bool) error {
+	if countOnly {
+		count, err := countSubmissions(filter)
 		if err != nil {
-			log.Panicf("无法获取评分: %s\n", err)
-			return
+			return err
 		}
-		// 存储数据
-		data := SubList{
-			uuid:        params[1],
-			player_uuid: params[3],
-			comment:     params[5],
-			point:       float64(point),
-			level:       level,
+		fmt.Println(count)
+		return nil
+	}
+	list, err := querySubmissions(filter)
+	if err != nil {
+		return err
+	}
+	if verbose {
+		for _, i := range list {
+			printSubmission(i)
 		}
-		c <- data
+		logger.Info("已到达最底端", F("count", len(list)))
+		return nil
+	}
+	fmt.Println(T("\t\t操作uuid\t\t|\t\t玩家uuid\t\t|  评分\t|中心服务器\t|理由"))
+	for _, i := range list {
+		fmt.Println(fmt.Sprintf("%s\t|%s\t|   %.1f\t|%s\t|%s", i.uuid, i.player_uuid, i.point, i.instance, i.comment))
 	}
-	// log.Printf("服务器[%s]的数据加载完成\n", uuid)
+	logger.Info("已到达最底端")
+	return nil
+}
 
-	close(c)
+// printSubmission 输出一条本服务器提交的全部信息
+func printSubmission(i SubList) {
+	unknown := T("未知")
+	timestamp, operator := unknown, unknown
+	if i.timestamp != 0 {
+		timestamp = time.Unix(i.timestamp, 0).Format("2006-01-02 15:04:05 -0700")
+	}
+	if i.operator != "" {
+		operator = i.operator
+	}
+	fmt.Printf(T("操作uuid: %s\n"), i.uuid)
+	fmt.Printf(T("玩家uuid: %s\n"), i.player_uuid)
+	fmt.Printf(T("评分: %.1f\n"), i.point)
+	fmt.Printf(T("理由: %s\n"), i.comment)
+	fmt.Printf(T("中心服务器: %s\n"), i.instance)
+	fmt.Printf(T("签名uuid: %s\n"), i.nonce)
+	fmt.Printf(T("签名时间: %s\n"), timestamp)
+	fmt.Printf(T("操作者: %s\n"), operator)
+	if i.supersedes != "" {
+		fmt.Printf(T("替代的提交: %s\n"), i.supersedes)
+	}
+	if i.message == "" {
+		fmt.Printf(T("签名内容: %s\n\n"), unknown)
+	} else {
+		fmt.Printf(T("签名内容:\n%s\n\n"), strings.TrimRight(i.message, "\n"))
+	}
+}
 
-	return
+// listRejections 列出被拒绝的远程提交
+func listRejections(server string) error {
+	list, err := rejectionList(server)
+	if err != nil {
+		return err
+	}
+	for _, i := range list {
+		fmt.Println("----------------------------------------")
+		fmt.Printf(T("服务器: %s[%s]\n"), i.server_name, i.server_uuid)
+		fmt.Printf(T("提交uuid: %s\n"), i.uuid)
+		fmt.Printf(T("时间: %s\n"), time.Unix(i.time, 0).Format("2006-01-02 15:04:05 -0700"))
+		fmt.Printf(T("原因: %s\n"), i.reason)
+		fmt.Printf(T("原始内容:\n%s\n"), i.content)
+	}
+	logger.Info("已到达最底端", F("count", len(list)))
+	return nil
 }
 
-// submissionList 获取提交列表
-func submissionList() error {
-	c := make(chan SubList)
-	fmt.Println("\t\t操作uuid\t\t|\t\t玩家uuid\t\t|  评分\t|理由")
-	go subList(c)
-	for i := range c {
-		fmt.Println(fmt.Sprintf("%s\t|%s\t|   %.1f\t|%s", i.uuid, i.player_uuid, i.point, i.comment))
+// listInstances 列出已注册的中心服务器
+func listInstances() error {
+	list, err := instanceList()
+	if err != nil {
+		return err
 	}
-	log.Println("已到达最底端")
+	fmt.Println(T("名称\t|\t\t本服务器uuid\t\t|本服务器名称\t|地址"))
+	for _, i := range list {
+		fmt.Println(fmt.Sprintf("%s\t|%s\t|%s\t|%s", i.name, i.uuid, i.server_name, i.server_address))
+	}
+	logger.Info("已到达最底端")
 	return nil
 }
 
-// trustServer 信任某个服务器
-func trustServer(uuid string, name string, pubkey_path string, level int) error {
+// checkLevel 检查信任等级是否在 1 ~ 5 之间
+func checkLevel(level int) error {
+	if level < 1 || level > 5 {
+		return fmt.Errorf(T("信任等级必须在 1 ~ 5 之间: %d"), level)
+	}
+	return nil
+}
+
+// trustServer 信任某个服务器, instance 为该服务器所在的中心服务器
+func trustServer(instance, uuid string, name string, pubkey_path string, level int) error {
+	err := checkLevel(level)
+	if err != nil {
+		return err
+	}
+	_, err = getInstance(instance)
+	if err != nil {
+		return err
+	}
+
+	// 读取本地公钥
+	pubkey, err := os.ReadFile(pubkey_path)
+	if err != nil {
+		return errors.New(T("读取指定公钥错误: ") + err.Error())
+	}
+	fingerprint, err := keyFingerprint(string(pubkey))
+	if err != nil {
+		return err
+	}
+
 	// 将信息存入数据库
-	err := insertServer(uuid, name, pubkey_path, level)
+	err = insertServer(uuid, name, string(pubkey), level, instance)
+	if err != nil {
+		return err
+	}
+	audit(AuditServerImport, uuid, map[string]interface{}{"instance": instance, "name": name, "level": level, "fingerprint": fingerprint})
+	return nil
+}
+
+// RemoteServer 中心服务器上登记的服务器
+type RemoteServer struct {
+	ID          int    `json:"id"`
+	UUID        string `json:"uuid"`
+	Server_name string `json:"server_name"`
+	Public_key  string `json:"public_key"`
+}
+
+// remoteServers 获取中心服务器上登记的所有服务器
+func remoteServers(instance Instance) ([]RemoteServer, error) {
+	// GET请求: [API服务器地址]/v1/server/list
+	req, err := httpRequest("GET", "application/json", instance.server_address, "/v1/server/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Status  string         `json:"status"`
+		Reason  string         `json:"reason"`
+		Servers []RemoteServer `json:"servers"`
+	}
+
+	// 序列化
+	err = json.Unmarshal(req, &data)
+	if err != nil {
+		return nil, errors.New(T("序列化错误: ") + err.Error())
+	}
+	if data.Status == "NG" {
+		return nil, errors.New(T("中心服务器返回异常: ") + data.Reason)
+	}
+	return data.Servers, nil
+}
+
+// fetchServerKey 从指定的中心服务器获取服务器的公钥
+func fetchServerKey(ctx context.Context, serverAddress, uuid string) (string, error) {
+	// GET请求: [API服务器地址]/v1/key/<server_uuid>
+	req, err := httpRequestContext(ctx, "GET", "text/plain", serverAddress, "/v1/key/"+uuid, nil)
+	if err != nil {
+		return "", err
+	}
+	// 出错时中心服务器返回JSON
+	var data struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(req, &data) == nil && data.Status == "NG" {
+		return "", errors.New(T("中心服务器返回异常: ") + data.Reason)
+	}
+	return string(req), nil
+}
+
+// discoverServers 列出中心服务器上登记的服务器
+func discoverServers(name string) error {
+	instance, err := getInstance(name)
+	if err != nil {
+		return err
+	}
+	list, err := remoteServers(instance)
+	if err != nil {
+		return err
+	}
+	fmt.Println(T("\t\t服务器uuid\t\t|\t\t公钥指纹\t\t\t|名称"))
+	for _, i := range list {
+		fingerprint, err := keyFingerprint(i.Public_key)
+		if err != nil {
+			fingerprint = T("无法解析公钥\t\t\t")
+		}
+		fmt.Println(fmt.Sprintf("%s\t|%s\t|%s", i.UUID, fingerprint, i.Server_name))
+	}
+	logger.Info("已到达最底端")
+	return nil
+}
+
+// trustRemoteServer 从中心服务器获取公钥并信任该服务器, yes为假时需要用户确认公钥指纹
+func trustRemoteServer(instanceName, uuid, name string, level int, yes bool) error {
+	err := checkLevel(level)
+	if err != nil {
+		return err
+	}
+	instance, err := getInstance(instanceName)
+	if err != nil {
+		return err
+	}
+
+	pubkey, err := fetchServerKey(context.Background(), instance.server_address, uuid)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := keyFingerprint(pubkey)
+	if err != nil {
+		return err
+	}
+
+	// 未指定名称时使用中心服务器上登记的名称
+	if name == "" {
+		list, err := remoteServers(instance)
+		if err != nil {
+			return err
+		}
+		for _, i := range list {
+			if i.UUID == uuid {
+				name = i.Server_name
+			}
+		}
+	}
+
+	fmt.Printf(T("中心服务器: %s\n服务器: %s[%s]\n公钥指纹: %s\n信任等级: %d\n"), instance.name, name, uuid, fingerprint, level)
+	if !yes && !confirm(T("确认信任该服务器?")) {
+		return errors.New(T("操作已取消"))
+	}
+	err = insertServer(uuid, name, pubkey, level, instance.name)
 	if err != nil {
 		return err
 	}
+	audit(AuditServerTrust, uuid, map[string]interface{}{"instance": instance.name, "name": name, "level": level, "fingerprint": fingerprint})
 	return nil
 }
 
+// confirm 向用户询问是否继续, 仅在输入y或yes时返回真
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// setServerLevel 修改服务器的信任等级
+func setServerLevel(uuid string, level int) error {
+	err := checkLevel(level)
+	if err != nil {
+		return err
+	}
+	return updateServer(uuid, "level", level)
+}
+
 // listServers 列出服务器列表(已信任)
 func listServers() error {
-	c := make(chan ServerList)
-	fmt.Println("\t\t服务器uuid\t\t|名称")
-	go serverList(c)
-	for i := range c {
-		fmt.Println(fmt.Sprintf("%s\t|%s", i.uuid, i.name))
+	list, err := serverList()
+	if err != nil {
+		return err
+	}
+	fmt.Println(T("\t\t服务器uuid\t\t|等级\t|状态\t|中心服务器\t|名称"))
+	for _, i := range list {
+		status := T("启用")
+		if i.disabled {
+			status = T("停用")
+		}
+		fmt.Println(fmt.Sprintf("%s\t|%d\t|%s\t|%s\t|%s", i.uuid, i.level, status, i.instance, i.name))
 	}
-	log.Println("已到达最底端")
+	logger.Info("已到达最底端")
 	return nil
 }
 
-// generateReport 生成信誉报告
-func generateReport() {
-	// 插入队列
-	c4 := make(chan SubList, 65536)
+// maxParallelFetch 同时获取数据的服务器数量上限
+const maxParallelFetch = 4
 
-	// 清空表Reputation
-	resetReputation()
+// 服务器数据获取失败时的处理方式
+const (
+	// OnErrorFail 中止整个更新
+	OnErrorFail = "fail"
+	// OnErrorSkip 跳过该服务器
+	OnErrorSkip = "skip"
+	// OnErrorUseCache 使用该服务器上次成功获取的数据
+	OnErrorUseCache = "use-cache"
+)
+
+// ServerResult 单个服务器的数据获取结果
+type ServerResult struct {
+	server   ServerList
+	accepted int
+	rejected int
+	err      error
+	// fetched 所用数据的获取时间, 使用缓存时早于本次更新
+	fetched int64
+	stale   bool
+	missing bool
+	// duration 获取数据所用的时间
+	duration time.Duration
+}
+
+// ReportOptions 生成信誉报告的参数
+type ReportOptions struct {
+	// onError 某个服务器获取失败时的处理方式, 取值为 OnErrorFail, OnErrorSkip 或 OnErrorUseCache
+	onError string
+	// trustDepth 信任的最大深度, 1 表示只使用直接信任的服务器
+	trustDepth int
+	// attenuation 每经过一层间接信任时权重的衰减系数
+	attenuation float64
+}
+
+// generateReport 生成信誉报告, 返回每个服务器的获取结果和所用的输入
+//
+// onError 为 OnErrorFail 时任一服务器获取失败都会取消其余的请求, 并保留原有的Reputation表.
+func generateReport(ctx context.Context, opts ReportOptions) ([]ServerResult, ReportInputs, error) {
+	onError := opts.onError
+	err := checkOnError(onError)
+	if err != nil {
+		return nil, ReportInputs{}, err
+	}
+	if opts.trustDepth < 1 {
+		return nil, ReportInputs{}, fmt.Errorf(T("信任深度必须大于等于 1: %d"), opts.trustDepth)
+	}
+	if opts.attenuation < 0 || opts.attenuation > 1 {
+		return nil, ReportInputs{}, fmt.Errorf(T("衰减系数必须在 0 ~ 1 之间: %g"), opts.attenuation)
+	}
+
+	// 读取表Submission, 发往多个中心服务器的同一提交只计算一次
+	all_local, err := subList()
+	if err != nil {
+		return nil, ReportInputs{}, err
+	}
+	var local []SubList
+	counted := make(map[string]bool)
+	for _, sub := range all_local {
+		if !counted[sub.nonce] {
+			counted[sub.nonce] = true
+			local = append(local, sub)
+		}
+	}
 
-	// 开始生成数据
+	// 读取表Server, 跳过已停用的服务器
+	all, err := serverList()
+	if err != nil {
+		return nil, ReportInputs{}, err
+	}
+	var servers []ServerList
+	for _, sl := range all {
+		if !sl.disabled {
+			servers = append(servers, sl)
+		}
+	}
 
-	// 读取表Submission
-	c1 := make(chan SubList, 2048)
-	go subList(c1)
-	// 插入数据
-	for i := range c1 {
-		bar.ChangeMax(bar.GetMax() + 1)
-		c4 <- i
+	// 各中心服务器的地址
+	instances, err := instanceList()
+	if err != nil {
+		return nil, ReportInputs{}, err
+	}
+	addresses := make(map[string]string)
+	for _, instance := range instances {
+		addresses[instance.name] = instance.server_address
 	}
 
-	//读取表Serves
-	c2 := make(chan ServerList)
-	go serverList(c2)
-	var server []ServerList
-	for a := range c2 {
-		server = append(server, a)
+	// 加入间接信任的服务器
+	if opts.trustDepth > 1 {
+		extra, err := expandTrust(ctx, addresses, servers, opts.trustDepth, opts.attenuation)
+		if err != nil {
+			return nil, ReportInputs{}, err
+		}
+		servers = append(servers, extra...)
 	}
 
-	miao := 0
+	// 并发获取各服务器的数据, 同时进行的请求数不超过maxParallelFetch
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]ServerResult, len(servers))
+	remote := make([][]SubList, len(servers))
+	rejections := make([][]Rejection, len(servers))
+	sem := make(chan struct{}, maxParallelFetch)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i, sl := range servers {
+		results[i].server = sl
+		wg.Add(1)
+		go func(i int, sl ServerList) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-fetchCtx.Done():
+				results[i].err = fetchCtx.Err()
+				return
+			}
+			start := time.Now()
+			now := start.Unix()
+			var list []SubList
+			var rejected []Rejection
+			var err error
+			serverAddress, ok := addresses[sl.instance]
+			if ok {
+				list, rejected, err = getServerData(fetchCtx, serverAddress, sl)
+			} else {
+				err = fmt.Errorf(T("尚未在中心服务器 %s 上注册"), sl.instance)
+			}
+			results[i].duration = time.Since(start)
+			results[i].rejected = len(rejected)
+			rejections[i] = rejected
+			if err == nil {
+				remote[i] = list
+				results[i].accepted = len(list)
+				results[i].fetched = now
+				return
+			}
+
+			results[i].err = err
+			switch onError {
+			case OnErrorFail:
+				// 记录第一个出错的服务器, 并取消其余的请求
+				once.Do(func() {
+					firstErr = fmt.Errorf(T("获取服务器[%s]的数据失败: %s"), sl.uuid, err)
+				})
+				cancel()
+			case OnErrorSkip:
+				results[i].missing = true
+			case OnErrorUseCache:
+				list, fetched, err := cachedServerData(sl.uuid)
+				if err != nil || fetched == 0 {
+					results[i].missing = true
+					return
+				}
+				for j := range list {
+					list[j].level = sl.weight
+				}
+				remote[i] = list
+				results[i].accepted = len(list)
+				results[i].fetched = fetched
+				results[i].stale = true
+			}
+		}(i, sl)
+	}
+	wg.Wait()
 
-	for _, sl := range server {
-		miao++
-		c3 := make(chan SubList)
-		// 获取服务器数据
-		go getServerData(sl.uuid, sl.pubkey, sl.level, c3)
-		// 加入队列
-		go func() {
-			for b := range c3 {
-				bar.ChangeMax(bar.GetMax() + 1)
-				c4 <- b
+	// 所有请求结束后再写入数据库, 在同一事务中完成, 出错时保留原有的数据
+	// 多个goroutine同时写入共享缓存的连接时可能出现 "database table is locked"
+	tx, err := db.Begin()
+	if err != nil {
+		return results, ReportInputs{}, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer tx.Rollback()
+	for i, r := range results {
+		for _, rejection := range rejections[i] {
+			err = insertRejection(tx, rejection)
+			if err != nil {
+				return results, ReportInputs{}, err
 			}
-			miao--
-			if miao == 0 {
-				close(c4)
+		}
+		if r.err == nil {
+			err = cacheServerData(tx, r.server.uuid, remote[i], r.fetched)
+			if err != nil {
+				return results, ReportInputs{}, err
 			}
-		}()
+		}
 	}
 
-	// 写入数据
-	for b := range c4 {
-		addReputation(b)
+	// 被外部取消, 例如Ctrl-C; 已获取的数据仍会写入缓存
+	if ctx.Err() != nil || firstErr != nil {
+		err = tx.Commit()
+		if err != nil {
+			return results, ReportInputs{}, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		if ctx.Err() != nil {
+			return results, ReportInputs{}, errors.New(T("操作已取消: ") + ctx.Err().Error())
+		}
+		return results, ReportInputs{}, firstErr
+	}
+
+	// 记录所用的输入, 缺失数据的服务器不计入
+	inputs := ReportInputs{
+		Params: ReportParams{TrustDepth: opts.trustDepth, Attenuation: opts.attenuation, OnError: onError},
+	}
+	for _, r := range results {
+		if r.err != nil && !r.stale {
+			continue
+		}
+		fingerprint := r.server.fingerprint
+		if fingerprint == "" {
+			fingerprint, err = keyFingerprint(r.server.pubkey)
+			if err != nil {
+				return results, ReportInputs{}, err
+			}
+		}
+		inputs.Servers = append(inputs.Servers, ReportServer{UUID: r.server.uuid, Fingerprint: fingerprint, Weight: r.server.weight})
+	}
+
+	// 同一服务器的同一提交可能经由多个中心服务器获取, 按(服务器uuid, 提交uuid)只计算一次, 取最高的权重
+	seen := make(map[string]int)
+	for i, list := range remote {
+		for _, sub := range list {
+			key := results[i].server.uuid + " " + sub.uuid
+			if j, ok := seen[key]; ok {
+				if sub.level > local[j].level {
+					local[j].level = sub.level
+				}
+				continue
+			}
+			seen[key] = len(local)
+			local = append(local, sub)
+		}
+	}
+	for _, sub := range local {
+		inputs.Submissions = append(inputs.Submissions, sub.uuid)
+	}
+	bar.ChangeMax(len(local))
+	err = resetReputation(tx)
+	if err != nil {
+		return results, ReportInputs{}, err
+	}
+	for _, b := range local {
+		err = addReputation(tx, b)
+		if err != nil {
+			return results, ReportInputs{}, err
+		}
 		bar.Add(1)
 	}
-	bar.Add(1)
+	err = tx.Commit()
+	if err != nil {
+		return results, ReportInputs{}, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	bar.Finish()
+	return results, inputs, nil
+}
+
+// UpdateOptions update的参数
+type UpdateOptions struct {
+	report ReportOptions
+	// export 导出封禁列表的路径, 为空时不导出
+	export string
+	// threshold 封禁的阈值, 为空时列出所有玩家
+	threshold *float64
+	// metricsFile 写入指标的路径, 为空时不写入
+	metricsFile string
+	// rcon 推送新封禁和解除封禁的玩家的参数
+	rcon RconOptions
+}
+
+// runUpdate 生成信誉报告, 输出并导出封禁列表, 保存快照, 发送通知并推送到游戏服务器
+func runUpdate(ctx context.Context, opts UpdateOptions) error {
+	start := time.Now()
+	// 生成数据
+	results, inputs, err := generateReport(ctx, opts.report)
+	printServerResults(results)
+	recordServerResults(results)
+	if err != nil {
+		return err
+	}
+
+	// 输出一下, 并应用本地名单
+	list, err := reportList()
+	if err != nil {
+		return err
+	}
+	list, overrides, err := applyOverrides(list)
+	if err != nil {
+		return err
+	}
+	var banned []ReportList
+	fmt.Println(T("\t\t玩家uuid\t\t|评分"))
+	for _, i := range list {
+		if !i.banned(opts.threshold) {
+			continue
+		}
+		banned = append(banned, i)
+		switch i.override {
+		case OverrideDeny:
+			fmt.Println(fmt.Sprintf(T("%s\t|%.1f\t(强制封禁)"), i.player_uuid, i.point))
+		default:
+			fmt.Println(fmt.Sprintf("%s\t|%.1f", i.player_uuid, i.point))
+		}
+	}
+	if opts.export != "" {
+		err = exportBanList(opts.export, banned, overrides)
+		if err != nil {
+			return err
+		}
+	}
+	logger.Info("已到达最底端")
+
+	// 保存快照, 用于之后比较
+	inputs.Params.Threshold = opts.threshold
+	for _, o := range overrides {
+		inputs.Overrides = append(inputs.Overrides, o.player_uuid+" "+o.kind)
+	}
+	diff, err := saveReport(opts.threshold, list, inputs)
+	if err != nil {
+		return err
+	}
+	notifyReport(diff, results)
+	if list := incompleteServers(results); len(list) > 0 {
+		logger.Warn("本报告不完整, 以下服务器的数据已过期或缺失", F("servers", strings.Join(list, ", ")))
+	}
+
+	recordReport(start, len(list), len(banned))
+	if opts.metricsFile != "" {
+		err = writeMetricsFile(opts.metricsFile)
+		if err != nil {
+			return err
+		}
+	}
+	return pushReport(opts.rcon, diff)
+}
+
+// printServerResults 输出各服务器的数据获取结果
+func printServerResults(results []ServerResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Println(T("\t\t服务器uuid\t\t|名称\t|权重\t|接受\t|拒绝\t|状态"))
+	for _, r := range results {
+		name := r.server.name
+		if r.server.via != "" {
+			name = T("经由 ") + r.server.via
+		}
+		status := T("成功")
+		switch {
+		case r.stale:
+			status = fmt.Sprintf(T("已过期, 使用 %s 的缓存 (%s)"), time.Unix(r.fetched, 0).Format("2006-01-02 15:04:05"), r.err)
+		case r.missing:
+			status = T("缺失: ") + r.err.Error()
+		case r.err != nil:
+			status = T("失败: ") + r.err.Error()
+		}
+		fmt.Printf("%s\t|%s\t|%.2f\t|%d\t|%d\t|%s\n", r.server.uuid, name, r.server.weight, r.accepted, r.rejected, status)
+	}
+}
+
+// incompleteServers 返回数据已过期或缺失的服务器说明, 报告完整时返回空
+func incompleteServers(results []ServerResult) []string {
+	var list []string
+	for _, r := range results {
+		switch {
+		case r.stale:
+			list = append(list, fmt.Sprintf(T("%s[%s](已过期)"), r.server.name, r.server.uuid))
+		case r.missing:
+			list = append(list, fmt.Sprintf(T("%s[%s](缺失)"), r.server.name, r.server.uuid))
+		}
+	}
+	return list
 }
 
 // 导出banlist到指定文件
-func exportBanList(path string, ch chan string) {
+//
+// 强制封禁的玩家使用本地名单中的备注和过期时间.
+func exportBanList(path string, list []ReportList, overrides map[string]Override) error {
 	type ban struct {
 		UUID    string `json:"uuid"`
 		Created string `json:"created"`
@@ -302,28 +1119,33 @@ func exportBanList(path string, ch chan string) {
 		Expires string `json:"expires"`
 		Reason  string `json:"reason"`
 	}
-	var banList []ban
-	// 这里接收要写入的数据
-	for uuid := range ch {
+	banList := []ban{}
+	for _, i := range list {
 		miao := ban{
-			UUID:    uuid,
+			UUID:    i.player_uuid,
 			Created: time.Now().Format("2006-01-02 15:04:05 -0700"),
 			Source:  "OpenMPRDB-CLI",
 			Expires: "forever",
 			Reason:  "OpenMPRDB-CLI Ban",
 		}
+		if o, ok := overrides[i.player_uuid]; ok && o.kind == OverrideDeny {
+			if o.expires != 0 {
+				miao.Expires = time.Unix(o.expires, 0).Format("2006-01-02 15:04:05 -0700")
+			}
+			if o.note != "" {
+				miao.Reason = o.note
+			}
+		}
 		banList = append(banList, miao)
 	}
 	// 写入文件
 	data, err := json.Marshal(banList)
 	if err != nil {
-		log.Panicf("反序列化错误: %s\n", err)
-		return
+		return errors.New(T("序列化错误: ") + err.Error())
 	}
 	err = os.WriteFile(path, data, 0644)
 	if err != nil {
-		log.Panicf("文件写入错误: %s\n", err)
-		return
+		return errors.New(T("文件写入错误: ") + err.Error())
 	}
-	return
+	return nil
 }
@@ -0,0 +1,821 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+)
+
+// fakeSubmit 中心服务器上的一条提交
+type fakeSubmit struct {
+	ID         int    `json:"id"`
+	UUID       string `json:"uuid"`
+	ServerUUID string `json:"server_uuid"`
+	Content    string `json:"content"`
+}
+
+// fakeCentral 模拟中心服务器的HTTP接口
+type fakeCentral struct {
+	*httptest.Server
+	mu      sync.Mutex
+	servers []RemoteServer
+	submits []fakeSubmit
+	// failing 获取这些服务器的提交时返回错误
+	failing map[string]bool
+	// blocking 获取这些服务器的提交时一直等到请求被取消
+	blocking map[string]bool
+	// statements 各服务器的信任声明, 地址为 /trust/<服务器uuid>
+	statements map[string]string
+	// rejectNew 之后的这么多次新提交会返回错误
+	rejectNew int
+	// deleted 被撤回的提交的uuid
+	deleted []string
+}
+
+// testLocalUUID 本服务器在模拟的中心服务器上的uuid
+const testLocalUUID = "00000000-0000-4000-8000-000000000001"
+
+// newFakeCentral 启动一个模拟的中心服务器, 测试结束后关闭
+func newFakeCentral(t *testing.T) *fakeCentral {
+	t.Helper()
+	c := &fakeCentral{failing: make(map[string]bool), blocking: make(map[string]bool), statements: make(map[string]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/submit/server/", func(w http.ResponseWriter, r *http.Request) {
+		server := strings.TrimPrefix(r.URL.Path, "/v1/submit/server/")
+		c.mu.Lock()
+		failing, blocking := c.failing[server], c.blocking[server]
+		c.mu.Unlock()
+		if blocking {
+			<-r.Context().Done()
+			return
+		}
+		if failing {
+			json.NewEncoder(w).Encode(map[string]string{"status": "NG", "reason": "server not found"})
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		out := []fakeSubmit{}
+		for _, s := range c.submits {
+			if s.ServerUUID == server {
+				out = append(out, s)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "OK", "submits": out})
+	})
+	mux.HandleFunc("/v1/server/list", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "OK", "servers": c.servers})
+	})
+	mux.HandleFunc("/v1/key/", func(w http.ResponseWriter, r *http.Request) {
+		server := strings.TrimPrefix(r.URL.Path, "/v1/key/")
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, s := range c.servers {
+			if s.UUID == server {
+				fmt.Fprint(w, s.Public_key)
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "NG", "reason": "server not found"})
+	})
+	mux.HandleFunc("/v1/submit/new", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if r.Method != http.MethodPut || c.rejectNew > 0 {
+			c.rejectNew--
+			json.NewEncoder(w).Encode(map[string]string{"status": "NG", "reason": "rejected"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "OK", "uuid": c.addLocked(testLocalUUID, string(body))})
+	})
+	mux.HandleFunc("/v1/submit/uuid/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/submit/uuid/")
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, s := range c.submits {
+			if s.UUID == id && r.Method == http.MethodDelete && !c.failing[id] {
+				c.submits = append(c.submits[:i], c.submits[i+1:]...)
+				c.deleted = append(c.deleted, id)
+				json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": "NG", "reason": "submit not found"})
+	})
+	mux.HandleFunc("/trust/", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		statement, ok := c.statements[strings.TrimPrefix(r.URL.Path, "/trust/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, statement)
+	})
+	c.Server = httptest.NewServer(mux)
+	t.Cleanup(c.Close)
+	return c
+}
+
+// register 在中心服务器上登记一个服务器
+func (c *fakeCentral) register(uuid, name, pubkey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.servers = append(c.servers, RemoteServer{ID: len(c.servers) + 1, UUID: uuid, Server_name: name, Public_key: pubkey})
+}
+
+// add 加入一条提交, 返回其在中心服务器上的uuid
+func (c *fakeCentral) add(server, content string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addLocked(server, content)
+}
+
+// addLocked 与 add 相同, 调用者需持有锁
+func (c *fakeCentral) addLocked(server, content string) string {
+	// 已删除的提交的uuid不会被再次使用
+	n := len(c.submits) + len(c.deleted) + 1
+	id := fmt.Sprintf("11111111-0000-4000-8000-%012d", n)
+	c.submits = append(c.submits, fakeSubmit{ID: n, UUID: id, ServerUUID: server, Content: content})
+	return id
+}
+
+// signPayload 用私钥签名一条提交的明文
+func signPayload(t *testing.T, privkey, nonce, player string, point string) string {
+	t.Helper()
+	text := fmt.Sprintf("uuid: %s\r\ntimestamp: 1627776000\r\nplayer_uuid: %s\r\npoints: %s\r\ncomment: griefing", nonce, player, point)
+	signed, err := helper.SignCleartextMessageArmored(privkey, nil, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// addTestServer 在中心服务器 default 下信任一个新的服务器, 返回其私钥和记录
+func addTestServer(t *testing.T, central *fakeCentral, n int) (string, ServerList) {
+	t.Helper()
+	privkey, pubkey := newTestKey(t)
+	server := ServerList{uuid: fmt.Sprintf("00000000-0000-4000-8000-%012d", n), name: fmt.Sprintf("server-%d", n), pubkey: pubkey, level: 1, weight: 1, instance: defaultInstance}
+	err := insertServer(server.uuid, server.name, server.pubkey, server.level, server.instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privkey, server
+}
+
+// newTestCentral 启动模拟的中心服务器, 并注册为中心服务器 default
+func newTestCentral(t *testing.T) *fakeCentral {
+	t.Helper()
+	central := newFakeCentral(t)
+	err := registerServer(defaultInstance, "local", testLocalUUID, central.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return central
+}
+
+func TestGenerateReportQuarantinesRejected(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	privkey, server := addTestServer(t, central, 2)
+	other, _ := newTestKey(t)
+
+	const player = "252af321-89aa-426c-a534-399f551810ae"
+	central.add(server.uuid, signPayload(t, privkey, "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", player, "-0.5"))
+	bad := map[string]string{
+		central.add(server.uuid, signPayload(t, privkey, "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", player, "-1.0")): "duplicate uuid",
+		central.add(server.uuid, signPayload(t, other, "7a2d0b1f-4c8e-4f3b-8d62-1e9f8a7b6c5d", player, "-1.0")):   "wrong signer",
+		central.add(server.uuid, signPayload(t, privkey, "8b3e1c2a-5d9f-4a4c-9e73-2fa09b8c7d6e", player, "1.5")):  "out of range",
+		central.add(server.uuid, signPayload(t, privkey, "9c4f2d3b-6e0a-4b5d-8f84-30b1ac9d8e7f", player, "NaN")):  "not finite",
+		central.add(server.uuid, signPayload(t, privkey, "not-a-uuid", player, "-1.0")):                           "malformed",
+		central.add(server.uuid, "not signed at all"):                                                             "not signed",
+	}
+	// 其他服务器的提交不应被获取
+	central.add("00000000-0000-4000-8000-000000000003", signPayload(t, privkey, "ad5a3e4c-7f1b-4c6e-9a95-41c2bd0e9f80", player, "-1.0"))
+
+	// getServerData 只返回被拒绝的提交, 不写入数据库
+	list, rejected, err := getServerData(context.Background(), central.URL, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].point != -0.5 || list[0].level != 1 {
+		t.Errorf("accepted = %+v, want the single valid submission", list)
+	}
+	if len(rejected) != len(bad) {
+		t.Errorf("rejected = %d, want %d", len(rejected), len(bad))
+	}
+	rejections, err := rejectionList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejections) != 0 {
+		t.Errorf("getServerData() wrote %d rejections, want none", len(rejections))
+	}
+
+	for run := 0; run < 2; run++ {
+		results, _, err := generateReport(context.Background(), ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].accepted != 1 || results[0].rejected != len(bad) {
+			t.Errorf("results = %+v, want 1 accepted and %d rejected", results, len(bad))
+		}
+		// 再次获取时同一提交只保留一条记录
+		rejections, err = rejectionList(server.uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rejections) != len(bad) {
+			t.Fatalf("run %d: rejectionList() has %d entries, want %d", run, len(rejections), len(bad))
+		}
+		for _, r := range rejections {
+			if _, ok := bad[r.uuid]; !ok {
+				t.Errorf("unexpected rejection %s: %s", r.uuid, r.reason)
+			}
+			if r.server_name != server.name || r.content == "" || r.reason == "" {
+				t.Errorf("rejection %s (%s) = %+v, want server name, content and reason", r.uuid, bad[r.uuid], r)
+			}
+		}
+	}
+}
+
+func TestGenerateReportParallelWrites(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	const servers = maxParallelFetch * 3
+	for n := 0; n < servers; n++ {
+		privkey, server := addTestServer(t, central, n+2)
+		for j := 0; j < 5; j++ {
+			central.add(server.uuid, signPayload(t, privkey, fmt.Sprintf("6f1c9a0e-3b7d-4e2a-9c51-%012d", j), fmt.Sprintf("252af321-89aa-426c-a534-%012d", n), "-0.5"))
+		}
+		central.add(server.uuid, "not signed at all")
+	}
+
+	results, inputs, err := generateReport(context.Background(), ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != servers || len(inputs.Servers) != servers || len(inputs.Submissions) != servers*5 {
+		t.Fatalf("got %d results, %d servers and %d submissions, want %d, %d and %d", len(results), len(inputs.Servers), len(inputs.Submissions), servers, servers, servers*5)
+	}
+	rejections, err := rejectionList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejections) != servers {
+		t.Errorf("rejectionList() has %d entries, want %d", len(rejections), servers)
+	}
+	for _, r := range results {
+		list, fetched, err := cachedServerData(r.server.uuid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 5 || fetched != r.fetched {
+			t.Errorf("cache of %s has %d entries fetched at %d, want 5 at %d", r.server.uuid, len(list), fetched, r.fetched)
+		}
+	}
+}
+
+func TestGenerateReportFailKeepsReputation(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	const player = "252af321-89aa-426c-a534-399f551810ae"
+	privkey, good := addTestServer(t, central, 2)
+	central.add(good.uuid, signPayload(t, privkey, "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", player, "-0.5"))
+	_, bad := addTestServer(t, central, 3)
+
+	_, _, err := generateReport(context.Background(), ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := playerReputation(player)
+	if err != nil || before == nil {
+		t.Fatalf("playerReputation() = %v, %v", before, err)
+	}
+
+	central.mu.Lock()
+	central.failing[bad.uuid] = true
+	central.mu.Unlock()
+	central.add(good.uuid, signPayload(t, privkey, "7a2d0b1f-4c8e-4f3b-8d62-1e9f8a7b6c5d", player, "-1.0"))
+	results, _, err := generateReport(context.Background(), ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5})
+	if err == nil || !strings.Contains(err.Error(), bad.uuid) {
+		t.Fatalf("generateReport() error = %v, want failure of %s", err, bad.uuid)
+	}
+	after, err := playerReputation(player)
+	if err != nil || after == nil || *after != *before {
+		t.Errorf("reputation changed from %v to %v after a failed update", *before, after)
+	}
+	// 成功获取的数据仍会写入缓存, 供之后使用 use-cache
+	for _, r := range results {
+		if r.server.uuid != good.uuid || r.err != nil {
+			continue
+		}
+		list, _, err := cachedServerData(good.uuid)
+		if err != nil || len(list) != 2 {
+			t.Errorf("cache of %s = %d entries (%v), want 2", good.uuid, len(list), err)
+		}
+	}
+
+	results, _, err = generateReport(context.Background(), ReportOptions{onError: OnErrorSkip, trustDepth: 1, attenuation: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.server.uuid == bad.uuid && !r.missing {
+			t.Errorf("result of %s = %+v, want missing", bad.uuid, r)
+		}
+	}
+	after, err = playerReputation(player)
+	if err != nil || after == nil || *after == *before {
+		t.Errorf("reputation = %v, want it updated after skipping the failed server", after)
+	}
+}
+
+func TestGenerateReportCancel(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	for n := 0; n < maxParallelFetch*2; n++ {
+		_, server := addTestServer(t, central, n+2)
+		central.blocking[server.uuid] = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := generateReport(ctx, ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5})
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+			t.Errorf("generateReport() error = %v, want cancellation", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("generateReport() did not return after cancellation")
+	}
+}
+
+func TestGenerateReportUseCache(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	const player = "252af321-89aa-426c-a534-399f551810ae"
+	privkey, cached := addTestServer(t, central, 2)
+	central.add(cached.uuid, signPayload(t, privkey, "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", player, "-0.5"))
+	// 没有任何提交的服务器也应记录获取时间
+	_, empty := addTestServer(t, central, 3)
+
+	opts := ReportOptions{onError: OnErrorUseCache, trustDepth: 1, attenuation: 0.5}
+	_, _, err := generateReport(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, never := addTestServer(t, central, 4)
+	central.mu.Lock()
+	for _, uuid := range []string{cached.uuid, empty.uuid, never.uuid} {
+		central.failing[uuid] = true
+	}
+	central.mu.Unlock()
+
+	results, inputs, err := generateReport(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		stale, missing bool
+		accepted       int
+	}{
+		cached.uuid: {stale: true, accepted: 1},
+		empty.uuid:  {stale: true},
+		never.uuid:  {missing: true},
+	}
+	for _, r := range results {
+		w := want[r.server.uuid]
+		if r.err == nil || r.stale != w.stale || r.missing != w.missing || r.accepted != w.accepted {
+			t.Errorf("result of %s = %+v, want %+v", r.server.name, r, w)
+		}
+		if r.stale && r.fetched == 0 {
+			t.Errorf("result of %s has no fetch time", r.server.name)
+		}
+	}
+	// 使用缓存的服务器计入输入, 缺失数据的服务器不计入
+	if len(inputs.Servers) != 2 || len(inputs.Submissions) != 1 {
+		t.Errorf("inputs = %+v, want 2 servers and 1 submission", inputs)
+	}
+	// 评分按信任等级加权: -0.5 * 1/5
+	point, err := playerReputation(player)
+	if err != nil || point == nil || math.Abs(*point+0.1) > 1e-9 {
+		t.Errorf("playerReputation() = %v, %v, want -0.1 from the cache", point, err)
+	}
+}
+
+func TestCheckLevel(t *testing.T) {
+	for level, ok := range map[int]bool{0: false, 1: true, 3: true, 5: true, 6: false, -1: false} {
+		if err := checkLevel(level); (err == nil) != ok {
+			t.Errorf("checkLevel(%d) error = %v", level, err)
+		}
+	}
+}
+
+func TestGenerateReportSkipsDisabled(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	privkey, server := addTestServer(t, central, 2)
+	central.add(server.uuid, signPayload(t, privkey, "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", "252af321-89aa-426c-a534-399f551810ae", "-0.5"))
+	err := updateServer(server.uuid, "disabled", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, inputs, err := generateReport(context.Background(), ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 || len(inputs.Submissions) != 0 {
+		t.Errorf("generateReport() used the disabled server: %+v", results)
+	}
+}
+
+func TestTrustRemoteServer(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	_, pubkey := newTestKey(t)
+	const uuid = "00000000-0000-4000-8000-000000000002"
+	central.register(uuid, "Neko", pubkey)
+
+	instance, err := getInstance(defaultInstance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := remoteServers(instance)
+	if err != nil || len(list) != 1 || list[0].UUID != uuid || list[0].Server_name != "Neko" {
+		t.Fatalf("remoteServers() = %+v, %v", list, err)
+	}
+	key, err := fetchServerKey(context.Background(), central.URL, uuid)
+	if err != nil || key != pubkey {
+		t.Fatalf("fetchServerKey() = %q, %v, want the registered key", key, err)
+	}
+	_, err = fetchServerKey(context.Background(), central.URL, "00000000-0000-4000-8000-000000000003")
+	if err == nil {
+		t.Error("fetchServerKey() of an unknown server succeeded")
+	}
+
+	err = trustRemoteServer(defaultInstance, uuid, "", 4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers, err := serverList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未指定名称时使用中心服务器上登记的名称
+	if len(servers) != 1 || servers[0].name != "Neko" || servers[0].level != 4 || servers[0].pubkey != pubkey || servers[0].instance != defaultInstance {
+		t.Errorf("serverList() = %+v", servers)
+	}
+	if trustRemoteServer(defaultInstance, "00000000-0000-4000-8000-000000000003", "", 4, true) == nil {
+		t.Error("trustRemoteServer() of an unknown server succeeded")
+	}
+	if trustRemoteServer(defaultInstance, uuid, "", 6, true) == nil {
+		t.Error("trustRemoteServer() with level 6 succeeded")
+	}
+}
+
+func TestTrustRemoteServerAcrossInstances(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	mirror := newFakeCentral(t)
+	err := registerServer("mirror", "local", "00000000-0000-4000-8000-000000000001", mirror.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pubkey := newTestKey(t)
+	const uuid = "00000000-0000-4000-8000-000000000002"
+	central.register(uuid, "Neko", pubkey)
+	mirror.register(uuid, "Neko", pubkey)
+
+	err = trustRemoteServer(defaultInstance, uuid, "", 4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一服务器不能在另一个中心服务器下再次被信任, 错误中给出其所在的中心服务器
+	err = trustRemoteServer("mirror", uuid, "", 5, true)
+	want := fmt.Sprintf(T("服务器 %s 已在中心服务器 %s 下被信任"), uuid, defaultInstance)
+	if err == nil || err.Error() != want {
+		t.Errorf("trustRemoteServer() under a second instance error = %v, want %q", err, want)
+	}
+	servers, err := serverList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].instance != defaultInstance || servers[0].level != 4 {
+		t.Errorf("serverList() = %+v, want the server kept under %s", servers, defaultInstance)
+	}
+}
+
+// setOperator 设置操作者, 测试结束后恢复
+func setOperator(t *testing.T, name string) {
+	t.Helper()
+	old := operatorName
+	operatorName = name
+	t.Cleanup(func() { operatorName = old })
+}
+
+func TestSubmitToInstances(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	mirror := newFakeCentral(t)
+	err := registerServer("mirror", "local", testLocalUUID, mirror.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setOperator(t, "alice")
+	const player = "252af321-89aa-426c-a534-399f551810ae"
+
+	start := time.Now().Unix()
+	err = submitToInstances([]string{defaultInstance, "mirror"}, "252af32189aa426ca534399f551810ae", "griefing", -0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := querySubmissions(SubmissionFilter{})
+	if err != nil || len(list) != 2 {
+		t.Fatalf("querySubmissions() = %+v, %v, want one submission per instance", list, err)
+	}
+	// 各中心服务器使用同一份签名内容
+	for i, c := range []*fakeCentral{central, mirror} {
+		s := list[i]
+		if len(c.submits) != 1 || c.submits[0].Content != s.message || c.submits[0].UUID != s.uuid {
+			t.Errorf("submission %s was not stored as published on %s", s.uuid, s.instance)
+		}
+		if s.player_uuid != player || s.point != -0.5 || s.comment != "griefing" || s.operator != "alice" || s.timestamp < start || s.nonce != list[0].nonce || s.message != list[0].message {
+			t.Errorf("submission = %+v", s)
+		}
+		signed, err := verifySubmission(testLocalKey.public, s.message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signed.uuid != s.nonce || signed.timestamp != s.timestamp || signed.player_uuid != player || signed.point != s.point || signed.comment != s.comment {
+			t.Errorf("signed payload %+v does not match the stored submission %+v", signed, s)
+		}
+	}
+	if list[0].instance != defaultInstance || list[1].instance != "mirror" {
+		t.Errorf("submissions were stored under %s and %s", list[0].instance, list[1].instance)
+	}
+
+	// 部分中心服务器失败时, 成功的提交仍会被保存
+	mirror.mu.Lock()
+	mirror.rejectNew = 1
+	mirror.mu.Unlock()
+	err = submitToInstances([]string{defaultInstance, "mirror"}, player, "spam", -1)
+	if err == nil || !strings.Contains(err.Error(), "mirror") {
+		t.Errorf("submitToInstances() with a failing instance error = %v", err)
+	}
+	list, err = querySubmissions(SubmissionFilter{comment: "spam"})
+	if err != nil || len(list) != 1 || list[0].instance != defaultInstance {
+		t.Errorf("querySubmissions() after a partial failure = %+v, %v", list, err)
+	}
+
+	// 校验失败时不会提交
+	if submitToInstances([]string{defaultInstance}, player, "griefing", -0.25) == nil || submitToInstances([]string{"unknown"}, player, "griefing", -1) == nil {
+		t.Error("submitToInstances() with an invalid point or instance succeeded")
+	}
+	if len(central.submits) != 2 {
+		t.Errorf("central server has %d submissions, want 2", len(central.submits))
+	}
+}
+
+// revokedSubmission 读取已撤回的提交的撤回理由和替代它的提交
+func revokedSubmission(t *testing.T, uuid string) (reason, supersededBy string, ok bool) {
+	t.Helper()
+	err := db.QueryRow("SELECT reason, IFNULL(superseded_by, '') FROM RevokedSubmission WHERE uuid = ?", uuid).Scan(&reason, &supersededBy)
+	if err == sql.ErrNoRows {
+		return "", "", false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reason, supersededBy, true
+}
+
+func TestAmendSubmission(t *testing.T) {
+	const player = "252af321-89aa-426c-a534-399f551810ae"
+	// submit 提交一条新的记录, 返回其本地记录
+	submit := func(t *testing.T) SubList {
+		t.Helper()
+		err := submitToInstances([]string{defaultInstance}, player, "griefing", -0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := querySubmissions(SubmissionFilter{desc: true, limit: 1})
+		if err != nil || len(list) != 1 {
+			t.Fatalf("querySubmissions() = %+v, %v", list, err)
+		}
+		return list[0]
+	}
+	point := -1.0
+	comment := "griefing spawn"
+
+	t.Run("success", func(t *testing.T) {
+		newTestDB(t)
+		central := newTestCentral(t)
+		old := submit(t)
+		data, err := amendSubmission(old.uuid, &point, nil, "typo in point")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.supersedes != old.uuid || data.point != -1 || data.comment != "griefing" || data.nonce == old.nonce {
+			t.Errorf("amendSubmission() = %+v", data)
+		}
+		list, err := querySubmissions(SubmissionFilter{})
+		if err != nil || len(list) != 1 || list[0].uuid != data.uuid || list[0].supersedes != old.uuid || list[0].message != data.message {
+			t.Errorf("local submissions after amend = %+v, %v", list, err)
+		}
+		reason, by, ok := revokedSubmission(t, old.uuid)
+		if !ok || reason != "typo in point" || by != data.uuid {
+			t.Errorf("revoked submission = %q, %q, %v", reason, by, ok)
+		}
+		central.mu.Lock()
+		defer central.mu.Unlock()
+		if len(central.deleted) != 1 || central.deleted[0] != old.uuid || len(central.submits) != 1 || central.submits[0].Content != data.message {
+			t.Errorf("central server deleted %v and has %+v", central.deleted, central.submits)
+		}
+	})
+
+	t.Run("unchanged or invalid", func(t *testing.T) {
+		newTestDB(t)
+		central := newTestCentral(t)
+		old := submit(t)
+		same := -0.5
+		bad := 2.0
+		for _, tt := range []struct {
+			point   *float64
+			comment *string
+		}{{&same, nil}, {nil, nil}, {&bad, nil}} {
+			if _, err := amendSubmission(old.uuid, tt.point, tt.comment, "typo"); err == nil {
+				t.Errorf("amendSubmission(%v, %v) succeeded", tt.point, tt.comment)
+			}
+		}
+		if _, err := amendSubmission("11111111-0000-4000-8000-000000000999", &point, nil, "typo"); err == nil {
+			t.Error("amendSubmission() of an unknown submission succeeded")
+		}
+		// 中心服务器撤回失败时不做任何修改
+		central.mu.Lock()
+		central.failing[old.uuid] = true
+		central.mu.Unlock()
+		if _, err := amendSubmission(old.uuid, &point, &comment, "typo"); err == nil {
+			t.Error("amendSubmission() succeeded although the central server refused the deletion")
+		}
+		list, err := querySubmissions(SubmissionFilter{})
+		if err != nil || len(list) != 1 || list[0].uuid != old.uuid || list[0].point != -0.5 {
+			t.Errorf("local submissions = %+v, %v", list, err)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		newTestDB(t)
+		central := newTestCentral(t)
+		old := submit(t)
+		central.mu.Lock()
+		central.rejectNew = 1
+		central.mu.Unlock()
+		_, amendErr := amendSubmission(old.uuid, &point, &comment, "typo")
+		if amendErr == nil {
+			t.Fatal("amendSubmission() succeeded although the new submission was rejected")
+		}
+		// 原提交以新的时间戳和uuid重新签名并发布, 本地记录改为重新发布后的uuid
+		list, err := querySubmissions(SubmissionFilter{})
+		if err != nil || len(list) != 1 {
+			t.Fatalf("local submissions = %+v, %v", list, err)
+		}
+		restored := list[0]
+		if restored.uuid == old.uuid || restored.nonce == old.nonce || restored.message == old.message || restored.point != old.point || restored.comment != old.comment ||
+			!strings.Contains(amendErr.Error(), restored.uuid) {
+			t.Errorf("restored submission = %+v, error %v", restored, amendErr)
+		}
+		central.mu.Lock()
+		defer central.mu.Unlock()
+		if len(central.submits) != 1 || central.submits[0].UUID != restored.uuid || central.submits[0].Content != restored.message {
+			t.Errorf("central server has %+v", central.submits)
+		}
+	})
+
+	t.Run("rollback fails", func(t *testing.T) {
+		newTestDB(t)
+		central := newTestCentral(t)
+		old := submit(t)
+		central.mu.Lock()
+		central.rejectNew = 2
+		central.mu.Unlock()
+		_, err := amendSubmission(old.uuid, &point, &comment, "typo")
+		if err == nil {
+			t.Fatal("amendSubmission() succeeded")
+		}
+		// 原提交已被撤回, 本地也不再保留
+		list, err := querySubmissions(SubmissionFilter{})
+		if err != nil || len(list) != 0 {
+			t.Errorf("local submissions = %+v, %v", list, err)
+		}
+		if reason, by, ok := revokedSubmission(t, old.uuid); !ok || reason != "typo" || by != "" {
+			t.Errorf("revoked submission = %q, %q, %v", reason, by, ok)
+		}
+	})
+}
+
+func TestRevokeSubmissions(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	const (
+		griefer = "252af321-89aa-426c-a534-399f551810ae"
+		other   = "00000000-0000-4000-8000-00000000000a"
+	)
+	for _, player := range []string{griefer, griefer, griefer, other} {
+		err := submitToInstances([]string{defaultInstance}, player, "griefing", -0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := querySubmissions(SubmissionFilter{player: griefer})
+	if err != nil || len(list) != 3 {
+		t.Fatalf("querySubmissions() = %+v, %v", list, err)
+	}
+
+	if revokeSubmissions(SubmissionFilter{}, "mistake", true) == nil {
+		t.Error("revokeSubmissions() without a filter succeeded")
+	}
+	if revokeSubmissions(SubmissionFilter{player: "00000000-0000-4000-8000-00000000000b"}, "mistake", true) == nil {
+		t.Error("revokeSubmissions() matching nothing succeeded")
+	}
+
+	// 一条提交撤回失败时继续处理其余的提交
+	central.mu.Lock()
+	central.failing[list[1].uuid] = true
+	central.mu.Unlock()
+	err = revokeSubmissions(SubmissionFilter{player: griefer}, "mistake", true)
+	if err == nil || err.Error() != fmt.Sprintf(T("%d 条提交撤回失败, %d 条成功"), 1, 2) {
+		t.Errorf("revokeSubmissions() = %v", err)
+	}
+	central.mu.Lock()
+	deleted := append([]string(nil), central.deleted...)
+	central.mu.Unlock()
+	if len(deleted) != 2 || deleted[0] != list[0].uuid || deleted[1] != list[2].uuid {
+		t.Errorf("central server deleted %v", deleted)
+	}
+	for _, i := range []int{0, 2} {
+		if reason, _, ok := revokedSubmission(t, list[i].uuid); !ok || reason != "mistake" {
+			t.Errorf("revoked submission %s = %q, %v", list[i].uuid, reason, ok)
+		}
+	}
+	rest, err := querySubmissions(SubmissionFilter{})
+	if err != nil || len(rest) != 2 || rest[0].uuid != list[1].uuid || rest[1].player_uuid != other {
+		t.Errorf("local submissions after revoke = %+v, %v", rest, err)
+	}
+}
+
+func TestGetServerData(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	privkey, server := addTestServer(t, central, 2)
+	const player = "252af321-89aa-426c-a534-399f551810ae"
+	// 换行为 \n 且评分超过4个字符的提交
+	lf, err := helper.SignCleartextMessageArmored(privkey, nil, fmt.Sprintf("uuid: 7a2d0b1f-4c8e-4f3b-8d62-1e9f8a7b6c5d\ntimestamp: 1627776000\nplayer_uuid: %s\npoints: -0.125\ncomment: griefing\nsecond line", player))
+	if err != nil {
+		t.Fatal(err)
+	}
+	central.add(server.uuid, signPayload(t, privkey, "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", player, "-1"))
+	bad := central.add(server.uuid, "not signed at all")
+	central.add(server.uuid, lf)
+
+	// 一条提交出错时跳过该条, 不影响其余的提交
+	list, rejected, err := getServerData(context.Background(), central.URL, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].uuid != "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c" || list[0].point != -1 ||
+		list[1].uuid != "7a2d0b1f-4c8e-4f3b-8d62-1e9f8a7b6c5d" || list[1].point != -0.125 || list[1].comment != "griefing\nsecond line" || list[1].player_uuid != player {
+		t.Errorf("getServerData() accepted %+v", list)
+	}
+	if len(rejected) != 1 || rejected[0].uuid != bad || rejected[0].server_uuid != server.uuid || rejected[0].content != "not signed at all" {
+		t.Errorf("getServerData() rejected %+v", rejected)
+	}
+
+	// 中心服务器返回错误时整体失败
+	central.mu.Lock()
+	central.failing[server.uuid] = true
+	central.mu.Unlock()
+	if _, _, err := getServerData(context.Background(), central.URL, server); err == nil {
+		t.Error("getServerData() succeeded although the central server failed")
+	}
+}
@@ -8,4 +8,6 @@ require (
 	github.com/satori/go.uuid v1.2.0
 	github.com/schollz/progressbar/v3 v3.8.2
 	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/term v0.0.0-20210615171337-6886f2dfbf5b
+	gopkg.in/yaml.v2 v2.4.0
 )
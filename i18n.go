@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// 支持的语言
+const (
+	LangZhCN = "zh-CN"
+	LangEnUS = "en-US"
+)
+
+// catalogues 各语言的消息目录
+//
+// 源码中的消息本身就是某种语言的原文, 目录只记录需要翻译的消息:
+// 中文原文的英文译文在 enUS 中, 英文原文的中文译文在 zhCN 中. 没有译文时原样输出.
+var catalogues = map[string]map[string]string{
+	LangZhCN: zhCN,
+	LangEnUS: enUS,
+}
+
+// language 当前使用的语言, 在解析命令行参数之前确定, 以便翻译命令的帮助信息
+var language = detectLanguage(os.Args[1:])
+
+// normalizeLanguage 将 zh, zh_CN.UTF-8, en, en_US 等形式转换为支持的语言, 无法识别时返回空
+func normalizeLanguage(value string) string {
+	value = strings.ToLower(value)
+	switch {
+	case strings.HasPrefix(value, "zh"):
+		return LangZhCN
+	case strings.HasPrefix(value, "en"):
+		return LangEnUS
+	}
+	return ""
+}
+
+// globalValueFlags 需要取值的全局参数, 其后的参数是取值而不是子命令
+var globalValueFlags = map[string]bool{
+	"config":       true,
+	"log-level":    true,
+	"log-format":   true,
+	"lang":         true,
+	"log-lang":     true,
+	"operator":     true,
+	"http-timeout": true,
+}
+
+// detectLanguage 依次根据 --lang 参数, LC_ALL, LC_MESSAGES 和 LANG 环境变量确定语言, 默认为简体中文
+func detectLanguage(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		// 只查找子命令之前的全局参数
+		if !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == "lang" && i+1 < len(args) {
+			if lang := normalizeLanguage(args[i+1]); lang != "" {
+				return lang
+			}
+		}
+		if globalValueFlags[name] {
+			i++
+			continue
+		}
+		if strings.HasPrefix(name, "lang=") {
+			if lang := normalizeLanguage(strings.TrimPrefix(name, "lang=")); lang != "" {
+				return lang
+			}
+		}
+	}
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if lang := normalizeLanguage(os.Getenv(env)); lang != "" {
+			return lang
+		}
+	}
+	return LangZhCN
+}
+
+// translate 将消息翻译为指定语言, 没有译文时原样返回
+func translate(lang, msg string) string {
+	if t, ok := catalogues[lang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// T 将消息翻译为当前语言
+func T(msg string) string {
+	return translate(language, msg)
+}
@@ -0,0 +1,353 @@
+package main
+
+// enUS 英文译文, 键为源码中的中文消息
+var enUS = map[string]string{
+	// 表头
+	"\t\t操作uuid\t\t|\t\t玩家uuid\t\t|  评分\t|中心服务器\t|理由": "\t\tsubmission uuid\t\t|\t\tplayer uuid\t\t|  point\t|central server\t|comment",
+	"\t\t服务器uuid\t\t|\t\t公钥指纹\t\t\t|名称":               "\t\tserver uuid\t\t|\t\tkey fingerprint\t\t\t|name",
+	"\t\t服务器uuid\t\t|名称\t|权重\t|接受\t|拒绝\t|状态":          "\t\tserver uuid\t\t|name\t|weight\t|accepted\t|rejected\t|status",
+	"\t\t服务器uuid\t\t|等级\t|状态\t|中心服务器\t|名称":            "\t\tserver uuid\t\t|level\t|status\t|central server\t|name",
+	"\t\t玩家uuid\t\t|之前\t|之后":                          "\t\tplayer uuid\t\t|before\t|after",
+	"\t\t玩家uuid\t\t|评分":                               "\t\tplayer uuid\t\t|point",
+	"\t\t玩家uuid\t\t|过期时间\t\t|备注":                      "\t\tplayer uuid\t\t|expires\t\t|note",
+	"名称\t|\t\t本服务器uuid\t\t|本服务器名称\t|地址":               "name\t|\t\tour server uuid\t\t|our server name\t|address",
+	"名称\t|种类\t|事件\t|地址":                               "name\t|kind\t|events\t|address",
+
+	// 输出
+	"%s\t|%.1f\t(强制封禁)": "%s\t|%.1f\t(denied)",
+	"%s[%s](已过期)":       "%s[%s](stale)",
+	"%s[%s](缺失)":        "%s[%s](missing)",
+	"(已过期)":             "(expired)",
+	"中心服务器: %s\n服务器: %s[%s]\n公钥指纹: %s\n信任等级: %d\n": "Central server: %s\nServer: %s[%s]\nKey fingerprint: %s\nTrust level: %d\n",
+	"停用":                         "disabled",
+	"启用":                         "enabled",
+	"全部":                         "all",
+	"成功":                         "ok",
+	"失败: ":                       "failed: ",
+	"缺失: ":                       "missing: ",
+	"经由 ":                        "via ",
+	"已过期, 使用 %s 的缓存 (%s)":        "stale, using cache from %s (%s)",
+	"原因: %s\n":                   "Reason: %s\n",
+	"原始内容:\n%s\n":                "Raw content:\n%s\n",
+	"时间: %s\n":                   "Time: %s\n",
+	"提交uuid: %s\n":               "Submission uuid: %s\n",
+	"服务器: %s[%s]\n":              "Server: %s[%s]\n",
+	"报告 %d (%s) -> 报告 %d (%s)\n": "Report %d (%s) -> report %d (%s)\n",
+	"新封禁":                        "Newly banned",
+	"已解除":                        "Cleared",
+	"评分变化":                       "Score changed",
+	"永不过期\t":                     "never\t\t",
+	"无法解析公钥\t\t\t":               "invalid public key\t\t",
+	"确认信任该服务器?":                  "Trust this server?",
+
+	"替代的提交: %s\n":   "Supersedes: %s\n",
+	"未知":            "unknown",
+	"操作uuid: %s\n":  "Submission uuid: %s\n",
+	"玩家uuid: %s\n":  "Player uuid: %s\n",
+	"评分: %.1f\n":    "Point: %.1f\n",
+	"理由: %s\n":      "Comment: %s\n",
+	"中心服务器: %s\n":   "Central server: %s\n",
+	"签名uuid: %s\n":  "Signed uuid: %s\n",
+	"签名时间: %s\n":    "Signed at: %s\n",
+	"操作者: %s\n":     "Operator: %s\n",
+	"签名内容:\n%s\n\n": "Signed message:\n%s\n\n",
+	"签名内容: %s\n\n":  "Signed message: %s\n\n",
+
+	"玩家: %s (%s)\n":                             "Player: %s (%s)\n",
+	"玩家: %s\n":                                  "Player: %s\n",
+	"当前评分: %.2f\n":                              "Current score: %.2f\n",
+	"当前评分: 不在上次的报告中":                            "Current score: not in the last report",
+	"本地名单: 无":                                   "Local list: none",
+	"本地名单: %s (已于 %s 过期) %s\n":                  "Local list: %s (expired at %s) %s\n",
+	"本地名单: %s %s\n":                             "Local list: %s %s\n",
+	"封禁状态: 还没有保存过报告":                            "Ban status: no report saved yet",
+	"封禁状态: 在报告 %d (%s) 中被封禁, 会被导出\n":            "Ban status: banned in report %d (%s), exported\n",
+	"封禁状态: 在报告 %d (%s) 中未被封禁\n":                 "Ban status: not banned in report %d (%s)\n",
+	"\n本服务器的提交 (%d):\n":                         "\nOur submissions (%d):\n",
+	"\n信任的服务器的提交 (%d):\n":                       "\nSubmissions of trusted servers (%d):\n",
+	"\t\t操作uuid\t\t|  评分\t|中心服务器\t|时间\t\t\t|理由": "\t\tsubmission uuid\t\t|  point\t|central server\t|time\t\t\t|comment",
+	"\t\t提交uuid\t\t|  评分\t|服务器\t|时间\t\t\t|理由":   "\t\tsubmission uuid\t\t|  point\t|server\t|time\t\t\t|comment",
+
+	// 命令帮助
+	"一个简陋的客户端":         "A simple OpenMPRDB client",
+	"更新信誉信息":           "Update the reputation report.",
+	"列出一些东西，例如提交历史...": "List things, such as the submission history.",
+	"不显示进度条":           "Hide the progress bar.",
+	"界面语言: zh-CN, en-US, 默认根据 LANG 环境变量确定":                    "Interface language: zh-CN, en-US. Detected from LANG by default.",
+	"日志语言: zh-CN, en-US, 默认与界面语言相同":                           "Log language: zh-CN, en-US. Same as the interface language by default.",
+	"日志格式: text, json":                                        "Log format: text, json.",
+	"日志级别: debug, info, warn, error":                          "Log level: debug, info, warn, error.",
+	"只输出小于某值的数据":                                              "Only list players whose score is at most this value.",
+	"更新完成后将结果导出到文件中":                                          "Export the ban list to this file after the update.",
+	"更新完成后将指标写入文件, 供 node_exporter 的 textfile collector 读取":   "Write metrics to this file after the update, for the node_exporter textfile collector.",
+	"某个服务器获取失败时的处理方式: fail(中止), skip(跳过), use-cache(使用上次的数据)": "What to do when a server cannot be fetched: fail, skip, use-cache.",
+	"信任的最大深度, 大于 1 时根据信任声明加入间接信任的服务器":                         "Maximum trust depth; above 1, servers trusted by trusted servers are included.",
+	"每经过一层间接信任时权重的衰减系数 (0 ~ 1)":                               "Weight attenuation per level of transitive trust. (0 ~ 1)",
+
+	// 错误
+	"interval 必须大于 0":                           "interval must be greater than 0",
+	"player_uuid格式错误: ":                         "invalid player_uuid: ",
+	"server_uuid格式错误: ":                         "invalid server_uuid: ",
+	"timestamp格式错误: ":                           "invalid timestamp: ",
+	"trust字段uuid格式错误: ":                         "invalid uuid in trust field: ",
+	"trust字段信任等级格式错误: ":                         "invalid level in trust field: ",
+	"trust字段格式错误: ":                             "invalid trust field: ",
+	"uuid格式错误: ":                                "invalid uuid: ",
+	"不是信任声明: type: ":                            "not a trust statement: type: ",
+	"中心服务器返回异常: ":                               "central server error: ",
+	"以下中心服务器提交失败: ":                             "submission failed on these central servers: ",
+	"信任声明的签发者不符: %s":                            "trust statement signed by another server: %s",
+	"信任声明解析失败: ":                                "failed to parse trust statement: ",
+	"信任声明验签失败: ":                                "trust statement signature verification failed: ",
+	"信任深度必须大于等于 1: %d":                          "trust depth must be at least 1: %d",
+	"信任等级必须在 1 ~ 5 之间: %d":                      "trust level must be between 1 and 5: %d",
+	"公钥指纹不符: %s":                                "key fingerprint mismatch: %s",
+	"内容解析失败: ":                                  "failed to parse content: ",
+	"创建请求错误: ":                                  "failed to create request: ",
+	"发送请求错误: ":                                  "request failed: ",
+	"字段重复: ":                                    "duplicate field: ",
+	"尚未在中心服务器 %s 上注册":                           "not registered on central server %s",
+	"尚未在中心服务器 %s 上注册, 请先执行 register":            "not registered on central server %s, run register first",
+	"序列化错误: ":                                   "serialization error: ",
+	"执行第%d项变更失败: %s":                            "migration %d failed: %s",
+	"操作已取消":                                     "cancelled",
+	"操作已取消: ":                                   "cancelled: ",
+	"文件写入错误: ":                                  "failed to write file: ",
+	"无法写入指标文件: ":                                "failed to write metrics file: ",
+	"无法创建指标文件: ":                                "failed to create metrics file: ",
+	"无法获取评分: ":                                  "invalid points: ",
+	"无法解析公钥: ":                                  "invalid public key: ",
+	"无法识别的内容: ":                                 "unrecognized content: ",
+	"无法识别的报告编号: ":                               "invalid report id: ",
+	"无法识别的过期时间: ":                               "invalid expiry: ",
+	"无法读取数据库版本: ":                               "failed to read database version: ",
+	"无法读取本地私钥: ":                                "failed to read local private key: ",
+	"服务器[%s]: %s":                               "server [%s]: %s",
+	"未找到报告 %d: %s":                              "report %d not found: %s",
+	"未找到服务器: ":                                  "server not found: ",
+	"未找到通知目标: ":                                 "notification target not found: ",
+	"未知的事件: %s (可选 %s)":                         "unknown event: %s (one of %s)",
+	"未知的处理方式: %s (可选 %s, %s, %s)":               "unknown policy: %s (one of %s, %s, %s)",
+	"未知的通知种类: %s (可选 %s, %s)":                   "unknown notification kind: %s (one of %s, %s)",
+	"未知的语言: %s (可选 zh-CN, en-US)":               "unknown language: %s (one of zh-CN, en-US)",
+	"本地数据库错误: ":                                 "local database error: ",
+	"模板执行错误: ":                                  "template execution error: ",
+	"模板解析错误: ":                                  "template parse error: ",
+	"消息验签失败: ":                                  "signature verification failed: ",
+	"玩家uuid格式错误: ":                              "invalid player uuid: ",
+	"玩家不在名单中: ":                                 "player is not on the list: ",
+	"签名时发生错误: ":                                 "failed to sign: ",
+	"缺少参数: ":                                    "missing argument: ",
+	"缺少字段: ":                                    "missing field: ",
+	"缺少字段: server_uuid":                         "missing field: server_uuid",
+	"获取服务器[%s]的数据失败: %s":                        "failed to fetch data of server [%s]: %s",
+	"衰减系数必须在 0 ~ 1 之间: %g":                      "attenuation must be between 0 and 1: %g",
+	"评分超出范围: %g":                                "point out of range: %g",
+	"读取指定公钥错误: ":                                "failed to read public key: ",
+	"读取返回值错误: ":                                 "failed to read response: ",
+	"返回状态异常: %s":                                "unexpected status: %s",
+	"还没有保存过报告, 请先执行 update":                     "no report has been saved yet, run update first",
+	"重复的提交uuid: ":                               "duplicate submission uuid: ",
+	"未知的日志级别: %s (可选 debug, info, warn, error)": "unknown log level: %s (one of debug, info, warn, error)",
+	"未知的日志格式: %s (可选 %s, %s)":                   "unknown log format: %s (one of %s, %s)",
+
+	"评分必须在 -1 ~ 1 之间: %g":    "point must be between -1 and 1: %g",
+	"评分最多一位小数: %g":           "point must have at most one decimal place: %g",
+	"理由不是有效的UTF-8文本":         "comment is not valid UTF-8",
+	"理由不能为空":                 "comment must not be empty",
+	"理由过长: %d 个字符 (最多 %d 个)": "comment too long: %d characters (at most %d)",
+	"理由中不能包含换行或控制字符: %q":     "comment must not contain newlines or control characters: %q",
+
+	"无法识别的时间: ":                   "invalid time: ",
+	"未知的排序方式: %s (可选 %s, %s, %s)": "unknown sort order: %s (one of %s, %s, %s)",
+	"limit 和 offset 不能为负数":        "limit and offset must not be negative",
+
+	"不是有效的玩家uuid或名称: ": "not a valid player uuid or name: ",
+	"未找到玩家: ":          "player not found: ",
+
+	"本地数据库中没有该提交: ":                     "submission not found in the local database: ",
+	"新提交与原提交的内容相同":                      "the new submission is the same as the old one",
+	"新提交失败: %s; 恢复原提交也失败: %s, 原提交已被撤回":  "new submission failed: %s; restoring the old one also failed: %s, the old submission is revoked",
+	"新提交失败: %s; 已重新发布原提交, 新的操作uuid: %s": "new submission failed: %s; the old submission was published again with uuid %s",
+	"请至少指定 point 或 comment":             "specify at least point or comment",
+
+	"请至少指定一个筛选条件":             "specify at least one filter option",
+	"没有符合条件的提交":               "no matching submissions",
+	"确认撤回以上 %d 条提交? 撤回理由: %s": "Revoke the %d submissions above? Reason: %s",
+	"%d 条提交撤回失败, %d 条成功":      "%d submissions failed to be revoked, %d succeeded",
+	"submit 和 filter 不能同时使用":  "submit and filter cannot be used together",
+	"请指定 submit 或 filter":     "specify submit or filter",
+	"\t\t操作uuid\t\t|结果":       "\t\tsubmission uuid\t\t|result",
+
+	// 日志
+	"提交已全部撤回":             "All submissions revoked",
+	"无法记录被撤回的提交":          "Failed to record revoked submission",
+	"提交已修改":               "Submission amended",
+	"信任声明已写入文件":           "Trust statement written",
+	"信任服务器成功, 已存储对应的公钥":   "Server trusted, public key stored",
+	"升级数据库错误":             "Failed to migrate database",
+	"向中心服务器提交失败":          "Failed to submit to central server",
+	"在中心服务器上注册成功":         "Registered on central server",
+	"密钥文件生成成功, 请妥善保管相关副本": "Key files generated, please keep a backup in a safe place",
+	"已到达最底端":              "End of list",
+	"已发送测试消息":             "Test message sent",
+	"已拒绝远程提交":             "Rejected remote submission",
+	"已获取服务器的数据":           "Fetched server data",
+	"已跳过服务器的信任声明":         "Skipped trust statement of server",
+	"已跳过间接信任的服务器":         "Skipped transitively trusted server",
+	"打开数据库错误":             "Failed to open database",
+	"报告已保存":               "Report saved",
+	"指标服务出错":              "Metrics server failed",
+	"指标服务已启动":             "Metrics server started",
+	"提交删除成功":              "Submission deleted",
+	"数据库文件不存在, 将在默认位置初始化数据库文件": "Database file not found, initializing a new one",
+	"数据库错误":         "Database error",
+	"无法读取通知目标":      "Failed to read notification targets",
+	"更新失败":          "Update failed",
+	"服务器已停用":        "Server disabled",
+	"服务器已删除":        "Server removed",
+	"服务器已启用":        "Server enabled",
+	"服务器已重命名":       "Server renamed",
+	"服务器的信任声明地址已修改": "Trust statement URL of server changed",
+	"服务器的信任等级已修改":   "Trust level of server changed",
+	"本报告不完整, 以下服务器的数据已过期或缺失": "Report is incomplete, data of these servers is stale or missing",
+	"玩家已加入名单":       "Player added to list",
+	"玩家已移出名单":       "Player removed from list",
+	"玩家数据已提交到中心服务器": "Player data submitted to central server",
+	"玩家数据提交成功":      "Player data submitted",
+	"获取公钥错误":        "Failed to read public key",
+	"获取私钥错误":        "Failed to read private key",
+	"连接数据库错误":       "Failed to connect to database",
+	"发送请求":          "Sending request",
+	"通知发送失败":        "Failed to send notification",
+	"通知目标已删除":       "Notification target removed",
+	"通知目标添加成功":      "Notification target added",
+
+	"操作者的名称, 记录在提交和审计日志中, 默认为系统用户名": "Operator name, recorded with submissions and in the audit log. Defaults to the system user name",
+	"无法记录审计日志": "Failed to record the audit log",
+	"时间\t\t\t|操作者\t\t|操作\t\t\t|对象\t\t\t\t\t|详细内容": "Time\t\t\t|Operator\t|Action\t\t\t|Target\t\t\t\t\t|Detail",
+
+	"不支持的备份版本: %d":         "Unsupported backup version: %d",
+	"两次输入的密码不一致":           "The passphrases do not match",
+	"加密备份错误: ":             "Failed to encrypt backup: ",
+	"升级数据库错误: ":            "Failed to migrate database: ",
+	"备份中的文件已损坏: ":          "File in backup is corrupted: ",
+	"备份中的私钥与清单不符":          "The private key in the backup does not match the manifest",
+	"备份中缺少文件: ":            "File missing from backup: ",
+	"备份密码不能为空":             "The backup passphrase must not be empty",
+	"备份已写入文件":              "Backup written",
+	"备份已恢复":                "Backup restored",
+	"备份格式错误: ":             "Malformed backup: ",
+	"备份签名校验失败: ":           "Backup signature verification failed: ",
+	"打包备份错误: ":             "Failed to pack backup: ",
+	"打开数据库错误: ":            "Failed to open database: ",
+	"数据库备份错误: ":            "Failed to back up database: ",
+	"文件已存在, 使用 force 覆盖: ": "File exists, use force to overwrite: ",
+	"本地已有数据, 恢复将覆盖数据库和密钥, 请使用 force 确认":                            "Local data exists and restoring would overwrite the database and keys, use force to confirm",
+	"解密备份错误, 请检查密码: ":                                              "Failed to decrypt backup, check the passphrase: ",
+	"请再次输入备份密码: ":                                                  "Enter the backup passphrase again: ",
+	"请输入备份密码: ":                                                    "Enter the backup passphrase: ",
+	"请通过 passphrase-file 或环境变量 OPENMPRDB_BACKUP_PASSPHRASE 指定备份密码": "Specify the backup passphrase with passphrase-file or the OPENMPRDB_BACKUP_PASSPHRASE environment variable",
+	"读取备份错误: ":                                                     "Failed to read backup: ",
+	"读取密码文件错误: ":                                                   "Failed to read passphrase file: ",
+	"读取密码错误: ":                                                     "Failed to read passphrase: ",
+	"连接数据库错误: ":                                                    "Failed to connect to database: ",
+	"(未设置)":                                                        "(unset)",
+	"必须大于 0":                                                       "must be greater than 0",
+	"未知的配置项: ":                                                     "Unknown setting: ",
+	"请指定 server_name 和 remote, 或在配置中设置 server.name 和 server.address": "Specify server_name and remote, or set server.name and server.address in the config",
+	"请指定信任等级 level, 或在配置中设置 trust.level":                             "Specify the trust level with level, or set trust.level in the config",
+	"请求中心服务器等的超时时间, 默认为 30s":                                         "Timeout of requests to central servers and others, 30s by default",
+	"读取配置文件错误: ":                                                     "Failed to read config file: ",
+	"配置已修改":                                                          "Setting changed",
+	"配置已删除":                                                          "Setting removed",
+	"配置文件中有未知的配置项, 已忽略":                                              "Ignored unknown setting in config file",
+	"配置文件中没有该配置项: ":                                                  "Setting not in config file: ",
+	"配置文件格式错误: ":                                                     "Malformed config file: ",
+	"配置文件的路径, 默认为数据库所在目录下的 config.yaml":                              "Path of the config file, config.yaml next to the database by default",
+	"配置项\t\t\t|来源\t\t|取值":                                            "Setting\t\t\t|Source\t\t|Value",
+	"配置项 %s 的取值无效: %s":                                               "Invalid value for setting %s: %s",
+	"配置项无效, 已忽略":                                                     "Ignored invalid setting",
+	"%s: 中心服务器上登记的公钥 %s 与本地保存的 %s 不一致":                               "%s: the key registered on the central server %s differs from the saved key %s",
+	"%s: 公钥已过期或被吊销, 无法验证签名":                                          "%s: the public key is expired or revoked and cannot verify signatures",
+	"%s: 导入的是私钥, 请只保存对方的公钥":                                          "%s: a private key was imported, only keep the other server's public key",
+	"%s: 已停用, 跳过":                                                    "%s: disabled, skipped",
+	"%s: 无法从中心服务器获取公钥: %s":                                           "%s: cannot fetch the public key from the central server: %s",
+	"%s: 无法解析公钥: %s":                                                 "%s: cannot parse the public key: %s",
+	"与数据库一致":                                                         "matches the database",
+	"与私钥匹配":                                                          "matches the private key",
+	"中心服务器上登记的公钥 %s 与本地的不一致":                                         "the key registered on the central server %s differs from the local key",
+	"公钥与私钥不匹配: ":                                                     "The public key does not match the private key: ",
+	"失败":                                                             "FAIL",
+	"密钥文件缺失或与数据库不一致: ":                                               "Key files missing or different from the database: ",
+	"尚未在任何中心服务器上注册, 请先执行 register":                                   "Not registered on any central server, run register first",
+	"已注册: %s":                                                        "registered: %s",
+	"数据库中保存的不是私钥":                                                    "The key stored in the database is not a private key",
+	"数据库中没有公钥":                                                       "No public key in the database",
+	"数据库中没有私钥":                                                       "No private key in the database",
+	"数据库已损坏: ":                                                       "The database is corrupted: ",
+	"数据库版本为 %d, 程序需要的版本为 %d":                                         "The database schema is version %d, the program needs version %d",
+	"无法解析私钥: ":                                                       "Cannot parse the private key: ",
+	"无法访问中心服务器 %s: %s":                                               "Cannot reach the central server %s: %s",
+	"检查项\t\t\t\t\t\t|状态\t|说明":                                        "Check\t\t\t\t\t\t|Status\t|Detail",
+	"正常":                                                             "OK",
+	"版本 %d":                                                          "version %d",
+	"私钥已过期或被吊销":                                                      "The private key is expired or revoked",
+	"警告":                                                             "WARN",
+	"\t\t服务器uuid\t\t|公钥指纹\t\t\t\t\t|权重":                              "\t\tServer uuid\t\t|Key fingerprint\t\t\t\t\t|Weight",
+	"不支持的报告版本: %d":                                                   "Unsupported report version: %d",
+	"参数: 阈值 %s, 信任深度 %d, 衰减系数 %g, 获取失败时 %s (sha256 %s)\n": "Parameters: threshold %s, trust depth %d, attenuation %g, on server error %s (sha256 %s)\n",
+	"已发布报告": "Report published",
+	"报告 %d 没有记录所用的输入, 请重新执行 update":              "Report %d has no recorded inputs, run update again",
+	"报告不是规范的JSON格式":                              "The report is not canonical JSON",
+	"报告中的服务器列表与摘要不符":                             "The server list in the report does not match its hash",
+	"报告中的玩家未按uuid排序或有重复":                         "The players in the report are not sorted by uuid or contain duplicates",
+	"报告中的评分参数与摘要不符":                              "The scoring parameters in the report do not match their hash",
+	"报告的 issuer %s 与签名者的公钥指纹 %s 不一致":             "The report's issuer %s differs from the signer's key fingerprint %s",
+	"报告验证通过":                                     "Report verified",
+	"提交: %d (sha256 %s)\n本地名单: %d (sha256 %s)\n": "Submissions: %d (sha256 %s)\nOverrides: %d (sha256 %s)\n",
+	"读取报告错误: ":                                   "Error reading the report: ",
+	"无法解析签名的报告: ":                                "Cannot parse the signed report: ",
+	"无法读取报告 %d 的输入: %s":                          "Cannot read the inputs of report %d: %s",
+	"服务器: %d (sha256 %s)\n":                      "Servers: %d (sha256 %s)\n",
+	"未找到公钥指纹为 %s 的信任的服务器, 请使用 pubkey 或 server 指定签名者": "No trusted server has the key fingerprint %s, specify the signer with pubkey or server",
+	"未指定":  "none",
+	"本服务器": "this server",
+	"签名者: %s\n公钥指纹: %s\n报告: %d (%s)\n玩家: %d, 其中被封禁: %d\n": "Signer: %s\nKey fingerprint: %s\nReport: %d (%s)\nPlayers: %d, banned: %d\n",
+	"签名验证失败: ":                          "Signature verification failed: ",
+	"评分不是有限的数值: ":                       "The points are not a finite number: ",
+	"没有使用相同阈值的上一次报告, 无法比较":              "There is no earlier report with the same threshold to compare with",
+	"报告 %d 与报告 %d 的阈值不同 (%s, %s), 无法比较": "Report %d and report %d use different thresholds (%s, %s) and cannot be compared",
+	"使用 template 时必须且只能指定一个 event":      "template requires exactly one event",
+	"指标服务监听失败: ":                        "Cannot listen for the metrics endpoint: ",
+	"新提交失败: %s; %s":                     "The new submission failed: %s; %s",
+	"原提交已重新发布为 %s, 但无法写入本地数据库: %s":      "The original submission was republished as %s, but the local database could not be updated: %s",
+	"新提交 %s 已发布, 但无法写入本地数据库: %s":        "The new submission %s was published, but the local database could not be updated: %s",
+	"本地没有公钥, 请使用 pubkey 指定签名备份的公钥":      "No local public key, specify the key that signed the backup with pubkey",
+	"%s (已使用本地公钥校验; 在新目录中恢复时, 请使用 pubkey 指定原服务器的公钥, 或使用 trust-embedded-key 信任备份中的公钥)": "%s (verified with our local public key; when restoring into a new directory, specify the original server's key with pubkey, or trust the key in the backup with trust-embedded-key)",
+	"已使用备份中的公钥校验签名, 只能保证备份未被篡改, 不能证明备份的来源":                                            "Verified the signature with the key in the backup; this only shows the backup is intact, not who made it",
+	"数据库文件不存在: ": "Database file not found: ",
+	"生成密钥错误: ":   "Failed to generate keys: ",
+	"报告 %d 没有指定封禁阈值, 无法发布, 请使用 less 参数重新执行 update": "Report %d has no ban threshold and cannot be published; run update again with less",
+	"报告没有指定封禁阈值":                        "The report has no ban threshold",
+	"服务器 %s 已在中心服务器 %s 下被信任":            "server %s is already trusted under central server %s",
+	"RCON 发送错误: ":                       "RCON send error: ",
+	"RCON 命令 %s 执行失败: %s, 其余 %d 条命令未执行": "RCON command %s failed: %s, %d remaining commands were not run",
+	"RCON 登录失败, 请检查密码":                  "RCON login failed, check the password",
+	"RCON 读取错误: ":                       "RCON read error: ",
+	"RCON 连接错误: ":                       "RCON connection error: ",
+	"已执行 RCON 命令":                       "RCON command executed",
+	"数据包长度异常: %d":                       "invalid packet length: %d",
+	"更新完成后通过 RCON 将新封禁和解除封禁的玩家推送到该游戏服务器, 例如 127.0.0.1:25575": "After updating, push newly banned and cleared players to this game server over RCON, e.g. 127.0.0.1:25575",
+	// 通知模板
+	`新封禁 {{len .Data}} 名玩家:{{range .Data}}
+{{.UUID}} ({{printf "%.1f" .Before}} -> {{printf "%.1f" .After}}){{end}}`: `{{len .Data}} players newly banned:{{range .Data}}
+{{.UUID}} ({{printf "%.1f" .Before}} -> {{printf "%.1f" .After}}){{end}}`,
+	`解除封禁 {{len .Data}} 名玩家:{{range .Data}}
+{{.UUID}} ({{printf "%.1f" .Before}} -> {{printf "%.1f" .After}}){{end}}`: `{{len .Data}} players cleared:{{range .Data}}
+{{.UUID}} ({{printf "%.1f" .Before}} -> {{printf "%.1f" .After}}){{end}}`,
+	`服务器 {{.Data.Name}}[{{.Data.UUID}}] 有 {{.Data.Rejected}} 条提交未通过校验, 请使用 list rejected 查看`:                `{{.Data.Rejected}} submissions of server {{.Data.Name}}[{{.Data.UUID}}] failed verification, see list rejected`,
+	`已向中心服务器 {{.Data.Instance}} 提交玩家 {{.Data.Player}} 的评分 {{printf "%.1f" .Data.Point}}: {{.Data.Comment}}`: `Submitted point {{printf "%.1f" .Data.Point}} for player {{.Data.Player}} to central server {{.Data.Instance}}: {{.Data.Comment}}`,
+	`已撤回中心服务器 {{.Data.Instance}} 上的提交 {{.Data.UUID}}: {{.Data.Comment}}`:                                    `Revoked submission {{.Data.UUID}} on central server {{.Data.Instance}}: {{.Data.Comment}}`,
+	`这是一条来自 OpenMPRDB-CLI 的测试消息`:                                                                            `This is a test message from OpenMPRDB-CLI`,
+}
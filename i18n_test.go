@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+// setLocale 设置语言相关的环境变量, 测试结束后恢复
+func setLocale(t *testing.T, values map[string]string) {
+	t.Helper()
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		old, ok := os.LookupEnv(env)
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(env, old)
+			} else {
+				os.Unsetenv(env)
+			}
+		})
+		os.Setenv(env, values[env])
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	for value, want := range map[string]string{
+		"zh": LangZhCN, "zh_CN.UTF-8": LangZhCN, "zh-TW": LangZhCN, "ZH-cn": LangZhCN,
+		"en": LangEnUS, "en_US": LangEnUS, "en_GB.UTF-8": LangEnUS,
+		"": "", "C": "", "C.UTF-8": "", "ja_JP": "",
+	} {
+		if got := normalizeLanguage(value); got != want {
+			t.Errorf("normalizeLanguage(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{name: "default", want: LangZhCN},
+		{name: "LANG", env: map[string]string{"LANG": "en_US.UTF-8"}, want: LangEnUS},
+		{name: "LC_ALL before LANG", env: map[string]string{"LC_ALL": "zh_CN.UTF-8", "LANG": "en_US.UTF-8"}, want: LangZhCN},
+		{name: "LC_MESSAGES before LANG", env: map[string]string{"LC_MESSAGES": "en_US", "LANG": "zh_CN"}, want: LangEnUS},
+		{name: "unknown locale", env: map[string]string{"LC_ALL": "C", "LANG": "en_US"}, want: LangEnUS},
+		{name: "flag", args: []string{"--lang", "en", "update"}, env: map[string]string{"LANG": "zh_CN"}, want: LangEnUS},
+		{name: "flag with equals", args: []string{"-lang=en-US", "list"}, want: LangEnUS},
+		{name: "flag after other global flags", args: []string{"--quiet", "--log-level", "debug", "--lang", "en", "update"}, want: LangEnUS},
+		// 取值不会被当作子命令, 也不会被当作 lang
+		{name: "value of another flag", args: []string{"--operator", "--lang", "update"}, env: map[string]string{"LANG": "en_US"}, want: LangEnUS},
+		{name: "config value named lang", args: []string{"--config", "lang", "--lang", "en"}, want: LangEnUS},
+		{name: "flag of a subcommand", args: []string{"update", "--lang", "en"}, want: LangZhCN},
+		{name: "invalid flag falls back to env", args: []string{"--lang", "fr"}, env: map[string]string{"LANG": "en_US"}, want: LangEnUS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setLocale(t, tt.env)
+			if got := detectLanguage(tt.args); got != tt.want {
+				t.Errorf("detectLanguage(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestT(t *testing.T) {
+	old := language
+	defer func() { language = old }()
+
+	language = LangEnUS
+	if got := T("报告已保存"); got != "Report saved" {
+		t.Errorf("T() in en-US = %q", got)
+	}
+	language = LangZhCN
+	if got := T("报告已保存"); got != "报告已保存" {
+		t.Errorf("T() in zh-CN = %q", got)
+	}
+	// 没有译文时原样输出
+	if got := translate(LangEnUS, "no such message"); got != "no such message" {
+		t.Errorf("translate() of an unknown message = %q", got)
+	}
+}
+
+// TestCatalogueVerbs 译文中的格式化动词必须与原文一致, 否则 Printf 的输出会错位
+func TestCatalogueVerbs(t *testing.T) {
+	verbs := regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+	for lang, catalogue := range catalogues {
+		for msg, translation := range catalogue {
+			want, got := verbs.FindAllString(msg, -1), verbs.FindAllString(translation, -1)
+			if len(want) != len(got) {
+				t.Errorf("%s: %q -> %q changes the format verbs", lang, msg, translation)
+				continue
+			}
+			for i := range want {
+				if want[i] != got[i] {
+					t.Errorf("%s: %q -> %q changes the format verbs", lang, msg, translation)
+					break
+				}
+			}
+		}
+	}
+}
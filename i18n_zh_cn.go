@@ -0,0 +1,143 @@
+package main
+
+// zhCN 简体中文译文, 键为源码中的英文消息
+var zhCN = map[string]string{
+	"Add a notification target.":                                                         "添加通知目标",
+	"Add a player to the list.":                                                          "将玩家加入名单",
+	"Add player popularity data.":                                                        "提交玩家声望数据",
+	"Address of the metrics endpoint.":                                                   "指标服务的地址",
+	"Also show the signing time, operator and the signed message.":                       "同时列出签名时间, 操作者和签名后的原始内容",
+	"Sort by time, point or player.":                                                     "排序方式: time(签名时间), point(评分), player(玩家)",
+	"Sort in descending order.":                                                          "降序排列",
+	"Show at most this many submissions, 0 for all.":                                     "最多列出的条数, 0 表示全部",
+	"Skip this many submissions, for paging together with limit.":                        "跳过的条数, 与 limit 一起用于分页",
+	"Only print the number of matching submissions.":                                     "只输出符合条件的提交数量",
+	"Only submissions for this player uuid.":                                             "只包括该玩家的提交",
+	"Only submissions signed at or after this time, e.g. 2006-01-02 or 7d (7 days ago).": "只包括在该时间及之后签名的提交, 例如 2006-01-02 或 7d (7天前)",
+	"Only submissions signed at or before this time, e.g. 2006-01-02 (the end of that day) or 12h (12 hours ago).": "只包括在该时间及之前签名的提交, 例如 2006-01-02 (当天结束) 或 12h (12小时前)",
+	"Only submissions with a point less than this value.":                                                          "只包括评分小于该值的提交",
+	"Only submissions with a point greater than this value.":                                                       "只包括评分大于该值的提交",
+	"Only submissions whose comment contains this text, case-insensitive.":                                         "只包括理由中包含该文本的提交, 不区分大小写",
+	"Look up what we know about players.":                                                                          "查询本地已知的玩家信息",
+	"Show our submissions, partner submissions, score, overrides and ban status of a player.":                      "列出玩家的本服务器提交, 信任的服务器的提交, 评分, 本地名单和封禁状态",
+	"Output as JSON.": "以JSON格式输出",
+	"Replace a past submission with a corrected point or comment.":                        "以修改后的评分或理由替代过去的提交",
+	"New point, unchanged by default.":                                                    "新的评分, 默认不变",
+	"New comment, unchanged by default.":                                                  "新的理由, 默认不变",
+	"Comment of the revocation of the old submission.":                                    "撤回原提交时的理由",
+	"Delete all local submissions matching the filter options instead of one submission.": "撤回所有符合筛选条件的本地提交, 而不是一条提交",
+	"Delete without asking for confirmation.":                                             "不经确认直接撤回",
+	"Only submissions made by this operator.":                                             "只包括该操作者的提交",
+	"Also delete the cached and rejected submissions of the server.":                      "同时删除该服务器的缓存数据和被拒绝的提交",
+	"Change the trust level of a server.":                                                 "修改服务器的信任等级",
+	"Compare the latest report with \"last\" (the one before it) or a report id.":         "与最近一次报告比较的报告, \"last\" 表示上一次, 也可以是报告编号",
+	"Delete the reason for the submission.":                                               "撤回提交的理由",
+	"Delete the specified past submission.":                                               "撤回指定的提交",
+	"Fetch the public key of a server from the central server and trust it.":              "从中心服务器获取服务器的公钥并信任",
+	"Import and trust server-specific data.":                                              "导入其他服务器的公钥并信任",
+	"List submissions from trusted servers that were rejected.":                           "列出信任的服务器被拒绝的提交",
+	"List the central servers and our registration on each.":                              "列出中心服务器及本服务器在其上的注册信息",
+	"List the history of the submission.":                                                 "列出提交记录",
+	"List the notification targets.":                                                      "列出通知目标",
+	"List the players on the list.":                                                       "列出名单中的玩家",
+	"List the servers registered on the central server.":                                  "列出在中心服务器上登记的服务器",
+	"Local name of the central server, used to refer to it later.":                        "中心服务器在本地的名称, 之后用于指定该中心服务器",
+	"Make a list of trusted servers.":                                                     "列出信任的服务器",
+	"Manage players that are always banned, whatever their score.":                        "管理强制封禁的玩家, 无论评分如何",
+	"Manage players that are never banned, whatever their score.":                         "管理放行的玩家, 无论评分如何",
+	"Manage the central servers this server is registered on.":                            "管理本服务器注册的中心服务器",
+	"Manage trust statements for transitive trust.":                                       "管理用于间接信任的信任声明",
+	"Manage trusted servers.":                                                             "管理信任的服务器",
+	"Manage webhook and Discord notifications.":                                           "管理 webhook 和 Discord 通知",
+	"Name of the target.":                                                                 "通知目标的名称",
+	"New server name.":                                                                    "新的服务器名称",
+	"Only list score changes at least this large.":                                        "只列出评分变化不小于该值的玩家",
+	"Only list the submissions of the specified server uuid.":                             "只列出指定服务器的提交",
+	"Only send these events, can be repeated. (%s) All events by default.":                "只发送指定的事件, 可重复指定. (%s) 默认发送所有事件",
+	"Path of the statement file.":                                                         "信任声明的文件路径",
+	"Public key path.":                                                                    "公钥路径",
+	"Register this server on the central server.":                                         "在中心服务器上注册本服务器",
+	"Remove a notification target.":                                                       "删除通知目标",
+	"Remove a player from the list.":                                                      "将玩家移出名单",
+	"Rename a server.":                                                                    "重命名服务器",
+	"Run update periodically and expose Prometheus metrics on /metrics.":                  "定期执行 update, 并在 /metrics 上提供 Prometheus 指标",
+	"Send a test message to a notification target.":                                       "向通知目标发送测试消息",
+	"Server name": "服务器名称",
+	"Server name, defaults to the name on the central server.": "服务器名称, 默认使用中心服务器上登记的名称",
+	"Server uuid": "服务器uuid",
+	"Set the address where a server publishes its trust statement.":                                  "设置服务器发布信任声明的地址",
+	"Show who was newly banned, who was cleared and whose score changed.":                            "列出新封禁, 解除封禁和评分变化的玩家",
+	"Specify the player's uuid.":                                                                     "玩家的uuid",
+	"Specify the submitted uuid.":                                                                    "提交的操作uuid",
+	"Stop trusting a server and remove its public key.":                                              "不再信任服务器, 并删除其公钥",
+	"Temporarily ignore the data of a server.":                                                       "暂时停用服务器的数据",
+	"The central server of the submission, if it is not in the local database.":                      "提交所在的中心服务器, 本地数据库中没有记录时使用",
+	"The central server the server is registered on.":                                                "该服务器所在的中心服务器",
+	"The central server to query.":                                                                   "要查询的中心服务器",
+	"The central server whose identity signs the statement.":                                         "以本服务器在哪个中心服务器上的身份签发声明",
+	"The central servers to submit to, can be repeated.":                                             "提交到的中心服务器, 可重复指定",
+	"The reason for doing so.":                                                                       "理由",
+	"Time between two updates.":                                                                      "两次更新的间隔",
+	"Trust level. (1 ~ 5)":                                                                           "信任等级 (1 ~ 5)",
+	"Trust statement address, empty to clear.":                                                       "信任声明的地址, 为空时清除",
+	"Trust the key without asking for confirmation.":                                                 "不经确认直接信任该公钥",
+	"Use the data of a disabled server again.":                                                       "重新启用服务器的数据",
+	"Webhook address.":                                                                               "Webhook 地址",
+	"When the entry expires, e.g. 30d, 12h or 2006-01-02. Never expires by default.":                 "过期时间, 例如 30d, 12h 或 2006-01-02, 默认永不过期",
+	"Write a signed statement of the servers we trust, for others to fetch.":                         "生成签名的信任声明, 列出本服务器信任的服务器, 供其他服务器获取",
+	"webhook (generic JSON) or discord.":                                                             "webhook (通用JSON) 或 discord",
+	"Inspect the audit log of local actions.":                                                        "查看本地操作的审计日志",
+	"List the audit log, oldest first.":                                                              "按时间顺序列出审计日志",
+	"Only actions at or after this time, e.g. 2006-01-02 or 7d (7 days ago).":                        "只显示该时间及之后的操作, 例如 2006-01-02 或 7d (7天前)",
+	"Only actions at or before this time, e.g. 2006-01-02 or 12h (12 hours ago).":                    "只显示该时间及之前的操作, 例如 2006-01-02 或 12h (12小时前)",
+	"Only actions of this operator.":                                                                 "只显示该操作者的操作",
+	"Only actions on this submission, server or player uuid.":                                        "只显示对该提交, 服务器或玩家uuid的操作",
+	"Only the latest N actions.":                                                                     "只显示最新的N条操作",
+	"Only this action, or actions starting with it, e.g. server or submission.new.":                  "只显示该操作, 或以其开头的操作, 例如 server 或 submission.new",
+	"Back up and restore the database and keys.":                                                     "备份和恢复数据库及密钥",
+	"Overwrite the backup file if it exists.":                                                        "备份文件已存在时覆盖",
+	"Overwrite the existing database and keys.":                                                      "覆盖本地已有的数据库和密钥",
+	"Path of the backup file.":                                                                       "备份文件的路径",
+	"Read the passphrase from this file instead of OPENMPRDB_BACKUP_PASSPHRASE or the terminal.":     "从该文件读取密码, 而不是环境变量 OPENMPRDB_BACKUP_PASSPHRASE 或终端",
+	"Verify a backup and restore it.":                                                                "校验并恢复备份",
+	"Write a passphrase-encrypted backup signed with our key.":                                       "生成使用密码加密, 并由本服务器密钥签名的备份",
+	"List all settings with their effective value and where it comes from.":                          "列出所有配置项的当前取值及其来源",
+	"Print the effective value of a setting.":                                                        "输出配置项的当前取值",
+	"Remove a setting from the config file.":                                                         "从配置文件中删除配置项",
+	"Set a setting in the config file.":                                                              "在配置文件中设置配置项",
+	"Show and change the settings in the config file.":                                               "查看和修改配置文件中的配置",
+	"The address of the server, defaults to server.address in the config or the registered address.": "中心服务器的地址, 默认使用配置中的 server.address 或已注册的地址",
+	"The name of the server, defaults to server.name in the config or the registered name.":          "本服务器的名称, 默认使用配置中的 server.name 或已注册的名称",
+	"Trust level. (1 ~ 5), defaults to trust.level in the config.":                                   "信任等级 (1 ~ 5), 默认使用配置中的 trust.level",
+	"flag":    "参数",
+	"env":     "环境变量",
+	"file":    "配置文件",
+	"db":      "数据库",
+	"default": "默认值",
+	"Check the database, keys, registration and trusted servers; exits 0 ok, 1 warning, 2 failure.":                                                     "检查数据库, 密钥, 注册状态和信任的服务器; 正常时退出码为0, 警告为1, 失败为2.",
+	"Skip the checks that contact the central servers.":                                                                                                 "跳过需要访问中心服务器的检查.",
+	"Inspect, publish and verify the reports saved by update.":                                                                                          "查看, 发布和验证 update 保存的报告",
+	"Public key of the publisher, defaults to the trusted server matching the report's issuer.":                                                         "发布者的公钥, 默认使用与报告的 issuer 匹配的信任的服务器",
+	"Publish this report instead of the latest one.":                                                                                                    "发布指定编号的报告, 而不是最近一次报告",
+	"Uuid of the trusted server that published the report.":                                                                                             "发布该报告的信任的服务器的uuid",
+	"Verify a report published by another server.":                                                                                                      "验证其他服务器发布的报告",
+	"Write a canonical JSON report with the hashes of its inputs, clearsigned with our key.":                                                            "输出规范的JSON报告及其输入的摘要, 并使用本服务器的私钥签名",
+	"Write the signed report to this file instead of stdout.":                                                                                           "将签名后的报告写入该文件, 而不是标准输出",
+	"Write the verified JSON report to this file.":                                                                                                      "将验证通过的JSON报告写入该文件",
+	"Message template in Go text/template syntax, with .Name, .Time and .Data. Requires exactly one event.":                                             "消息模板, 使用 Go 的 text/template 语法, 可以使用 .Name, .Time 和 .Data. 必须且只能指定一个 event",
+	"Public key that must have signed the backup, defaults to our current public key.":                                                                  "用于校验备份签名的公钥, 默认使用本地当前的公钥",
+	"Verify the backup with the public key inside it, e.g. when restoring into a new directory. This only detects corruption, not who made the backup.": "使用备份中的公钥校验签名, 例如在新目录中恢复时. 只能发现备份损坏, 不能证明备份的来源",
+	"Database file not found: ":                                                                                                                         "数据库文件不存在: ",
+	"Failed to generate keys: ":                                                                                                                         "生成密钥错误: ",
+	"Report %d has no ban threshold and cannot be published; run update again with less":                                                                "报告 %d 没有指定封禁阈值, 无法发布, 请使用 less 参数重新执行 update",
+	"The report has no ban threshold":                                                                                                                   "报告没有指定封禁阈值",
+	"server %s is already trusted under central server %s":                                                                                              "服务器 %s 已在中心服务器 %s 下被信任",
+	"RCON send error: ": "RCON 发送错误: ",
+	"RCON command %s failed: %s, %d remaining commands were not run": "RCON 命令 %s 执行失败: %s, 其余 %d 条命令未执行",
+	"RCON login failed, check the password":                          "RCON 登录失败, 请检查密码",
+	"RCON read error: ":                                              "RCON 读取错误: ",
+	"RCON connection error: ":                                        "RCON 连接错误: ",
+	"RCON command executed":                                          "已执行 RCON 命令",
+	"invalid packet length: %d":                                      "数据包长度异常: %d",
+	"After updating, push newly banned and cleared players to this game server over RCON, e.g. 127.0.0.1:25575": "更新完成后通过 RCON 将新封禁和解除封禁的玩家推送到该游戏服务器, 例如 127.0.0.1:25575",
+}
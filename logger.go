@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level 日志级别
+type Level int
+
+// 日志级别, 低于当前级别的日志不会输出
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levelNames 日志级别的名称
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+// parseLevel 解析日志级别的名称
+func parseLevel(name string) (Level, error) {
+	for level, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf(T("未知的日志级别: %s (可选 debug, info, warn, error)"), name)
+}
+
+// 日志的输出格式
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Field 日志中的一个字段, 例如 server_uuid, submission_uuid
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F 创建一个日志字段
+func F(key string, value interface{}) Field {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	return Field{key, value}
+}
+
+// Logger 带级别和字段的日志
+type Logger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  Level
+	format string
+	// lang 日志消息的语言, 为空时与界面语言相同
+	lang string
+}
+
+// logger 全局日志对象, 默认值可以通过环境变量设置, 命令行参数会覆盖环境变量
+var logger = newLogger()
+
+// newLogger 根据环境变量创建日志对象
+func newLogger() *Logger {
+	l := &Logger{out: os.Stderr, level: LevelInfo, format: LogFormatText}
+	if level, err := parseLevel(os.Getenv("OPENMPRDB_LOG_LEVEL")); err == nil {
+		l.level = level
+	}
+	if os.Getenv("OPENMPRDB_LOG_FORMAT") == LogFormatJSON {
+		l.format = LogFormatJSON
+	}
+	l.lang = normalizeLanguage(os.Getenv("OPENMPRDB_LOG_LANG"))
+	return l
+}
+
+// configure 设置日志级别, 格式和语言
+func (l *Logger) configure(level, format, lang string) error {
+	lv, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	err = checkLogFormat(format)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = lv
+	l.format = format
+	l.lang = normalizeLanguage(lang)
+	return nil
+}
+
+// translate 将消息翻译为日志语言
+func (l *Logger) translate(msg string) string {
+	if l.lang == "" {
+		return T(msg)
+	}
+	return translate(l.lang, msg)
+}
+
+// log 输出一条日志
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+	msg = l.translate(msg)
+	now := time.Now()
+
+	if l.format == LogFormatJSON {
+		entry := map[string]interface{}{
+			"time":  now.Format(time.RFC3339),
+			"level": levelNames[level],
+			"msg":   msg,
+		}
+		for _, f := range fields {
+			entry[f.Key] = f.Value
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			data = []byte(fmt.Sprintf(`{"level":"error","msg":%q}`, err.Error()))
+		}
+		fmt.Fprintln(l.out, string(data))
+		return
+	}
+
+	line := fmt.Sprintf("%s %-5s %s", now.Format("2006/01/02 15:04:05"), strings.ToUpper(levelNames[level]), msg)
+	for _, f := range fields {
+		value := fmt.Sprint(f.Value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		line += " " + f.Key + "=" + value
+	}
+	fmt.Fprintln(l.out, line)
+}
+
+// Debug 输出调试日志
+func (l *Logger) Debug(msg string, fields ...Field) { l.log(LevelDebug, msg, fields) }
+
+// Info 输出一般日志
+func (l *Logger) Info(msg string, fields ...Field) { l.log(LevelInfo, msg, fields) }
+
+// Warn 输出警告
+func (l *Logger) Warn(msg string, fields ...Field) { l.log(LevelWarn, msg, fields) }
+
+// Error 输出错误
+func (l *Logger) Error(msg string, fields ...Field) { l.log(LevelError, msg, fields) }
+
+// Fatal 输出错误并退出
+func (l *Logger) Fatal(msg string, fields ...Field) {
+	l.log(LevelError, msg, fields)
+	os.Exit(1)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newTestLogger 创建一个输出到缓冲区的日志对象
+func newTestLogger(t *testing.T, level, format, lang string) (*Logger, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	l := &Logger{out: &buf}
+	err := l.configure(level, format, lang)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, &buf
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "Warn": LevelWarn, "error": LevelError} {
+		got, err := parseLevel(name)
+		if err != nil || got != want {
+			t.Errorf("parseLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"", "warning", "trace"} {
+		if _, err := parseLevel(name); err == nil {
+			t.Errorf("parseLevel(%q) succeeded", name)
+		}
+	}
+}
+
+func TestLoggerConfigure(t *testing.T) {
+	l := &Logger{}
+	for _, tt := range [][3]string{{"verbose", LogFormatText, ""}, {"info", "xml", ""}} {
+		if l.configure(tt[0], tt[1], tt[2]) == nil {
+			t.Errorf("configure(%q, %q) succeeded", tt[0], tt[1])
+		}
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	l, buf := newTestLogger(t, "warn", LogFormatText, LangEnUS)
+	l.Debug("debug")
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "WARN  warn") || !strings.Contains(lines[1], "ERROR error") {
+		t.Errorf("output at warn level = %q", buf.String())
+	}
+}
+
+func TestLoggerText(t *testing.T) {
+	l, buf := newTestLogger(t, "debug", LogFormatText, LangEnUS)
+	l.Info("报告已保存", F("run_id", 3), F("path", "/tmp/a b"), F("note", ""), F("error", errors.New(`bad "key"`)))
+	want := ` INFO  Report saved run_id=3 path="/tmp/a b" note="" error="bad \"key\""` + "\n"
+	if got := buf.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("text output = %q, want suffix %q", got, want)
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{lang: LangEnUS, want: "Report saved"},
+		{lang: LangZhCN, want: "报告已保存"},
+		// 未指定时与界面语言相同
+		{lang: "", want: T("报告已保存")},
+	}
+	for _, tt := range tests {
+		l, buf := newTestLogger(t, "info", LogFormatJSON, tt.lang)
+		l.Warn("报告已保存", F("run_id", 3), F("error", errors.New("timeout")))
+		var entry map[string]interface{}
+		err := json.Unmarshal(buf.Bytes(), &entry)
+		if err != nil {
+			t.Fatalf("output %q is not JSON: %v", buf.String(), err)
+		}
+		if entry["level"] != "warn" || entry["msg"] != tt.want || entry["run_id"] != float64(3) || entry["error"] != "timeout" || entry["time"] == nil {
+			t.Errorf("lang %q: JSON output = %s", tt.lang, buf.String())
+		}
+	}
+}
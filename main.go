@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	"log"
 	"net/http"
 	"os"
 
@@ -17,6 +21,12 @@ import (
 var SqlPath string = "./OpenMPRDB.db"
 var bar *progressbar.ProgressBar
 
+// quiet 为true时不显示进度条
+var quiet bool
+
+// operatorName 通过 operator 参数指定的操作者, 为空时见 currentOperator
+var operatorName string
+
 func init() {
 
 }
@@ -24,232 +34,1162 @@ func init() {
 func main() {
 	app := &cli.App{
 		Name:  "OpenMPRDB-CLI",
-		Usage: "一个简陋的客户端",
+		Usage: T("一个简陋的客户端"),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Usage:   T("配置文件的路径, 默认为数据库所在目录下的 config.yaml"),
+				EnvVars: []string{"OPENMPRDB_CONFIG"},
+			},
+			&cli.StringFlag{
+				Name:  "log-level",
+				Usage: T("日志级别: debug, info, warn, error"),
+			},
+			&cli.StringFlag{
+				Name:  "log-format",
+				Usage: T("日志格式: text, json"),
+			},
+			&cli.StringFlag{
+				Name:  "lang",
+				Usage: T("界面语言: zh-CN, en-US, 默认根据 LANG 环境变量确定"),
+				Value: language,
+			},
+			&cli.StringFlag{
+				Name:  "log-lang",
+				Usage: T("日志语言: zh-CN, en-US, 默认与界面语言相同"),
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   T("不显示进度条"),
+			},
+			&cli.StringFlag{
+				Name:  "operator",
+				Usage: T("操作者的名称, 记录在提交和审计日志中, 默认为系统用户名"),
+			},
+			&cli.DurationFlag{
+				Name:  "http-timeout",
+				Usage: T("请求中心服务器等的超时时间, 默认为 30s"),
+			},
+		},
+		Before: func(c *cli.Context) error {
+			if normalizeLanguage(c.String("lang")) == "" {
+				return fmt.Errorf(T("未知的语言: %s (可选 zh-CN, en-US)"), c.String("lang"))
+			}
+			language = normalizeLanguage(c.String("lang"))
+			if c.String("config") != "" {
+				ConfigPath = c.String("config")
+			}
+			err := loadConfig(ConfigPath)
+			if err != nil {
+				return err
+			}
+			quiet = c.Bool("quiet")
+			operatorName = strings.TrimSpace(settingString(c, "operator"))
+			httpClient.Timeout, err = settingDuration(c, "http.timeout")
+			if err != nil {
+				return err
+			}
+			var log [3]string
+			for i, key := range []string{"log.level", "log.format", "log.lang"} {
+				log[i], err = settingValue(c, key)
+				if err != nil {
+					return err
+				}
+			}
+			err = logger.configure(log[0], log[1], log[2])
+			if err != nil {
+				return err
+			}
+			// doctor 自行以只读方式打开数据库, 不能在检查前创建或升级数据库
+			if c.Args().First() == "doctor" {
+				return nil
+			}
+			return prepareDB()
+		},
 		Commands: []*cli.Command{
 			{
 				Name:  "update",
-				Usage: "更新信誉信息",
+				Usage: T("更新信誉信息"),
+				Flags: updateFlags(),
+				Action: func(c *cli.Context) error {
+					// Ctrl-C 时取消尚未完成的请求
+					ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+
+					// 显示一个进度条, 防止时间过长
+					if quiet {
+						bar = progressbar.DefaultSilent(0)
+					} else {
+						bar = progressbar.Default(1)
+						bar.ChangeMax(0)
+					}
+					opts, err := updateOptions(c)
+					if err != nil {
+						return err
+					}
+					return runUpdate(ctx, opts)
+				},
+			},
+			{
+				Name:  "daemon",
+				Usage: T("Run update periodically and expose Prometheus metrics on /metrics."),
+				Flags: append(updateFlags(),
+					&cli.StringFlag{
+						Name:        "listen",
+						Usage:       T("Address of the metrics endpoint."),
+						DefaultText: ":9477",
+					},
+					&cli.DurationFlag{
+						Name:        "interval",
+						Usage:       T("Time between two updates."),
+						DefaultText: "1h",
+					},
+				),
+				Action: func(c *cli.Context) error {
+					ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					interval, err := settingDuration(c, "daemon.interval")
+					if err != nil {
+						return err
+					}
+					if interval <= 0 {
+						return errors.New(T("interval 必须大于 0"))
+					}
+					opts, err := updateOptions(c)
+					if err != nil {
+						return err
+					}
+
+					listen := settingString(c, "daemon.listen")
+					server, err := serveMetrics(listen)
+					if err != nil {
+						return err
+					}
+					defer server.Close()
+					logger.Info("指标服务已启动", F("listen", listen), F("interval", interval))
+
+					ticker := time.NewTicker(interval)
+					defer ticker.Stop()
+					for {
+						bar = progressbar.DefaultSilent(0)
+						err := runUpdate(ctx, opts)
+						if err != nil {
+							// 单次更新失败不会退出, 等待下一次更新
+							logger.Error("更新失败", F("error", err))
+						}
+						select {
+						case <-ctx.Done():
+							return nil
+						case <-ticker.C:
+						}
+					}
+				},
+			},
+			{
+				Name:  "list",
+				Usage: T("列出一些东西，例如提交历史..."),
+				Subcommands: []*cli.Command{
+					{
+						Name:    "submission",
+						Usage:   T("List the history of the submission."),
+						Aliases: []string{"sub"},
+						Flags: append(submissionFilterFlags(),
+							&cli.StringFlag{
+								Name:  "sort",
+								Usage: T("Sort by time, point or player."),
+								Value: SortTime,
+							},
+							&cli.BoolFlag{
+								Name:  "desc",
+								Usage: T("Sort in descending order."),
+							},
+							&cli.IntFlag{
+								Name:  "limit",
+								Usage: T("Show at most this many submissions, 0 for all."),
+							},
+							&cli.IntFlag{
+								Name:  "offset",
+								Usage: T("Skip this many submissions, for paging together with limit."),
+							},
+							&cli.BoolFlag{
+								Name:  "count",
+								Usage: T("Only print the number of matching submissions."),
+							},
+							&cli.BoolFlag{
+								Name:  "verbose",
+								Usage: T("Also show the signing time, operator and the signed message."),
+							},
+						),
+						Action: func(c *cli.Context) error {
+							filter, err := submissionFilter(c)
+							if err != nil {
+								return err
+							}
+							filter.sort = c.String("sort")
+							filter.desc = c.Bool("desc")
+							filter.limit = c.Int("limit")
+							filter.offset = c.Int("offset")
+							err = submissionList(filter, c.Bool("verbose"), c.Bool("count"))
+							if err != nil {
+								return err
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "server",
+						Usage: T("Make a list of trusted servers."),
+						Action: func(c *cli.Context) error {
+							// 这里列出server表的内容
+							err := listServers()
+							if err != nil {
+								return err
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "rejected",
+						Usage: T("List submissions from trusted servers that were rejected."),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "server",
+								Usage: T("Only list the submissions of the specified server uuid."),
+							},
+						},
+						Action: func(c *cli.Context) error {
+							err := listRejections(c.String("server"))
+							if err != nil {
+								return err
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "import",
+				Usage: T("Import and trust server-specific data."),
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:  "export",
-						Usage: "更新完成后将结果导出到文件中",
-						Value: "",
+						Name:     "pubkey",
+						Usage:    T("Public key path."),
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "uuid",
+						Usage:    T("Server uuid"),
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:  "level",
+						Usage: T("Trust level. (1 ~ 5), defaults to trust.level in the config."),
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: T("Server name"),
+						Value: "Kuroneko",
+					},
+					instanceFlag("The central server the server is registered on."),
+				},
+				Action: func(c *cli.Context) error {
+					level, err := trustLevel(c)
+					if err != nil {
+						return err
+					}
+					// 将相应的信息存入数据库
+					err = trustServer(c.String("instance"), c.String("uuid"), c.String("name"), c.String("pubkey"), level)
+					if err != nil {
+						return err
+					}
+					logger.Info("信任服务器成功, 已存储对应的公钥", F("server_uuid", c.String("uuid")))
+					return nil
+				},
+			},
+			{
+				Name:  "server",
+				Usage: T("Manage trusted servers."),
+				Subcommands: []*cli.Command{
+					{
+						Name:  "discover",
+						Usage: T("List the servers registered on the central server."),
+						Flags: []cli.Flag{
+							instanceFlag("The central server to query."),
+						},
+						Action: func(c *cli.Context) error {
+							err := discoverServers(c.String("instance"))
+							if err != nil {
+								return err
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "trust",
+						Usage:     T("Fetch the public key of a server from the central server and trust it."),
+						ArgsUsage: "<server uuid>",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:  "level",
+								Usage: T("Trust level. (1 ~ 5), defaults to trust.level in the config."),
+							},
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: T("Server name, defaults to the name on the central server."),
+							},
+							&cli.BoolFlag{
+								Name:  "yes",
+								Usage: T("Trust the key without asking for confirmation."),
+							},
+							instanceFlag("The central server the server is registered on."),
+						},
+						Action: func(c *cli.Context) error {
+							uuid, err := firstArg(c, "server uuid")
+							if err != nil {
+								return err
+							}
+							level, err := trustLevel(c)
+							if err != nil {
+								return err
+							}
+							err = trustRemoteServer(c.String("instance"), uuid, c.String("name"), level, c.Bool("yes"))
+							if err != nil {
+								return err
+							}
+							logger.Info("信任服务器成功, 已存储对应的公钥", F("server_uuid", uuid))
+							return nil
+						},
+					},
+					{
+						Name:      "set-level",
+						Usage:     T("Change the trust level of a server."),
+						ArgsUsage: "<server uuid>",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:     "level",
+								Usage:    T("Trust level. (1 ~ 5)"),
+								Required: true,
+							},
+						},
+						Action: func(c *cli.Context) error {
+							uuid, err := firstArg(c, "server uuid")
+							if err != nil {
+								return err
+							}
+							err = setServerLevel(uuid, c.Int("level"))
+							if err != nil {
+								return err
+							}
+							audit(AuditServerUpdate, uuid, map[string]interface{}{"level": c.Int("level")})
+							logger.Info("服务器的信任等级已修改", F("server_uuid", uuid), F("level", c.Int("level")))
+							return nil
+						},
+					},
+					{
+						Name:      "rename",
+						Usage:     T("Rename a server."),
+						ArgsUsage: "<server uuid>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    T("New server name."),
+								Required: true,
+							},
+						},
+						Action: func(c *cli.Context) error {
+							uuid, err := firstArg(c, "server uuid")
+							if err != nil {
+								return err
+							}
+							err = updateServer(uuid, "server_name", c.String("name"))
+							if err != nil {
+								return err
+							}
+							audit(AuditServerUpdate, uuid, map[string]interface{}{"name": c.String("name")})
+							logger.Info("服务器已重命名", F("server_uuid", uuid), F("name", c.String("name")))
+							return nil
+						},
+					},
+					{
+						Name:      "disable",
+						Usage:     T("Temporarily ignore the data of a server."),
+						ArgsUsage: "<server uuid>",
+						Action: func(c *cli.Context) error {
+							uuid, err := firstArg(c, "server uuid")
+							if err != nil {
+								return err
+							}
+							err = updateServer(uuid, "disabled", true)
+							if err != nil {
+								return err
+							}
+							audit(AuditServerUpdate, uuid, map[string]interface{}{"disabled": true})
+							logger.Info("服务器已停用", F("server_uuid", uuid))
+							return nil
+						},
+					},
+					{
+						Name:      "enable",
+						Usage:     T("Use the data of a disabled server again."),
+						ArgsUsage: "<server uuid>",
+						Action: func(c *cli.Context) error {
+							uuid, err := firstArg(c, "server uuid")
+							if err != nil {
+								return err
+							}
+							err = updateServer(uuid, "disabled", false)
+							if err != nil {
+								return err
+							}
+							audit(AuditServerUpdate, uuid, map[string]interface{}{"disabled": false})
+							logger.Info("服务器已启用", F("server_uuid", uuid))
+							return nil
+						},
+					},
+					{
+						Name:      "set-trust-url",
+						Usage:     T("Set the address where a server publishes its trust statement."),
+						ArgsUsage: "<server uuid>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "url",
+								Usage:    T("Trust statement address, empty to clear."),
+								Required: true,
+							},
+						},
+						Action: func(c *cli.Context) error {
+							uuid, err := firstArg(c, "server uuid")
+							if err != nil {
+								return err
+							}
+							var url interface{}
+							if c.String("url") != "" {
+								url = c.String("url")
+							}
+							err = updateServer(uuid, "trust_url", url)
+							if err != nil {
+								return err
+							}
+							audit(AuditServerUpdate, uuid, map[string]interface{}{"trust_url": url})
+							logger.Info("服务器的信任声明地址已修改", F("server_uuid", uuid))
+							return nil
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     T("Stop trusting a server and remove its public key."),
+						ArgsUsage: "<server uuid>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "purge",
+								Usage: T("Also delete the cached and rejected submissions of the server."),
+							},
+						},
+						Action: func(c *cli.Context) error {
+							uuid, err := firstArg(c, "server uuid")
+							if err != nil {
+								return err
+							}
+							err = removeServer(uuid, c.Bool("purge"))
+							if err != nil {
+								return err
+							}
+							audit(AuditServerRemove, uuid, map[string]interface{}{"purge": c.Bool("purge")})
+							logger.Info("服务器已删除", F("server_uuid", uuid))
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "trust",
+				Usage: T("Manage trust statements for transitive trust."),
+				Subcommands: []*cli.Command{
+					{
+						Name:  "publish",
+						Usage: T("Write a signed statement of the servers we trust, for others to fetch."),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "output",
+								Usage:    T("Path of the statement file."),
+								Required: true,
+							},
+							instanceFlag("The central server whose identity signs the statement."),
+						},
+						Action: func(c *cli.Context) error {
+							statement, err := publishTrustStatement(c.String("instance"))
+							if err != nil {
+								return err
+							}
+							err = os.WriteFile(c.String("output"), []byte(statement), 0644)
+							if err != nil {
+								return errors.New(T("文件写入错误: ") + err.Error())
+							}
+							logger.Info("信任声明已写入文件", F("path", c.String("output")))
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "instance",
+				Usage: T("Manage the central servers this server is registered on."),
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: T("List the central servers and our registration on each."),
+						Action: func(c *cli.Context) error {
+							err := listInstances()
+							if err != nil {
+								return err
+							}
+							return nil
+						},
+					},
+				},
+			},
+			overrideCommand(OverrideAllow, "Manage players that are never banned, whatever their score."),
+			overrideCommand(OverrideDeny, "Manage players that are always banned, whatever their score."),
+			{
+				Name:  "report",
+				Usage: T("Inspect, publish and verify the reports saved by update."),
+				Subcommands: []*cli.Command{
+					{
+						Name:  "diff",
+						Usage: T("Show who was newly banned, who was cleared and whose score changed."),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "since",
+								Usage: T("Compare the latest report with \"last\" (the one before it) or a report id."),
+								Value: "last",
+							},
+							&cli.Float64Flag{
+								Name:  "delta",
+								Usage: T("Only list score changes at least this large."),
+								Value: 0.5,
+							},
+						},
+						Action: func(c *cli.Context) error {
+							from, to, err := findReportRuns(c.String("since"))
+							if err != nil {
+								return err
+							}
+							diff, err := diffReports(from, to, c.Float64("delta"))
+							if err != nil {
+								return err
+							}
+							printReportDiff(diff)
+							return nil
+						},
+					},
+					{
+						Name:  "publish",
+						Usage: T("Write a canonical JSON report with the hashes of its inputs, clearsigned with our key."),
+						Flags: []cli.Flag{
+							&cli.Int64Flag{
+								Name:  "id",
+								Usage: T("Publish this report instead of the latest one."),
+							},
+							&cli.StringFlag{
+								Name:  "output",
+								Usage: T("Write the signed report to this file instead of stdout."),
+							},
+						},
+						Action: func(c *cli.Context) error {
+							report, err := publishReport(c.Int64("id"), c.String("output"))
+							if err != nil {
+								return err
+							}
+							if c.String("output") != "" {
+								logger.Info("已发布报告", F("run_id", report.ReportID), F("players", len(report.Players)), F("path", c.String("output")))
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "verify",
+						Usage:     T("Verify a report published by another server."),
+						ArgsUsage: "<report file>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "pubkey",
+								Usage: T("Public key of the publisher, defaults to the trusted server matching the report's issuer."),
+							},
+							&cli.StringFlag{
+								Name:  "server",
+								Usage: T("Uuid of the trusted server that published the report."),
+							},
+							&cli.StringFlag{
+								Name:  "output",
+								Usage: T("Write the verified JSON report to this file."),
+							},
+						},
+						Action: func(c *cli.Context) error {
+							path, err := firstArg(c, "report file")
+							if err != nil {
+								return err
+							}
+							report, text, signer, err := verifyReport(path, c.String("pubkey"), c.String("server"))
+							if err != nil {
+								return err
+							}
+							printPublishedReport(report, signer)
+							if c.String("output") != "" {
+								err = writeFileAtomic(c.String("output"), []byte(text), 0644)
+								if err != nil {
+									return errors.New(T("文件写入错误: ") + err.Error())
+								}
+							}
+							logger.Info("报告验证通过", F("issuer", report.Issuer), F("run_id", report.ReportID))
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "player",
+				Usage: T("Look up what we know about players."),
+				Subcommands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     T("Show our submissions, partner submissions, score, overrides and ban status of a player."),
+						ArgsUsage: "<uuid|name>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "json",
+								Usage: T("Output as JSON."),
+							},
+						},
+						Action: func(c *cli.Context) error {
+							player, err := firstArg(c, "uuid|name")
+							if err != nil {
+								return err
+							}
+							err = showPlayer(c.Context, player, c.Bool("json"))
+							if err != nil {
+								return err
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "notify",
+				Usage: T("Manage webhook and Discord notifications."),
+				Subcommands: []*cli.Command{
+					{
+						Name:  "add",
+						Usage: T("Add a notification target."),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    T("Name of the target."),
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "kind",
+								Usage: T("webhook (generic JSON) or discord."),
+								Value: NotifierWebhook,
+							},
+							&cli.StringFlag{
+								Name:     "url",
+								Usage:    T("Webhook address."),
+								Required: true,
+							},
+							&cli.StringSliceFlag{
+								Name:  "event",
+								Usage: fmt.Sprintf(T("Only send these events, can be repeated. (%s) All events by default."), strings.Join(events, ", ")),
+							},
+							&cli.StringFlag{
+								Name:  "template",
+								Usage: T("Message template in Go text/template syntax, with .Name, .Time and .Data. Requires exactly one event."),
+							},
+						},
+						Action: func(c *cli.Context) error {
+							n := Notifier{
+								name:     c.String("name"),
+								kind:     c.String("kind"),
+								url:      c.String("url"),
+								events:   c.StringSlice("event"),
+								template: c.String("template"),
+							}
+							err := checkNotifier(n)
+							if err != nil {
+								return err
+							}
+							err = insertNotifier(n)
+							if err != nil {
+								return err
+							}
+							logger.Info("通知目标添加成功", F("notifier", n.name))
+							return nil
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     T("Remove a notification target."),
+						ArgsUsage: "<name>",
+						Action: func(c *cli.Context) error {
+							name, err := firstArg(c, "name")
+							if err != nil {
+								return err
+							}
+							err = removeNotifier(name)
+							if err != nil {
+								return err
+							}
+							logger.Info("通知目标已删除", F("notifier", name))
+							return nil
+						},
 					},
-					&cli.Float64Flag{
-						Name:  "less",
-						Usage: "只输出小于某值的数据",
-						Value: -0,
+					{
+						Name:  "list",
+						Usage: T("List the notification targets."),
+						Action: func(c *cli.Context) error {
+							err := listNotifiers()
+							if err != nil {
+								return err
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "test",
+						Usage:     T("Send a test message to a notification target."),
+						ArgsUsage: "<name>",
+						Action: func(c *cli.Context) error {
+							name, err := firstArg(c, "name")
+							if err != nil {
+								return err
+							}
+							err = testNotifier(name)
+							if err != nil {
+								return err
+							}
+							logger.Info("已发送测试消息", F("notifier", name))
+							return nil
+						},
 					},
 				},
-				Action: func(c *cli.Context) error {
-					// 显示一个进度条, 防止时间过长
-					bar = progressbar.Default(1)
-					bar.ChangeMax(0)
-					// 生成数据
-					generateReport()
-
-					// 输出一下
-					c1 := make(chan ReportList)
-					c2 := make(chan string)
-					var export bool = false
-					if c.String("export") != "" {
-						export = true
-						go exportBanList(c.String("export"), c2)
-					}
-					fmt.Println("\t\t玩家uuid\t\t|评分")
-					go reportList(c1)
-					if c.Float64("less") != -0 {
-						for i := range c1 {
-							if i.point <= c.Float64("less") {
-								fmt.Println(fmt.Sprintf("%s\t|%.1f", i.player_uuid, i.point))
-								if export {
-									c2 <- i.player_uuid
+			},
+			{
+				Name:  "audit",
+				Usage: T("Inspect the audit log of local actions."),
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: T("List the audit log, oldest first."),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "operator",
+								Usage: T("Only actions of this operator."),
+							},
+							&cli.StringFlag{
+								Name:  "action",
+								Usage: T("Only this action, or actions starting with it, e.g. server or submission.new."),
+							},
+							&cli.StringFlag{
+								Name:  "target",
+								Usage: T("Only actions on this submission, server or player uuid."),
+							},
+							&cli.StringFlag{
+								Name:  "since",
+								Usage: T("Only actions at or after this time, e.g. 2006-01-02 or 7d (7 days ago)."),
+							},
+							&cli.StringFlag{
+								Name:  "until",
+								Usage: T("Only actions at or before this time, e.g. 2006-01-02 or 12h (12 hours ago)."),
+							},
+							&cli.IntFlag{
+								Name:  "limit",
+								Usage: T("Only the latest N actions."),
+							},
+							&cli.BoolFlag{
+								Name:  "json",
+								Usage: T("Output as JSON."),
+							},
+						},
+						Action: func(c *cli.Context) error {
+							filter := AuditFilter{
+								operator: c.String("operator"),
+								action:   c.String("action"),
+								target:   c.String("target"),
+								limit:    c.Int("limit"),
+							}
+							var err error
+							now := time.Now()
+							if c.String("since") != "" {
+								filter.since, err = parseTime(c.String("since"), now)
+								if err != nil {
+									return err
 								}
 							}
-						}
-					} else {
-						for i := range c1 {
-							fmt.Println(fmt.Sprintf("%s\t|%.1f", i.player_uuid, i.point))
-							if export {
-								c2 <- i.player_uuid
+							if c.String("until") != "" {
+								filter.until, err = parseUntil(c.String("until"), now)
+								if err != nil {
+									return err
+								}
 							}
-						}
-					}
-					close(c2)
-					time.Sleep(1)
-					log.Println("已到达最底端")
-					return nil
+							return listAudit(filter, c.Bool("json"))
+						},
+					},
 				},
 			},
 			{
-				Name:  "list",
-				Usage: "列出一些东西，例如提交历史...",
+				Name:  "backup",
+				Usage: T("Back up and restore the database and keys."),
 				Subcommands: []*cli.Command{
 					{
-						Name:    "submission",
-						Usage:   "List the history of the submission.",
-						Aliases: []string{"sub"},
+						Name:  "create",
+						Usage: T("Write a passphrase-encrypted backup signed with our key."),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "output",
+								Usage:    T("Path of the backup file."),
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "passphrase-file",
+								Usage: T("Read the passphrase from this file instead of OPENMPRDB_BACKUP_PASSPHRASE or the terminal."),
+							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: T("Overwrite the backup file if it exists."),
+							},
+						},
 						Action: func(c *cli.Context) error {
-							err := submissionList()
+							passphrase, err := readPassphrase(c.String("passphrase-file"), true)
 							if err != nil {
 								return err
 							}
+							manifest, err := createBackup(c.String("output"), passphrase, c.Bool("force"))
+							if err != nil {
+								return err
+							}
+							logger.Info("备份已写入文件", F("path", c.String("output")), F("fingerprint", manifest.Fingerprint))
 							return nil
 						},
 					},
 					{
-						Name:  "server",
-						Usage: "Make a list of trusted servers.",
+						Name:      "restore",
+						Usage:     T("Verify a backup and restore it."),
+						ArgsUsage: "<backup file>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "passphrase-file",
+								Usage: T("Read the passphrase from this file instead of OPENMPRDB_BACKUP_PASSPHRASE or the terminal."),
+							},
+							&cli.StringFlag{
+								Name:  "pubkey",
+								Usage: T("Public key that must have signed the backup, defaults to our current public key."),
+							},
+							&cli.BoolFlag{
+								Name:  "trust-embedded-key",
+								Usage: T("Verify the backup with the public key inside it, e.g. when restoring into a new directory. This only detects corruption, not who made the backup."),
+							},
+							&cli.BoolFlag{
+								Name:  "force",
+								Usage: T("Overwrite the existing database and keys."),
+							},
+						},
 						Action: func(c *cli.Context) error {
-							// 这里列出server表的内容
-							err := listServers()
+							path, err := firstArg(c, "backup file")
+							if err != nil {
+								return err
+							}
+							passphrase, err := readPassphrase(c.String("passphrase-file"), false)
+							if err != nil {
+								return err
+							}
+							manifest, err := restoreBackup(path, passphrase, c.String("pubkey"), c.Bool("trust-embedded-key"), c.Bool("force"))
 							if err != nil {
 								return err
 							}
+							logger.Info("备份已恢复", F("fingerprint", manifest.Fingerprint), F("created", time.Unix(manifest.Created, 0).Format("2006-01-02 15:04:05")))
 							return nil
 						},
 					},
 				},
 			},
 			{
-				Name:  "import",
-				Usage: "Import and trust server-specific data.",
-				Flags: []cli.Flag{
-					&cli.StringFlag{
-						Name:     "pubkey",
-						Usage:    "Public key path.",
-						Required: true,
+				Name:  "config",
+				Usage: T("Show and change the settings in the config file."),
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: T("List all settings with their effective value and where it comes from."),
+						Action: func(c *cli.Context) error {
+							return listConfig(c)
+						},
 					},
-					&cli.StringFlag{
-						Name:     "uuid",
-						Usage:    "Server uuid",
-						Required: true,
+					{
+						Name:      "get",
+						Usage:     T("Print the effective value of a setting."),
+						ArgsUsage: "<key>",
+						Action: func(c *cli.Context) error {
+							key, err := firstArg(c, "key")
+							if err != nil {
+								return err
+							}
+							value, err := settingValue(c, key)
+							if err != nil {
+								return err
+							}
+							fmt.Println(value)
+							return nil
+						},
 					},
-					&cli.IntFlag{
-						Name:     "level",
-						Usage:    "Trust level. (1 ~ 5)",
-						Required: true,
+					{
+						Name:      "set",
+						Usage:     T("Set a setting in the config file."),
+						ArgsUsage: "<key> <value>",
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() < 2 {
+								return errors.New(T("缺少参数: ") + "<key> <value>")
+							}
+							key, value := c.Args().Get(0), c.Args().Get(1)
+							err := setConfig(key, &value)
+							if err != nil {
+								return err
+							}
+							logger.Info("配置已修改", F("key", key), F("value", value), F("path", ConfigPath))
+							return nil
+						},
 					},
-					&cli.StringFlag{
-						Name:  "name",
-						Usage: "Server name",
-						Value: "Kuroneko",
+					{
+						Name:      "unset",
+						Usage:     T("Remove a setting from the config file."),
+						ArgsUsage: "<key>",
+						Action: func(c *cli.Context) error {
+							key, err := firstArg(c, "key")
+							if err != nil {
+								return err
+							}
+							err = setConfig(key, nil)
+							if err != nil {
+								return err
+							}
+							logger.Info("配置已删除", F("key", key), F("path", ConfigPath))
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "doctor",
+				Usage: T("Check the database, keys, registration and trusted servers; exits 0 ok, 1 warning, 2 failure."),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: T("Skip the checks that contact the central servers."),
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: T("Output as JSON."),
 					},
 				},
 				Action: func(c *cli.Context) error {
-					// 将相应的信息存入数据库
-					err := trustServer(c.String("uuid"), c.String("name"), c.String("pubkey"), c.Int("level"))
+					ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					checks, code := runDoctor(ctx, DoctorOptions{offline: c.Bool("offline")})
+					if ctx.Err() != nil {
+						code = ExitUnknown
+					}
+					err := printChecks(checks, code, c.Bool("json"))
 					if err != nil {
-						return err
+						return cli.Exit(err.Error(), ExitUnknown)
+					}
+					if code != ExitOK {
+						return cli.Exit("", code)
 					}
-					log.Printf("信任服务器 %s 成功, 已存储对应的公钥\n", c.String("uuid"))
 					return nil
 				},
 			},
 			{
 				Name:  "register",
-				Usage: "Register this server on the central server.",
+				Usage: T("Register this server on the central server."),
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "server_name",
-						Value:    "OpenMPRDB-CLI_test",
-						Usage:    "The name of the server.",
-						Required: true,
+						Name:  "server_name",
+						Usage: T("The name of the server, defaults to server.name in the config or the registered name."),
 					},
 					&cli.StringFlag{
-						Name:     "remote",
-						Value:    "OpenMPRDB-CLI_test",
-						Usage:    "The address of the server.",
-						Required: true,
+						Name:  "remote",
+						Usage: T("The address of the server, defaults to server.address in the config or the registered address."),
 					},
+					instanceFlag("Local name of the central server, used to refer to it later."),
 				},
 				Action: func(c *cli.Context) error {
+					server_name, err := settingValue(c, "server.name")
+					if err != nil {
+						return err
+					}
+					remote, err := settingValue(c, "server.address")
+					if err != nil {
+						return err
+					}
+					if server_name == "" || remote == "" {
+						return errors.New(T("请指定 server_name 和 remote, 或在配置中设置 server.name 和 server.address"))
+					}
+
 					// 在中心服务器上注册本客户端(服务器)
-					server_uuid, err := register(c.String("server_name"), c.String("remote"))
+					server_uuid, err := register(server_name, remote)
 					if err != nil {
 						return err
 					}
 
 					// 在数据库中存储数据
-					err = registerServer(c.String("server_name"), server_uuid, c.String("remote"))
+					err = registerServer(c.String("instance"), server_name, server_uuid, remote)
 					if err != nil {
 						return err
 					}
 
-					log.Printf("服务器%s[%s]注册成功", c.String("server_name"), server_uuid)
+					audit(AuditRegister, server_uuid, map[string]interface{}{"instance": c.String("instance"), "server_name": server_name, "server_address": remote})
+					logger.Info("在中心服务器上注册成功", F("server_name", server_name), F("server_uuid", server_uuid), F("instance", c.String("instance")))
 					return nil
 				},
 			},
 			{
 				Name:  "new",
-				Usage: "Add player popularity data.",
+				Usage: T("Add player popularity data."),
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:     "player",
 						Value:    "a5fac3b4-ff62-4...",
-						Usage:    "Specify the player's uuid.",
+						Usage:    T("Specify the player's uuid."),
 						Required: true,
 					},
 					&cli.Float64Flag{
 						Name:     "point",
 						Value:    0,
-						Usage:    "Specify the player's uuid.",
+						Usage:    T("Specify the player's uuid."),
 						Required: true,
 					},
 					&cli.StringFlag{
 						Name:     "comment",
 						Value:    "Banned for...",
-						Usage:    "The reason for doing so.",
+						Usage:    T("The reason for doing so."),
 						Required: true,
 					},
+					&cli.StringSliceFlag{
+						Name:  "instance",
+						Usage: T("The central servers to submit to, can be repeated."),
+						Value: cli.NewStringSlice(defaultInstance),
+					},
 				},
 				Action: func(c *cli.Context) error {
-					uuid, err := newSubmit(c.String("player"), c.String("comment"), c.Float64("point"))
+					// 提交并在数据库中存储提交数据
+					err := submitToInstances(c.StringSlice("instance"), c.String("player"), c.String("comment"), c.Float64("point"))
 					if err != nil {
 						return err
 					}
 
-					// 在数据库中存储提交数据
-					err = newSubmission(uuid, c.String("player"), c.String("comment"), c.Float64("point"))
+					logger.Info("玩家数据提交成功")
+					return nil
+				},
+			},
+			{
+				Name:  "amend",
+				Usage: T("Replace a past submission with a corrected point or comment."),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "submit",
+						Usage:    T("Specify the submitted uuid."),
+						Required: true,
+					},
+					&cli.Float64Flag{
+						Name:  "point",
+						Usage: T("New point, unchanged by default."),
+					},
+					&cli.StringFlag{
+						Name:  "comment",
+						Usage: T("New comment, unchanged by default."),
+					},
+					&cli.StringFlag{
+						Name:  "reason",
+						Usage: T("Comment of the revocation of the old submission."),
+						Value: "amended",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					var point *float64
+					var comment *string
+					if c.IsSet("point") {
+						v := c.Float64("point")
+						point = &v
+					}
+					if c.IsSet("comment") {
+						v := c.String("comment")
+						comment = &v
+					}
+					if point == nil && comment == nil {
+						return errors.New(T("请至少指定 point 或 comment"))
+					}
+					data, err := amendSubmission(c.String("submit"), point, comment, c.String("reason"))
 					if err != nil {
 						return err
 					}
-
-					log.Printf("玩家数据提交成功, 操作uuid: %s", uuid)
+					logger.Info("提交已修改", F("submission_uuid", data.uuid), F("supersedes", data.supersedes))
 					return nil
 				},
 			},
 			{
 				Name:  "delete",
-				Usage: "Delete the specified past submission.",
-				Flags: []cli.Flag{
+				Usage: T("Delete the specified past submission."),
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
-						Name:     "submit",
-						Value:    "a5fac3b4-ff62-4...",
-						Usage:    "Specify the submitted uuid.",
-						Required: true,
+						Name:  "submit",
+						Value: "",
+						Usage: T("Specify the submitted uuid."),
 					},
 					&cli.StringFlag{
 						Name:     "comment",
 						Value:    "revert ...",
-						Usage:    "Delete the reason for the submission.",
+						Usage:    T("Delete the reason for the submission."),
 						Required: true,
 					},
-				},
+					instanceFlag("The central server of the submission, if it is not in the local database."),
+					&cli.BoolFlag{
+						Name:  "filter",
+						Usage: T("Delete all local submissions matching the filter options instead of one submission."),
+					},
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: T("Delete without asking for confirmation."),
+					},
+				}, submissionFilterFlags()...),
 				Action: func(c *cli.Context) error {
-					// 向中心服务器提交删除请求
-					err := deleteSubmit(c.String("submit"), c.String("comment"))
+					if c.Bool("filter") {
+						if c.String("submit") != "" {
+							return errors.New(T("submit 和 filter 不能同时使用"))
+						}
+						filter, err := submissionFilter(c)
+						if err != nil {
+							return err
+						}
+						return revokeSubmissions(filter, c.String("comment"), c.Bool("yes"))
+					}
+					if c.String("submit") == "" {
+						return errors.New(T("请指定 submit 或 filter"))
+					}
+
+					// 优先使用本地记录中的中心服务器
+					name, err := submissionInstance(c.String("submit"))
+					if err != nil {
+						name = c.String("instance")
+					}
+					instance, err := getInstance(name)
 					if err != nil {
 						return err
 					}
 
-					// 删除本地数据库中的记录
-					err = deleteSubmission(c.String("submit"))
+					err = revokeSubmission(instance, c.String("submit"), c.String("comment"))
 					if err != nil {
 						return err
 					}
-
-					log.Printf("提交 %s 删除成功!", c.String("submit"))
+					logger.Info("提交删除成功", F("submission_uuid", c.String("submit")))
 					return nil
 				},
 			},
@@ -258,8 +1198,247 @@ func main() {
 
 	err := app.Run(os.Args)
 	if err != nil {
-		log.Fatalln(err)
+		logger.Fatal(err.Error())
+	}
+}
+
+// overrideCommand 生成管理本地名单的命令
+func overrideCommand(kind, usage string) *cli.Command {
+	return &cli.Command{
+		Name:  kind,
+		Usage: T(usage),
+		Subcommands: []*cli.Command{
+			{
+				Name:      "add",
+				Usage:     T("Add a player to the list."),
+				ArgsUsage: "<player uuid>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "note",
+						Usage: T("The reason for doing so."),
+					},
+					&cli.StringFlag{
+						Name:  "expires",
+						Usage: T("When the entry expires, e.g. 30d, 12h or 2006-01-02. Never expires by default."),
+					},
+				},
+				Action: func(c *cli.Context) error {
+					player, err := firstArg(c, "player uuid")
+					if err != nil {
+						return err
+					}
+					err = addOverride(kind, player, c.String("note"), c.String("expires"))
+					if err != nil {
+						return err
+					}
+					logger.Info("玩家已加入名单", F("player_uuid", player), F("list", kind))
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     T("Remove a player from the list."),
+				ArgsUsage: "<player uuid>",
+				Action: func(c *cli.Context) error {
+					player, err := firstArg(c, "player uuid")
+					if err != nil {
+						return err
+					}
+					err = deleteOverride(kind, player)
+					if err != nil {
+						return err
+					}
+					logger.Info("玩家已移出名单", F("player_uuid", player), F("list", kind))
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: T("List the players on the list."),
+				Action: func(c *cli.Context) error {
+					err := listOverrides(kind)
+					if err != nil {
+						return err
+					}
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// trustLevel 读取信任等级, 未指定 level 时使用配置中的 trust.level
+func trustLevel(c *cli.Context) (int, error) {
+	level, err := settingInt(c, "trust.level")
+	if err != nil {
+		return 0, err
+	}
+	if level == 0 {
+		return 0, errors.New(T("请指定信任等级 level, 或在配置中设置 trust.level"))
+	}
+	return level, nil
+}
+
+// defaultInstance 未指定时使用的中心服务器名称
+const defaultInstance = "default"
+
+// instanceFlag 生成用于指定中心服务器的参数
+func instanceFlag(usage string) *cli.StringFlag {
+	return &cli.StringFlag{
+		Name:  "instance",
+		Usage: T(usage),
+		Value: defaultInstance,
+	}
+}
+
+// updateFlags update和daemon共用的参数
+func updateFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "export",
+			Usage: T("更新完成后将结果导出到文件中"),
+		},
+		&cli.Float64Flag{
+			Name:  "less",
+			Usage: T("只输出小于某值的数据"),
+		},
+		&cli.StringFlag{
+			Name:        "on-server-error",
+			Usage:       T("某个服务器获取失败时的处理方式: fail(中止), skip(跳过), use-cache(使用上次的数据)"),
+			DefaultText: OnErrorFail,
+		},
+		&cli.IntFlag{
+			Name:        "trust-depth",
+			Usage:       T("信任的最大深度, 大于 1 时根据信任声明加入间接信任的服务器"),
+			DefaultText: "1",
+		},
+		&cli.Float64Flag{
+			Name:        "trust-attenuation",
+			Usage:       T("每经过一层间接信任时权重的衰减系数 (0 ~ 1)"),
+			DefaultText: "0.5",
+		},
+		&cli.StringFlag{
+			Name:  "metrics-file",
+			Usage: T("更新完成后将指标写入文件, 供 node_exporter 的 textfile collector 读取"),
+		},
+		&cli.StringFlag{
+			Name:  "rcon",
+			Usage: T("更新完成后通过 RCON 将新封禁和解除封禁的玩家推送到该游戏服务器, 例如 127.0.0.1:25575"),
+		},
+	}
+}
+
+// updateOptions 从命令行参数和配置中读取update的参数
+func updateOptions(c *cli.Context) (UpdateOptions, error) {
+	var opts UpdateOptions
+	var err error
+	opts.report.onError, err = settingValue(c, "update.on-server-error")
+	if err != nil {
+		return opts, err
+	}
+	opts.report.trustDepth, err = settingInt(c, "trust.depth")
+	if err != nil {
+		return opts, err
+	}
+	attenuation, err := settingFloat(c, "trust.attenuation")
+	if err != nil {
+		return opts, err
 	}
+	opts.report.attenuation = *attenuation
+	opts.threshold, err = settingFloat(c, "update.threshold")
+	if err != nil {
+		return opts, err
+	}
+	opts.export = settingString(c, "update.export")
+	opts.metricsFile = settingString(c, "update.metrics-file")
+	opts.rcon.address = settingString(c, "rcon.address")
+	if opts.rcon.address != "" {
+		for key, value := range map[string]*string{"rcon.password": &opts.rcon.password, "rcon.ban-command": &opts.rcon.ban, "rcon.pardon-command": &opts.rcon.pardon} {
+			*value, err = settingValue(c, key)
+			if err != nil {
+				return opts, err
+			}
+		}
+	}
+	return opts, nil
+}
+
+// submissionFilterFlags 按条件选择本地提交的参数
+func submissionFilterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "player",
+			Usage: T("Only submissions for this player uuid."),
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: T("Only submissions signed at or after this time, e.g. 2006-01-02 or 7d (7 days ago)."),
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: T("Only submissions signed at or before this time, e.g. 2006-01-02 (the end of that day) or 12h (12 hours ago)."),
+		},
+		&cli.Float64Flag{
+			Name:  "point-lt",
+			Usage: T("Only submissions with a point less than this value."),
+		},
+		&cli.Float64Flag{
+			Name:  "point-gt",
+			Usage: T("Only submissions with a point greater than this value."),
+		},
+		&cli.StringFlag{
+			Name:  "comment-contains",
+			Usage: T("Only submissions whose comment contains this text, case-insensitive."),
+		},
+		&cli.StringFlag{
+			Name:  "operator",
+			Usage: T("Only submissions made by this operator."),
+		},
+	}
+}
+
+// submissionFilter 从命令行参数中读取查询本地提交的条件
+func submissionFilter(c *cli.Context) (SubmissionFilter, error) {
+	var filter SubmissionFilter
+	var err error
+	now := time.Now()
+	if c.String("player") != "" {
+		filter.player, err = normalizePlayerUUID(c.String("player"))
+		if err != nil {
+			return filter, err
+		}
+	}
+	if c.String("since") != "" {
+		filter.since, err = parseTime(c.String("since"), now)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if c.String("until") != "" {
+		filter.until, err = parseUntil(c.String("until"), now)
+		if err != nil {
+			return filter, err
+		}
+	}
+	if c.IsSet("point-lt") {
+		v := c.Float64("point-lt")
+		filter.pointLt = &v
+	}
+	if c.IsSet("point-gt") {
+		v := c.Float64("point-gt")
+		filter.pointGt = &v
+	}
+	filter.comment = c.String("comment-contains")
+	filter.operator = c.String("operator")
+	return filter, nil
+}
+
+// firstArg 读取第一个位置参数, 不存在时返回错误
+func firstArg(c *cli.Context, name string) (string, error) {
+	if c.Args().Len() < 1 {
+		return "", errors.New(T("缺少参数: ") + name)
+	}
+	return c.Args().First(), nil
 }
 
 //Exists 判断文件是否存在
@@ -274,20 +1453,36 @@ func Exists(path string) bool {
 	return true
 }
 
+// httpClient 发送请求使用的客户端, 超时时间见配置项 http.timeout
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
 // httpRequest 向指定接口以指定方法发送数据, 返回得到的内容
 func httpRequest(method, Type, serverAddress, API string, data io.Reader) ([]byte, error) {
-	req, _ := http.NewRequest(method, serverAddress+API, data)
+	return httpRequestContext(context.Background(), method, Type, serverAddress, API, data)
+}
+
+// httpRequestContext 同httpRequest, 请求会随ctx一同取消
+func httpRequestContext(ctx context.Context, method, Type, serverAddress, API string, data io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, serverAddress+API, data)
+	if err != nil {
+		return nil, errors.New(T("创建请求错误: ") + err.Error())
+	}
 	req.Header.Add("Content-Type", Type)
-	res, err := http.DefaultClient.Do(req)
+	logger.Debug("发送请求", F("method", method), F("url", serverAddress+API))
+	start := time.Now()
+	res, err := httpClient.Do(req)
+	metricHTTPDuration.Observe(time.Since(start).Seconds(), method)
 	if err != nil {
-		return nil, errors.New("发送请求错误: " + err.Error())
+		metricHTTPRequests.Add(1, method, "error")
+		return nil, errors.New(T("发送请求错误: ") + err.Error())
 	}
 	defer res.Body.Close()
+	metricHTTPRequests.Add(1, method, strconv.Itoa(res.StatusCode))
 
 	//读取返回的内容
 	pageBytes, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, errors.New("读取返回值错误: " + err.Error())
+		return nil, errors.New(T("读取返回值错误: ") + err.Error())
 	}
 	return pageBytes, nil
 }
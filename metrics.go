@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 指标的种类
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+// latencyBuckets 请求耗时直方图的分桶, 单位为秒
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metric 一个指标及其各组标签的值, 输出为Prometheus文本格式
+type Metric struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+	// 以下仅用于直方图
+	buckets map[string][]uint64
+	counts  map[string]uint64
+}
+
+// metrics 所有已注册的指标
+var metrics []*Metric
+
+// newMetric 注册一个指标
+func newMetric(kind, name, help string, labels ...string) *Metric {
+	m := &Metric{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		values:  make(map[string]float64),
+		buckets: make(map[string][]uint64),
+		counts:  make(map[string]uint64),
+	}
+	metrics = append(metrics, m)
+	return m
+}
+
+var (
+	metricHTTPRequests = newMetric(metricCounter, "openmprdb_http_requests_total",
+		"HTTP requests sent, by method and status code.", "method", "code")
+	metricHTTPDuration = newMetric(metricHistogram, "openmprdb_http_request_duration_seconds",
+		"HTTP request latency.", "method")
+	metricFetchDuration = newMetric(metricGauge, "openmprdb_server_fetch_duration_seconds",
+		"Latency of the last submission fetch of each trusted server.", "server_uuid", "server_name")
+	metricFetchSuccess = newMetric(metricGauge, "openmprdb_server_fetch_success",
+		"Whether the last submission fetch of each trusted server succeeded.", "server_uuid", "server_name")
+	metricServerSubmissions = newMetric(metricGauge, "openmprdb_server_submissions",
+		"Submissions accepted from each trusted server in the last update.", "server_uuid", "server_name")
+	metricServerRejected = newMetric(metricGauge, "openmprdb_server_rejected_submissions",
+		"Submissions rejected from each trusted server in the last update.", "server_uuid", "server_name")
+	metricVerifications = newMetric(metricCounter, "openmprdb_signature_verifications_total",
+		"Signature verifications of remote submissions, by result.", "result")
+	metricReportDuration = newMetric(metricGauge, "openmprdb_report_duration_seconds",
+		"Duration of the last report generation.")
+	metricReportPlayers = newMetric(metricGauge, "openmprdb_report_players",
+		"Players in the last report.")
+	metricReportBanned = newMetric(metricGauge, "openmprdb_report_players_below_threshold",
+		"Players below the threshold (or denied locally) in the last report.")
+	metricReportTimestamp = newMetric(metricGauge, "openmprdb_report_last_success_timestamp_seconds",
+		"Unix time of the last successful update.")
+)
+
+// key 将标签值拼接为map的键
+func (m *Metric) key(values []string) string {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("指标 %s 的标签数量不符", m.name))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// Add 为计数器或仪表增加v
+func (m *Metric) Add(v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[m.key(labels)] += v
+}
+
+// Set 设置仪表的值
+func (m *Metric) Set(v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[m.key(labels)] = v
+}
+
+// Observe 向直方图中记录一个值
+func (m *Metric) Observe(v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := m.key(labels)
+	if m.buckets[k] == nil {
+		m.buckets[k] = make([]uint64, len(latencyBuckets))
+	}
+	for i, b := range latencyBuckets {
+		if v <= b {
+			m.buckets[k][i]++
+		}
+	}
+	m.counts[k]++
+	m.values[k] += v
+}
+
+// Reset 清空所有标签的值, 用于每次update后重新设置各服务器的仪表
+func (m *Metric) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values = make(map[string]float64)
+	m.buckets = make(map[string][]uint64)
+	m.counts = make(map[string]uint64)
+}
+
+// labelString 生成 {a="1",b="2"} 形式的标签, extra为额外的标签
+func (m *Metric) labelString(k string, extra ...string) string {
+	var pairs []string
+	if len(m.labels) > 0 {
+		for i, v := range strings.Split(k, "\xff") {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", m.labels[i], strconv.Quote(v)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", extra[i], strconv.Quote(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// write 以Prometheus文本格式输出该指标
+func (m *Metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.values) == 0 && len(m.labels) > 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.values))
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	if len(m.labels) == 0 && len(keys) == 0 {
+		keys = append(keys, "")
+	}
+	sort.Strings(keys)
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	for _, k := range keys {
+		if m.kind != metricHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, m.labelString(k), format(m.values[k]))
+			continue
+		}
+		for i, b := range latencyBuckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.labelString(k, "le", format(b)), m.buckets[k][i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.labelString(k, "le", "+Inf"), m.counts[k])
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, m.labelString(k), format(m.values[k]))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, m.labelString(k), m.counts[k])
+	}
+}
+
+// writeMetrics 输出所有指标
+func writeMetrics(w io.Writer) {
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// writeMetricsFile 将所有指标写入文件, 供node_exporter的textfile collector读取
+//
+// 先写入临时文件再重命名, 避免collector读到不完整的内容.
+func writeMetricsFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.New(T("无法创建指标文件: ") + err.Error())
+	}
+	defer os.Remove(tmp.Name())
+	writeMetrics(tmp)
+	err = tmp.Close()
+	if err != nil {
+		return errors.New(T("无法写入指标文件: ") + err.Error())
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return errors.New(T("无法写入指标文件: ") + err.Error())
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return errors.New(T("无法写入指标文件: ") + err.Error())
+	}
+	return nil
+}
+
+// recordServerResults 根据各服务器的获取结果更新指标
+func recordServerResults(results []ServerResult) {
+	metricFetchDuration.Reset()
+	metricFetchSuccess.Reset()
+	metricServerSubmissions.Reset()
+	metricServerRejected.Reset()
+	for _, r := range results {
+		success := 0.0
+		if r.err == nil {
+			success = 1
+		}
+		metricFetchSuccess.Set(success, r.server.uuid, r.server.name)
+		metricFetchDuration.Set(r.duration.Seconds(), r.server.uuid, r.server.name)
+		metricServerSubmissions.Set(float64(r.accepted), r.server.uuid, r.server.name)
+		metricServerRejected.Set(float64(r.rejected), r.server.uuid, r.server.name)
+	}
+}
+
+// recordReport 根据本次报告更新指标
+func recordReport(start time.Time, players, banned int) {
+	metricReportDuration.Set(time.Since(start).Seconds())
+	metricReportPlayers.Set(float64(players))
+	metricReportBanned.Set(float64(banned))
+	metricReportTimestamp.Set(float64(time.Now().Unix()))
+}
+
+// serveMetrics 在指定地址提供 /metrics, 无法监听时返回错误
+func serveMetrics(listen string) (*http.Server, error) {
+	// 同步监听, 端口被占用等错误直接返回
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, errors.New(T("指标服务监听失败: ") + err.Error())
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	server := &http.Server{Addr: listen, Handler: mux}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("指标服务出错", F("error", err))
+		}
+	}()
+	return server, nil
+}
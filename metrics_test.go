@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestMetric 注册一个测试用的指标, 测试结束后从 metrics 中移除
+func newTestMetric(t *testing.T, kind, name string, labels ...string) *Metric {
+	t.Helper()
+	registered := metrics
+	t.Cleanup(func() { metrics = registered })
+	return newMetric(kind, name, "Test metric.", labels...)
+}
+
+func TestMetricWrite(t *testing.T) {
+	counter := newTestMetric(t, metricCounter, "test_requests_total", "method", "code")
+	counter.Add(1, "GET", "200")
+	counter.Add(2, "GET", "200")
+	counter.Add(1, "POST", `say "hi"`)
+	gauge := newTestMetric(t, metricGauge, "test_players")
+	empty := newTestMetric(t, metricGauge, "test_servers", "server_uuid")
+	histogram := newTestMetric(t, metricHistogram, "test_duration_seconds", "method")
+	histogram.Observe(0.2, "GET")
+	histogram.Observe(3, "GET")
+
+	tests := []struct {
+		metric *Metric
+		want   string
+	}{
+		{counter, `# HELP test_requests_total Test metric.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",code="200"} 3
+test_requests_total{method="POST",code="say \"hi\""} 1
+`},
+		// 没有标签的指标总是输出, 有标签但没有值的指标不输出
+		{gauge, `# HELP test_players Test metric.
+# TYPE test_players gauge
+test_players 0
+`},
+		{empty, ""},
+		{histogram, `# HELP test_duration_seconds Test metric.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="GET",le="0.05"} 0
+test_duration_seconds_bucket{method="GET",le="0.1"} 0
+test_duration_seconds_bucket{method="GET",le="0.25"} 1
+test_duration_seconds_bucket{method="GET",le="0.5"} 1
+test_duration_seconds_bucket{method="GET",le="1"} 1
+test_duration_seconds_bucket{method="GET",le="2.5"} 1
+test_duration_seconds_bucket{method="GET",le="5"} 2
+test_duration_seconds_bucket{method="GET",le="10"} 2
+test_duration_seconds_bucket{method="GET",le="30"} 2
+test_duration_seconds_bucket{method="GET",le="+Inf"} 2
+test_duration_seconds_sum{method="GET"} 3.2
+test_duration_seconds_count{method="GET"} 2
+`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		tt.metric.write(&buf)
+		if buf.String() != tt.want {
+			t.Errorf("%s:\n%s\nwant:\n%s", tt.metric.name, buf.String(), tt.want)
+		}
+	}
+
+	counter.Reset()
+	var buf bytes.Buffer
+	counter.write(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("write() after Reset() = %q", buf.String())
+	}
+}
+
+func TestWriteMetricsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "openmprdb.prom")
+	recordServerResults([]ServerResult{
+		{server: ServerList{uuid: "00000000-0000-4000-8000-000000000002", name: "Neko"}, accepted: 3, rejected: 1, duration: 1500 * time.Millisecond},
+		{server: ServerList{uuid: "00000000-0000-4000-8000-000000000003", name: "Nyan"}, err: errors.New("timeout")},
+	})
+	recordReport(time.Now(), 10, 4)
+	err := writeMetricsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`openmprdb_server_fetch_success{server_uuid="00000000-0000-4000-8000-000000000002",server_name="Neko"} 1`,
+		`openmprdb_server_fetch_success{server_uuid="00000000-0000-4000-8000-000000000003",server_name="Nyan"} 0`,
+		`openmprdb_server_fetch_duration_seconds{server_uuid="00000000-0000-4000-8000-000000000002",server_name="Neko"} 1.5`,
+		`openmprdb_server_submissions{server_uuid="00000000-0000-4000-8000-000000000002",server_name="Neko"} 3`,
+		`openmprdb_server_rejected_submissions{server_uuid="00000000-0000-4000-8000-000000000002",server_name="Neko"} 1`,
+		"openmprdb_report_players 10\n",
+		"openmprdb_report_players_below_threshold 4\n",
+		"# TYPE openmprdb_report_last_success_timestamp_seconds gauge\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("metrics file does not contain %q", want)
+		}
+	}
+	// 临时文件已被重命名
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("directory contains %v, %v, want only the metrics file", entries, err)
+	}
+
+	// 每次update后重新设置各服务器的仪表
+	recordServerResults(nil)
+	err = writeMetricsFile(path)
+	if err == nil {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil || strings.Contains(string(data), "Neko") {
+		t.Errorf("metrics after an empty update = %s, %v", data, err)
+	}
+	if writeMetricsFile(filepath.Join(dir, "missing", "openmprdb.prom")) == nil {
+		t.Error("writeMetricsFile() into a missing directory succeeded")
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	// 找一个空闲的端口
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := l.Addr().String()
+	l.Close()
+
+	server, err := serveMetrics(listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	res, err := http.Get("http://" + listen + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain; version=0.0.4") ||
+		!strings.Contains(string(body), "# TYPE openmprdb_report_players gauge") {
+		t.Errorf("GET /metrics = %s %q:\n%s", res.Status, res.Header.Get("Content-Type"), body)
+	}
+
+	// 端口被占用时直接返回错误
+	_, err = serveMetrics(listen)
+	if err == nil {
+		t.Error("serveMetrics() on a used port succeeded")
+	}
+}
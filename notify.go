@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 通知的种类
+const (
+	// NotifierWebhook 以JSON格式发送到任意地址
+	NotifierWebhook = "webhook"
+	// NotifierDiscord 以Discord webhook的格式发送
+	NotifierDiscord = "discord"
+)
+
+// 可以订阅的事件
+const (
+	EventPlayerBanned      = "player.banned"
+	EventPlayerCleared     = "player.cleared"
+	EventServerRejected    = "server.rejected"
+	EventSubmissionCreated = "submission.created"
+	EventSubmissionDeleted = "submission.deleted"
+	EventTest              = "test"
+)
+
+// events 所有可以订阅的事件
+var events = []string{EventPlayerBanned, EventPlayerCleared, EventServerRejected, EventSubmissionCreated, EventSubmissionDeleted}
+
+// defaultTemplates 各事件默认的消息模板
+var defaultTemplates = map[string]string{
+	EventPlayerBanned: `新封禁 {{len .Data}} 名玩家:{{range .Data}}
+{{.UUID}} ({{printf "%.1f" .Before}} -> {{printf "%.1f" .After}}){{end}}`,
+	EventPlayerCleared: `解除封禁 {{len .Data}} 名玩家:{{range .Data}}
+{{.UUID}} ({{printf "%.1f" .Before}} -> {{printf "%.1f" .After}}){{end}}`,
+	EventServerRejected:    `服务器 {{.Data.Name}}[{{.Data.UUID}}] 有 {{.Data.Rejected}} 条提交未通过校验, 请使用 list rejected 查看`,
+	EventSubmissionCreated: `已向中心服务器 {{.Data.Instance}} 提交玩家 {{.Data.Player}} 的评分 {{printf "%.1f" .Data.Point}}: {{.Data.Comment}}`,
+	EventSubmissionDeleted: `已撤回中心服务器 {{.Data.Instance}} 上的提交 {{.Data.UUID}}: {{.Data.Comment}}`,
+	EventTest:              `这是一条来自 OpenMPRDB-CLI 的测试消息`,
+}
+
+// Event 一次通知的内容
+type Event struct {
+	Name string      `json:"event"`
+	Time int64       `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// PlayerChange 玩家评分的变化
+type PlayerChange struct {
+	UUID   string  `json:"uuid"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+// ServerRejected 某个服务器被拒绝的提交数量
+type ServerRejected struct {
+	UUID     string `json:"uuid"`
+	Name     string `json:"name"`
+	Rejected int    `json:"rejected"`
+}
+
+// SubmissionEvent 新建或撤回的提交
+type SubmissionEvent struct {
+	UUID     string  `json:"uuid"`
+	Instance string  `json:"instance"`
+	Player   string  `json:"player,omitempty"`
+	Point    float64 `json:"point,omitempty"`
+	Comment  string  `json:"comment"`
+}
+
+// Notifier 一个通知目标
+type Notifier struct {
+	name string
+	kind string
+	url  string
+	// events 订阅的事件, 为空时订阅所有事件
+	events   []string
+	template string
+}
+
+// subscribed 判断通知目标是否订阅了某个事件, 测试事件总是会被发送
+func (n Notifier) subscribed(event string) bool {
+	if len(n.events) == 0 || event == EventTest {
+		return true
+	}
+	for _, e := range n.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// render 使用通知目标的模板或默认模板生成消息文本
+func (n Notifier) render(event Event) (string, error) {
+	text := n.template
+	// 测试消息总是使用默认模板, 自定义模板可能依赖其他事件的数据;
+	// 旧版本添加的订阅了多个事件的自定义模板同样不再使用
+	if text == "" || event.Name == EventTest || len(n.events) != 1 {
+		text = T(defaultTemplates[event.Name])
+	}
+	tmpl, err := template.New(n.name).Parse(text)
+	if err != nil {
+		return "", errors.New(T("模板解析错误: ") + err.Error())
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, event)
+	if err != nil {
+		return "", errors.New(T("模板执行错误: ") + err.Error())
+	}
+	return buf.String(), nil
+}
+
+// send 向通知目标发送一次通知
+func (n Notifier) send(event Event) error {
+	message, err := n.render(event)
+	if err != nil {
+		return err
+	}
+
+	var body interface{}
+	switch n.kind {
+	case NotifierDiscord:
+		// Discord 单条消息最多2000字
+		if r := []rune(message); len(r) > 2000 {
+			message = string(r[:1997]) + "..."
+		}
+		body = map[string]string{"content": message}
+	default:
+		body = struct {
+			Event
+			Message string `json:"message"`
+		}{event, message}
+	}
+	bytesData, err := json.Marshal(body)
+	if err != nil {
+		return errors.New(T("序列化错误: ") + err.Error())
+	}
+	res, err := httpClient.Post(n.url, "application/json", bytes.NewBuffer(bytesData))
+	if err != nil {
+		return errors.New(T("发送请求错误: ") + err.Error())
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf(T("返回状态异常: %s"), res.Status)
+	}
+	return nil
+}
+
+// checkNotifier 检查通知目标的种类和订阅的事件
+func checkNotifier(n Notifier) error {
+	if n.kind != NotifierWebhook && n.kind != NotifierDiscord {
+		return fmt.Errorf(T("未知的通知种类: %s (可选 %s, %s)"), n.kind, NotifierWebhook, NotifierDiscord)
+	}
+	for _, e := range n.events {
+		known := false
+		for _, k := range events {
+			known = known || e == k
+		}
+		if !known {
+			return fmt.Errorf(T("未知的事件: %s (可选 %s)"), e, strings.Join(events, ", "))
+		}
+	}
+	if n.template != "" {
+		// 各事件的 .Data 结构不同, 一个模板只能用于一种事件
+		if len(n.events) != 1 {
+			return errors.New(T("使用 template 时必须且只能指定一个 event"))
+		}
+		_, err := template.New(n.name).Parse(n.template)
+		if err != nil {
+			return errors.New(T("模板解析错误: ") + err.Error())
+		}
+	}
+	return nil
+}
+
+// notify 向所有订阅了该事件的通知目标发送通知, 发送失败时只记录日志
+func notify(name string, data interface{}) {
+	list, err := notifierList()
+	if err != nil {
+		logger.Error("无法读取通知目标", F("error", err))
+		return
+	}
+	event := Event{Name: name, Time: time.Now().Unix(), Data: data}
+	for _, n := range list {
+		if !n.subscribed(name) {
+			continue
+		}
+		err := n.send(event)
+		if err != nil {
+			logger.Warn("通知发送失败", F("notifier", n.name), F("event", name), F("error", err))
+		}
+	}
+}
+
+// notifyReport 根据本次update的结果发送通知
+func notifyReport(diff ReportDiff, results []ServerResult) {
+	changes := func(list []DiffEntry) []PlayerChange {
+		var out []PlayerChange
+		for _, i := range list {
+			out = append(out, PlayerChange{UUID: i.player_uuid, Before: i.before, After: i.after})
+		}
+		return out
+	}
+	if len(diff.banned) > 0 {
+		notify(EventPlayerBanned, changes(diff.banned))
+	}
+	if len(diff.cleared) > 0 {
+		notify(EventPlayerCleared, changes(diff.cleared))
+	}
+	for _, r := range results {
+		if r.rejected > 0 {
+			notify(EventServerRejected, ServerRejected{UUID: r.server.uuid, Name: r.server.name, Rejected: r.rejected})
+		}
+	}
+}
+
+// testNotifier 向指定的通知目标发送一条测试消息
+func testNotifier(name string) error {
+	list, err := notifierList()
+	if err != nil {
+		return err
+	}
+	for _, n := range list {
+		if n.name == name {
+			return n.send(Event{Name: EventTest, Time: time.Now().Unix()})
+		}
+	}
+	return errors.New(T("未找到通知目标: ") + name)
+}
+
+// listNotifiers 列出所有通知目标
+func listNotifiers() error {
+	list, err := notifierList()
+	if err != nil {
+		return err
+	}
+	fmt.Println(T("名称\t|种类\t|事件\t|地址"))
+	for _, n := range list {
+		subscribed := T("全部")
+		if len(n.events) > 0 {
+			subscribed = strings.Join(n.events, ",")
+		}
+		fmt.Println(fmt.Sprintf("%s\t|%s\t|%s\t|%s", n.name, n.kind, subscribed, n.url))
+	}
+	logger.Info("已到达最底端")
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeHook 模拟的webhook, 记录收到的请求体
+type fakeHook struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies [][]byte
+	// status 返回的状态码
+	status int
+}
+
+// newFakeHook 启动模拟的webhook
+func newFakeHook(t *testing.T, status int) *fakeHook {
+	t.Helper()
+	h := &fakeHook{status: status}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		h.mu.Lock()
+		h.bodies = append(h.bodies, body)
+		h.mu.Unlock()
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(h.status)
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+// received 返回收到的请求体
+func (h *fakeHook) received() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []string
+	for _, b := range h.bodies {
+		out = append(out, string(b))
+	}
+	return out
+}
+
+func TestNotifierSendWebhook(t *testing.T) {
+	hook := newFakeHook(t, http.StatusNoContent)
+	n := Notifier{name: "pipeline", kind: NotifierWebhook, url: hook.URL}
+	changes := []PlayerChange{{UUID: "252af321-89aa-426c-a534-399f551810ae", Before: 0, After: -1.5}}
+	err := n.send(Event{Name: EventPlayerBanned, Time: 1627776000, Data: changes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodies := hook.received()
+	if len(bodies) != 1 {
+		t.Fatalf("received %d requests, want 1", len(bodies))
+	}
+	var body struct {
+		Event   string         `json:"event"`
+		Time    int64          `json:"time"`
+		Data    []PlayerChange `json:"data"`
+		Message string         `json:"message"`
+	}
+	err = json.Unmarshal([]byte(bodies[0]), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.Event != EventPlayerBanned || body.Time != 1627776000 || len(body.Data) != 1 || body.Data[0] != changes[0] {
+		t.Errorf("webhook body = %s", bodies[0])
+	}
+	// 默认模板
+	if !strings.Contains(body.Message, "252af321-89aa-426c-a534-399f551810ae (0.0 -> -1.5)") {
+		t.Errorf("webhook message = %q", body.Message)
+	}
+}
+
+func TestNotifierSendDiscord(t *testing.T) {
+	hook := newFakeHook(t, http.StatusNoContent)
+	n := Notifier{name: "mods", kind: NotifierDiscord, url: hook.URL, events: []string{EventServerRejected},
+		template: "{{.Data.Name}} rejected {{.Data.Rejected}}"}
+	err := n.send(Event{Name: EventServerRejected, Time: 1627776000, Data: ServerRejected{UUID: "u", Name: "Neko", Rejected: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Discord 单条消息最多2000字
+	long := make([]PlayerChange, 100)
+	for i := range long {
+		long[i] = PlayerChange{UUID: "252af321-89aa-426c-a534-399f551810ae", After: -1}
+	}
+	n = Notifier{name: "mods", kind: NotifierDiscord, url: hook.URL}
+	err = n.send(Event{Name: EventPlayerBanned, Data: long})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := hook.received()
+	if len(bodies) != 2 {
+		t.Fatalf("received %d requests, want 2", len(bodies))
+	}
+	var messages []map[string]interface{}
+	for _, b := range bodies {
+		var body map[string]interface{}
+		err = json.Unmarshal([]byte(b), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) != 1 {
+			t.Errorf("discord body = %s, want only content", b)
+		}
+		messages = append(messages, body)
+	}
+	if messages[0]["content"] != "Neko rejected 3" {
+		t.Errorf("discord content = %q, want the custom template", messages[0]["content"])
+	}
+	content, _ := messages[1]["content"].(string)
+	if r := []rune(content); len(r) != 2000 || !strings.HasSuffix(content, "...") {
+		t.Errorf("long discord content has %d characters", len(r))
+	}
+}
+
+func TestNotifierRender(t *testing.T) {
+	event := Event{Name: EventSubmissionCreated, Data: SubmissionEvent{Instance: "default", Player: "p", Point: -0.5, Comment: "griefing"}}
+	tests := []struct {
+		name     string
+		notifier Notifier
+		event    Event
+		// want 消息中应包含的内容
+		want    []string
+		wantErr bool
+	}{
+		{name: "custom", notifier: Notifier{events: []string{EventSubmissionCreated}, template: "{{.Name}} {{.Data.Player}} {{.Data.Point}}"}, event: event, want: []string{"submission.created p -0.5"}},
+		{name: "default", notifier: Notifier{}, event: event, want: []string{"default", "p", "-0.5", "griefing"}},
+		// 测试消息和订阅了多个事件的旧模板都使用默认模板
+		{name: "test event", notifier: Notifier{events: []string{EventSubmissionCreated}, template: "custom"}, event: Event{Name: EventTest}, want: []string{T(defaultTemplates[EventTest])}},
+		{name: "several events", notifier: Notifier{events: []string{EventSubmissionCreated, EventSubmissionDeleted}, template: "custom"}, event: event, want: []string{"default", "griefing"}},
+		{name: "missing field", notifier: Notifier{events: []string{EventSubmissionCreated}, template: "{{.Data.Rejected}}"}, event: event, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.notifier.render(tt.event)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: render() = %q, %v, want error %v", tt.name, got, err, tt.wantErr)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) || strings.Contains(got, "custom") {
+				t.Errorf("%s: render() = %q, want it to contain %q", tt.name, got, want)
+			}
+		}
+	}
+}
+
+func TestNotifierSendError(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusInternalServerError, http.StatusMultipleChoices} {
+		hook := newFakeHook(t, status)
+		n := Notifier{name: "broken", kind: NotifierWebhook, url: hook.URL}
+		err := n.send(Event{Name: EventTest})
+		if err == nil || !strings.Contains(err.Error(), http.StatusText(status)) {
+			t.Errorf("send() to a %d webhook error = %v", status, err)
+		}
+	}
+	n := Notifier{name: "closed", kind: NotifierWebhook, url: "http://127.0.0.1:1/hook"}
+	if n.send(Event{Name: EventTest}) == nil {
+		t.Error("send() to a closed port succeeded")
+	}
+}
+
+func TestCheckNotifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       Notifier
+		wantErr bool
+	}{
+		{name: "webhook", n: Notifier{kind: NotifierWebhook}},
+		{name: "discord with events", n: Notifier{kind: NotifierDiscord, events: []string{EventPlayerBanned, EventPlayerCleared}}},
+		{name: "template", n: Notifier{kind: NotifierWebhook, events: []string{EventPlayerBanned}, template: "{{len .Data}}"}},
+		{name: "unknown kind", n: Notifier{kind: "slack"}, wantErr: true},
+		{name: "unknown event", n: Notifier{kind: NotifierWebhook, events: []string{"player.kicked"}}, wantErr: true},
+		{name: "template without event", n: Notifier{kind: NotifierWebhook, template: "x"}, wantErr: true},
+		{name: "template with two events", n: Notifier{kind: NotifierWebhook, events: []string{EventPlayerBanned, EventPlayerCleared}, template: "x"}, wantErr: true},
+		{name: "malformed template", n: Notifier{kind: NotifierWebhook, events: []string{EventPlayerBanned}, template: "{{"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := checkNotifier(tt.n); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkNotifier() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNotifyReport(t *testing.T) {
+	newTestDB(t)
+	all := newFakeHook(t, http.StatusOK)
+	cleared := newFakeHook(t, http.StatusOK)
+	broken := newFakeHook(t, http.StatusInternalServerError)
+	for _, n := range []Notifier{
+		{name: "all", kind: NotifierWebhook, url: all.URL},
+		{name: "cleared", kind: NotifierDiscord, url: cleared.URL, events: []string{EventPlayerCleared}},
+		{name: "broken", kind: NotifierWebhook, url: broken.URL},
+	} {
+		err := insertNotifier(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diff := ReportDiff{cleared: []DiffEntry{{player_uuid: "252af321-89aa-426c-a534-399f551810ae", before: -1}}}
+	results := []ServerResult{
+		{server: ServerList{uuid: "00000000-0000-4000-8000-000000000002", name: "Neko"}, rejected: 2},
+		{server: ServerList{uuid: "00000000-0000-4000-8000-000000000003", name: "Nyan"}},
+	}
+	// 发送失败只记录日志
+	notifyReport(diff, results)
+
+	var events []string
+	for _, b := range all.received() {
+		var body Event
+		err := json.Unmarshal([]byte(b), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, body.Name)
+	}
+	if strings.Join(events, ",") != EventPlayerCleared+","+EventServerRejected {
+		t.Errorf("events sent to all = %v", events)
+	}
+	if n := len(cleared.received()); n != 1 {
+		t.Errorf("%d events sent to cleared, want 1", n)
+	}
+	if n := len(broken.received()); n != 2 {
+		t.Errorf("%d events sent to broken, want 2", n)
+	}
+
+	err := testNotifier("cleared")
+	if err != nil || len(cleared.received()) != 2 {
+		t.Errorf("testNotifier() = %v, want a test message to cleared", err)
+	}
+	if testNotifier("broken") == nil || testNotifier("unknown") == nil {
+		t.Error("testNotifier() of a broken or unknown notifier succeeded")
+	}
+}
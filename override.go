@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 本地名单的种类
+const (
+	// OverrideAllow 放行, 无论评分如何都不会被封禁
+	OverrideAllow = "allow"
+	// OverrideDeny 强制封禁, 无论评分如何都会被封禁
+	OverrideDeny = "deny"
+)
+
+// parseExpires 解析过期时间, 支持 30d, 12h 这样的时长或 2006-01-02 格式的日期, 为空时返回0
+func parseExpires(value string, now time.Time) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err == nil && days > 0 {
+			return now.AddDate(0, 0, days).Unix(), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+		return now.Add(duration).Unix(), nil
+	}
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date.Unix(), nil
+	}
+	return 0, errors.New(T("无法识别的过期时间: ") + value)
+}
+
+// addOverride 将玩家加入本地名单
+func addOverride(kind, player, note, expires string) error {
+	player, err := normalizePlayerUUID(player)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	expiresAt, err := parseExpires(expires, now)
+	if err != nil {
+		return err
+	}
+	err = setOverride(Override{
+		player_uuid: player,
+		kind:        kind,
+		note:        note,
+		expires:     expiresAt,
+		created:     now.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	audit(AuditOverrideAdd, player, map[string]interface{}{"list": kind, "note": note, "expires": expiresAt})
+	return nil
+}
+
+// deleteOverride 将玩家移出本地名单
+func deleteOverride(kind, player string) error {
+	player, err := normalizePlayerUUID(player)
+	if err != nil {
+		return err
+	}
+	err = removeOverride(player, kind)
+	if err != nil {
+		return err
+	}
+	audit(AuditOverrideRemove, player, map[string]interface{}{"list": kind})
+	return nil
+}
+
+// listOverrides 列出本地名单
+func listOverrides(kind string) error {
+	list, err := overrideList(kind)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	fmt.Println(T("\t\t玩家uuid\t\t|过期时间\t\t|备注"))
+	for _, i := range list {
+		expires := T("永不过期\t")
+		if i.expires != 0 {
+			expires = time.Unix(i.expires, 0).Format("2006-01-02 15:04")
+			if i.expires <= now {
+				expires += T("(已过期)")
+			}
+		}
+		fmt.Println(fmt.Sprintf("%s\t|%s\t|%s", i.player_uuid, expires, i.note))
+	}
+	logger.Info("已到达最底端")
+	return nil
+}
+
+// activeOverrides 读取当前生效的本地名单, 以玩家uuid为键
+func activeOverrides() (map[string]Override, error) {
+	list, err := overrideList("")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	active := make(map[string]Override)
+	for _, i := range list {
+		if i.expires == 0 || i.expires > now {
+			active[i.player_uuid] = i
+		}
+	}
+	return active, nil
+}
+
+// applyOverrides 将当前生效的本地名单应用到报告上
+//
+// 在名单中的玩家会被标记, 强制封禁但不在报告中的玩家会以0分加入报告.
+func applyOverrides(list []ReportList) ([]ReportList, map[string]Override, error) {
+	active, err := activeOverrides()
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := make(map[string]bool)
+	for i := range list {
+		seen[list[i].player_uuid] = true
+		if o, ok := active[list[i].player_uuid]; ok {
+			list[i].override = o.kind
+		}
+	}
+	for player, o := range active {
+		if o.kind == OverrideDeny && !seen[player] {
+			list = append(list, ReportList{player_uuid: player, override: OverrideDeny})
+		}
+	}
+	return list, active, nil
+}
+
+// banned 判断报告中的玩家是否应被封禁, threshold为nil时所有玩家都会被封禁
+func (r ReportList) banned(threshold *float64) bool {
+	switch r.override {
+	case OverrideAllow:
+		return false
+	case OverrideDeny:
+		return true
+	}
+	return threshold == nil || r.point <= *threshold
+}
+
+// enforced 判断保存在报告快照中的玩家是否被封禁
+//
+// 与 banned 不同, threshold为nil时只有强制封禁的玩家视为被封禁, 以免未指定阈值的报告将所有玩家记为被封禁.
+func (r ReportList) enforced(threshold *float64) bool {
+	if threshold == nil {
+		return r.override == OverrideDeny
+	}
+	return r.banned(threshold)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseExpires(t *testing.T) {
+	now := time.Date(2021, 8, 1, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "30d", want: now.AddDate(0, 0, 30).Unix()},
+		{value: "12h", want: now.Add(12 * time.Hour).Unix()},
+		{value: "2021-09-01", want: time.Date(2021, 9, 1, 0, 0, 0, 0, time.Local).Unix()},
+		{value: "0d", wantErr: true},
+		{value: "-1h", wantErr: true},
+		{value: "forever", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseExpires(tt.value, now)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseExpires(%q) = %d, %v, want %d (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestReportListBanned(t *testing.T) {
+	threshold := -1.0
+	tests := []struct {
+		name      string
+		r         ReportList
+		threshold *float64
+		banned    bool
+		enforced  bool
+	}{
+		{name: "below threshold", r: ReportList{point: -2}, threshold: &threshold, banned: true, enforced: true},
+		{name: "above threshold", r: ReportList{point: 0}, threshold: &threshold},
+		{name: "allow below threshold", r: ReportList{point: -2, override: OverrideAllow}, threshold: &threshold},
+		{name: "deny above threshold", r: ReportList{point: 0, override: OverrideDeny}, threshold: &threshold, banned: true, enforced: true},
+		{name: "no threshold", r: ReportList{point: 0}, banned: true},
+		{name: "allow without threshold", r: ReportList{point: -2, override: OverrideAllow}},
+		{name: "deny without threshold", r: ReportList{point: 0, override: OverrideDeny}, banned: true, enforced: true},
+	}
+	for _, tt := range tests {
+		if got := tt.r.banned(tt.threshold); got != tt.banned {
+			t.Errorf("%s: banned() = %v, want %v", tt.name, got, tt.banned)
+		}
+		if got := tt.r.enforced(tt.threshold); got != tt.enforced {
+			t.Errorf("%s: enforced() = %v, want %v", tt.name, got, tt.enforced)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	dir := newTestDB(t)
+	const (
+		allowed = "00000000-0000-4000-8000-00000000000a"
+		denied  = "00000000-0000-4000-8000-00000000000b"
+		expired = "00000000-0000-4000-8000-00000000000c"
+		scored  = "00000000-0000-4000-8000-00000000000d"
+	)
+	// 不带连字符的uuid会被规范化
+	err := addOverride(OverrideAllow, "00000000000040008000000000000000a", "", "")
+	if err == nil {
+		t.Fatal("addOverride() of a malformed uuid succeeded")
+	}
+	err = addOverride(OverrideAllow, "0000000000004000800000000000000a", "friend", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = addOverride(OverrideAllow, denied, "", "")
+	if err == nil {
+		// 再次加入时覆盖原有的记录, 包括种类
+		err = addOverride(OverrideDeny, denied, "griefing", "2099-01-01")
+	}
+	if err == nil {
+		err = setOverride(Override{player_uuid: expired, kind: OverrideDeny, expires: time.Now().Add(-time.Hour).Unix(), created: time.Now().Unix()})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := overrideList(OverrideDeny)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("overrideList(deny) = %+v, %v, want 2 entries", list, err)
+	}
+	if deleteOverride(OverrideAllow, denied) == nil {
+		t.Error("deleteOverride() from the wrong list succeeded")
+	}
+
+	report := []ReportList{{player_uuid: allowed, point: -3}, {player_uuid: scored, point: -2}, {player_uuid: expired, point: 1}}
+	report, active, err := applyOverrides(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 2 || active[expired].kind != "" {
+		t.Errorf("activeOverrides() = %+v, want allowed and denied only", active)
+	}
+	threshold := -1.0
+	want := map[string]bool{allowed: false, scored: true, expired: false, denied: true}
+	if len(report) != len(want) {
+		t.Fatalf("applyOverrides() = %+v, want %d players", report, len(want))
+	}
+	var banned []ReportList
+	for _, r := range report {
+		if r.banned(&threshold) != want[r.player_uuid] {
+			t.Errorf("%s (%s, %.1f): banned = %v, want %v", r.player_uuid, r.override, r.point, !want[r.player_uuid], want[r.player_uuid])
+		}
+		if r.banned(&threshold) {
+			banned = append(banned, r)
+		}
+	}
+
+	// 导出时强制封禁的玩家使用名单中的备注和过期时间
+	path := filepath.Join(dir, "banned-players.json")
+	err = exportBanList(path, banned, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exported []struct {
+		UUID    string `json:"uuid"`
+		Expires string `json:"expires"`
+		Reason  string `json:"reason"`
+	}
+	err = json.Unmarshal(data, &exported)
+	if err != nil || len(exported) != 2 {
+		t.Fatalf("exported %s, %v", data, err)
+	}
+	for _, b := range exported {
+		switch b.UUID {
+		case denied:
+			if b.Reason != "griefing" || b.Expires == "forever" {
+				t.Errorf("exported deny override = %+v", b)
+			}
+		case scored:
+			if b.Reason != "OpenMPRDB-CLI Ban" || b.Expires != "forever" {
+				t.Errorf("exported scored player = %+v", b)
+			}
+		default:
+			t.Errorf("unexpected exported player %+v", b)
+		}
+	}
+
+	err = deleteOverride(OverrideDeny, denied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err = overrideList("")
+	if err != nil || len(list) != 2 {
+		t.Errorf("overrideList() after removal = %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// fieldRegexp 匹配形如 "key: value" 的字段行
+var fieldRegexp = regexp.MustCompile(`^([a-z][a-z0-9_]*):(?: (.*))?$`)
+
+// Payload 一条提交的明文内容
+type Payload struct {
+	uuid        string
+	timestamp   int64
+	player_uuid string
+	point       float64
+	comment     string
+	// extra 未知字段, 原样保留
+	extra map[string]string
+}
+
+// parsePayload 解析OpenMPRDB提交的明文内容
+//
+// 同时兼容 \r\n 与 \n 换行; 未知字段会被保留在extra中;
+// 不符合 "key: value" 格式的行视为上一字段的续行, 用于支持多行理由.
+func parsePayload(text string) (Payload, error) {
+	var payload Payload
+	fields := make(map[string]string)
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.TrimRight(text, "\n")
+
+	var last string
+	for _, line := range strings.Split(text, "\n") {
+		if params := fieldRegexp.FindStringSubmatch(line); params != nil {
+			if _, ok := fields[params[1]]; ok {
+				return payload, errors.New(T("字段重复: ") + params[1])
+			}
+			last = params[1]
+			fields[last] = params[2]
+			continue
+		}
+		if last == "" {
+			return payload, errors.New(T("无法识别的内容: ") + line)
+		}
+		fields[last] += "\n" + line
+	}
+
+	// 检查必需字段
+	for _, key := range []string{"uuid", "timestamp", "player_uuid", "points", "comment"} {
+		if _, ok := fields[key]; !ok {
+			return payload, errors.New(T("缺少字段: ") + key)
+		}
+	}
+
+	id, err := uuid.FromString(fields["uuid"])
+	if err != nil {
+		return payload, errors.New(T("uuid格式错误: ") + err.Error())
+	}
+	player, err := uuid.FromString(fields["player_uuid"])
+	if err != nil {
+		return payload, errors.New(T("player_uuid格式错误: ") + err.Error())
+	}
+	timestamp, err := strconv.ParseInt(fields["timestamp"], 10, 64)
+	if err != nil {
+		return payload, errors.New(T("timestamp格式错误: ") + err.Error())
+	}
+	point, err := strconv.ParseFloat(fields["points"], 64)
+	if err != nil {
+		return payload, errors.New(T("无法获取评分: ") + err.Error())
+	}
+	// ParseFloat 接受 NaN 与 Inf, 写入数据库后会变为NULL
+	if math.IsNaN(point) || math.IsInf(point, 0) {
+		return payload, errors.New(T("评分不是有限的数值: ") + fields["points"])
+	}
+
+	payload = Payload{
+		uuid:        id.String(),
+		timestamp:   timestamp,
+		player_uuid: player.String(),
+		point:       point,
+		comment:     fields["comment"],
+		extra:       make(map[string]string),
+	}
+	for key, value := range fields {
+		switch key {
+		case "uuid", "timestamp", "player_uuid", "points", "comment":
+		default:
+			payload.extra[key] = value
+		}
+	}
+	return payload, nil
+}
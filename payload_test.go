@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePayload(t *testing.T) {
+	const (
+		id     = "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c"
+		player = "2b0d7f3e-8c4a-4f19-a6e2-5d9c1b7e3f80"
+	)
+	lines := func(extra ...string) string {
+		fields := []string{
+			"uuid: " + id,
+			"timestamp: 1627776000",
+			"player_uuid: " + player,
+			"points: -0.5",
+			"comment: griefing",
+		}
+		return strings.Join(append(fields, extra...), "\n")
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    Payload
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			text: lines(),
+			want: Payload{uuid: id, timestamp: 1627776000, player_uuid: player, point: -0.5, comment: "griefing", extra: map[string]string{}},
+		},
+		{
+			name: "crlf and trailing newline",
+			text: strings.ReplaceAll(lines(), "\n", "\r\n") + "\r\n",
+			want: Payload{uuid: id, timestamp: 1627776000, player_uuid: player, point: -0.5, comment: "griefing", extra: map[string]string{}},
+		},
+		{
+			name: "continuation lines",
+			text: lines("second line of the comment", "", "fourth line"),
+			want: Payload{uuid: id, timestamp: 1627776000, player_uuid: player, point: -0.5, comment: "griefing\nsecond line of the comment\n\nfourth line", extra: map[string]string{}},
+		},
+		{
+			name: "unknown fields are kept",
+			text: lines("server_name: Neko", "evidence:"),
+			want: Payload{uuid: id, timestamp: 1627776000, player_uuid: player, point: -0.5, comment: "griefing", extra: map[string]string{"server_name": "Neko", "evidence": ""}},
+		},
+		{name: "duplicate field", text: lines("points: 1"), wantErr: true},
+		{name: "leading garbage", text: "garbage\n" + lines(), wantErr: true},
+		{name: "missing field", text: strings.Replace(lines(), "comment: griefing", "", 1), wantErr: true},
+		{name: "malformed uuid", text: strings.Replace(lines(), id, "not-a-uuid", 1), wantErr: true},
+		{name: "malformed player_uuid", text: strings.Replace(lines(), player, "steve", 1), wantErr: true},
+		{name: "malformed timestamp", text: strings.Replace(lines(), "1627776000", "yesterday", 1), wantErr: true},
+		{name: "malformed points", text: strings.Replace(lines(), "-0.5", "minus one", 1), wantErr: true},
+		{name: "NaN points", text: strings.Replace(lines(), "-0.5", "NaN", 1), wantErr: true},
+		{name: "Inf points", text: strings.Replace(lines(), "-0.5", "+Inf", 1), wantErr: true},
+		{name: "negative Inf points", text: strings.Replace(lines(), "-0.5", "-Infinity", 1), wantErr: true},
+		{name: "empty", text: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePayload(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePayload() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePayload() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePayload() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
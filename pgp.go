@@ -38,11 +38,20 @@ func SignatureData(text string) (string, error) {
 	var privkey string
 	err := db.QueryRow("SELECT private_key FROM Config").Scan(&privkey)
 	if err != nil {
-		return "", errors.New("无法读取本地私钥: " + err.Error())
+		return "", errors.New(T("无法读取本地私钥: ") + err.Error())
 	}
 	armored, err := helper.SignCleartextMessageArmored(privkey, nil, text)
 	if err != nil {
-		return "", errors.New("签名时发生错误: " + err.Error())
+		return "", errors.New(T("签名时发生错误: ") + err.Error())
 	}
 	return armored, nil
 }
+
+// keyFingerprint 读取公钥的指纹
+func keyFingerprint(armored string) (string, error) {
+	key, err := crypto.NewKeyFromArmored(armored)
+	if err != nil {
+		return "", errors.New(T("无法解析公钥: ") + err.Error())
+	}
+	return key.GetFingerprint(), nil
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+// mojangAPI 用于将玩家名称解析为uuid的Mojang API地址, 可以通过环境变量 OPENMPRDB_MOJANG_API 修改
+var mojangAPI = "https://api.mojang.com"
+
+// playerNameRegexp 匹配Minecraft玩家名称
+var playerNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_]{1,16}$`)
+
+// PlayerSubmission 关于某个玩家的一条提交
+type PlayerSubmission struct {
+	UUID       string  `json:"uuid"`
+	Server     string  `json:"server_uuid,omitempty"`
+	ServerName string  `json:"server_name,omitempty"`
+	Instance   string  `json:"instance,omitempty"`
+	Point      float64 `json:"point"`
+	Comment    string  `json:"comment"`
+	Timestamp  int64   `json:"timestamp,omitempty"`
+	// Fetched 缓存数据的获取时间, 只有其他服务器的提交才有
+	Fetched int64 `json:"fetched,omitempty"`
+}
+
+// PlayerOverride 玩家在本地名单中的记录
+type PlayerOverride struct {
+	Kind    string `json:"kind"`
+	Note    string `json:"note,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
+	Created int64  `json:"created"`
+	Active  bool   `json:"active"`
+}
+
+// PlayerReport 玩家在最近一次报告中的状态
+type PlayerReport struct {
+	RunID     int64    `json:"run_id"`
+	Time      int64    `json:"time"`
+	Threshold *float64 `json:"threshold"`
+	Listed    bool     `json:"listed"`
+	Point     float64  `json:"point"`
+	Banned    bool     `json:"banned"`
+}
+
+// PlayerInfo 本地已知的关于某个玩家的所有信息
+type PlayerInfo struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name,omitempty"`
+	// Submissions 本服务器的提交
+	Submissions []PlayerSubmission `json:"submissions"`
+	// Remote 信任的服务器上次获取时缓存的提交
+	Remote []PlayerSubmission `json:"remote"`
+	// Score 上次update计算出的评分, 不在报告中时为nil
+	Score    *float64        `json:"score"`
+	Override *PlayerOverride `json:"override"`
+	Report   *PlayerReport   `json:"report"`
+}
+
+// resolvePlayer 将玩家uuid或名称解析为uuid, 名称通过Mojang API查询
+func resolvePlayer(ctx context.Context, value string) (string, string, error) {
+	if player, err := normalizePlayerUUID(value); err == nil {
+		return player, "", nil
+	}
+	if !playerNameRegexp.MatchString(value) {
+		return "", "", errors.New(T("不是有效的玩家uuid或名称: ") + value)
+	}
+
+	address := mojangAPI
+	if env := os.Getenv("OPENMPRDB_MOJANG_API"); env != "" {
+		address = env
+	}
+	// GET请求: [Mojang API]/users/profiles/minecraft/<name>, 玩家不存在时返回空内容
+	content, err := httpRequestContext(ctx, "GET", "application/json", address, "/users/profiles/minecraft/"+value, nil)
+	if err != nil {
+		return "", "", err
+	}
+	var profile struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if len(content) == 0 || json.Unmarshal(content, &profile) != nil || profile.ID == "" {
+		return "", "", errors.New(T("未找到玩家: ") + value)
+	}
+	player, err := normalizePlayerUUID(profile.ID)
+	if err != nil {
+		return "", "", err
+	}
+	return player, profile.Name, nil
+}
+
+// playerInfo 汇总本地已知的关于某个玩家的信息
+func playerInfo(player, name string) (PlayerInfo, error) {
+	info := PlayerInfo{UUID: player, Name: name, Submissions: []PlayerSubmission{}, Remote: []PlayerSubmission{}}
+
+	own, err := querySubmissions(SubmissionFilter{player: player})
+	if err != nil {
+		return info, err
+	}
+	for _, i := range own {
+		info.Submissions = append(info.Submissions, PlayerSubmission{
+			UUID:      i.uuid,
+			Instance:  i.instance,
+			Point:     i.point,
+			Comment:   i.comment,
+			Timestamp: i.timestamp,
+		})
+	}
+
+	info.Remote, err = cachedPlayerSubmissions(player)
+	if err != nil {
+		return info, err
+	}
+
+	info.Score, err = playerReputation(player)
+	if err != nil {
+		return info, err
+	}
+
+	overrides, err := overrideList("")
+	if err != nil {
+		return info, err
+	}
+	now := time.Now().Unix()
+	for _, o := range overrides {
+		if o.player_uuid == player {
+			info.Override = &PlayerOverride{
+				Kind:    o.kind,
+				Note:    o.note,
+				Expires: o.expires,
+				Created: o.created,
+				Active:  o.expires == 0 || o.expires > now,
+			}
+		}
+	}
+
+	runs, err := reportRuns(1)
+	if err != nil {
+		return info, err
+	}
+	if len(runs) > 0 {
+		snapshot, err := reportSnapshot(runs[0].id)
+		if err != nil {
+			return info, err
+		}
+		entry, listed := snapshot[player]
+		info.Report = &PlayerReport{
+			RunID:     runs[0].id,
+			Time:      runs[0].time,
+			Threshold: runs[0].threshold,
+			Listed:    listed,
+			Point:     entry.point,
+			Banned:    entry.banned,
+		}
+	}
+	return info, nil
+}
+
+// showPlayer 输出某个玩家的信息, asJSON 为 true 时以JSON格式输出
+func showPlayer(ctx context.Context, value string, asJSON bool) error {
+	player, name, err := resolvePlayer(ctx, value)
+	if err != nil {
+		return err
+	}
+	info, err := playerInfo(player, name)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return errors.New(T("序列化错误: ") + err.Error())
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	formatTime := func(t int64) string {
+		if t == 0 {
+			return T("未知")
+		}
+		return time.Unix(t, 0).Format("2006-01-02 15:04:05")
+	}
+	if name != "" {
+		fmt.Printf(T("玩家: %s (%s)\n"), info.UUID, name)
+	} else {
+		fmt.Printf(T("玩家: %s\n"), info.UUID)
+	}
+
+	if info.Score != nil {
+		fmt.Printf(T("当前评分: %.2f\n"), *info.Score)
+	} else {
+		fmt.Println(T("当前评分: 不在上次的报告中"))
+	}
+
+	switch {
+	case info.Override == nil:
+		fmt.Println(T("本地名单: 无"))
+	case !info.Override.Active:
+		fmt.Printf(T("本地名单: %s (已于 %s 过期) %s\n"), info.Override.Kind, formatTime(info.Override.Expires), info.Override.Note)
+	default:
+		fmt.Printf(T("本地名单: %s %s\n"), info.Override.Kind, info.Override.Note)
+	}
+
+	switch {
+	case info.Report == nil:
+		fmt.Println(T("封禁状态: 还没有保存过报告"))
+	case info.Report.Banned:
+		fmt.Printf(T("封禁状态: 在报告 %d (%s) 中被封禁, 会被导出\n"), info.Report.RunID, formatTime(info.Report.Time))
+	default:
+		fmt.Printf(T("封禁状态: 在报告 %d (%s) 中未被封禁\n"), info.Report.RunID, formatTime(info.Report.Time))
+	}
+
+	fmt.Printf(T("\n本服务器的提交 (%d):\n"), len(info.Submissions))
+	if len(info.Submissions) > 0 {
+		fmt.Println(T("\t\t操作uuid\t\t|  评分\t|中心服务器\t|时间\t\t\t|理由"))
+		for _, i := range info.Submissions {
+			fmt.Printf("%s\t|   %.1f\t|%s\t|%s\t|%s\n", i.UUID, i.Point, i.Instance, formatTime(i.Timestamp), i.Comment)
+		}
+	}
+
+	fmt.Printf(T("\n信任的服务器的提交 (%d):\n"), len(info.Remote))
+	if len(info.Remote) > 0 {
+		fmt.Println(T("\t\t提交uuid\t\t|  评分\t|服务器\t|时间\t\t\t|理由"))
+		for _, i := range info.Remote {
+			server := i.ServerName
+			if server == "" {
+				server = i.Server
+			}
+			fmt.Printf("%s\t|   %.1f\t|%s\t|%s\t|%s\n", i.UUID, i.Point, server, formatTime(i.Timestamp), i.Comment)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolvePlayer(t *testing.T) {
+	mojang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 玩家不存在时返回空内容
+		if !strings.EqualFold(r.URL.Path, "/users/profiles/minecraft/steve") {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": "252af32189aa426ca534399f551810ae", "name": "Steve"})
+	}))
+	defer mojang.Close()
+	old, ok := os.LookupEnv("OPENMPRDB_MOJANG_API")
+	os.Setenv("OPENMPRDB_MOJANG_API", mojang.URL)
+	defer func() {
+		if ok {
+			os.Setenv("OPENMPRDB_MOJANG_API", old)
+		} else {
+			os.Unsetenv("OPENMPRDB_MOJANG_API")
+		}
+	}()
+
+	const player = "252af321-89aa-426c-a534-399f551810ae"
+	tests := []struct {
+		value   string
+		uuid    string
+		name    string
+		wantErr bool
+	}{
+		{value: "252AF32189AA426CA534399F551810AE", uuid: player},
+		{value: "steve", uuid: player, name: "Steve"},
+		{value: "Herobrine", wantErr: true},
+		{value: "not a name", wantErr: true},
+		{value: "a_name_that_is_too_long", wantErr: true},
+	}
+	for _, tt := range tests {
+		uuid, name, err := resolvePlayer(context.Background(), tt.value)
+		if (err != nil) != tt.wantErr || uuid != tt.uuid || name != tt.name {
+			t.Errorf("resolvePlayer(%q) = %q, %q, %v, want %q, %q", tt.value, uuid, name, err, tt.uuid, tt.name)
+		}
+	}
+}
+
+func TestPlayerInfo(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	privkey, server := addTestServer(t, central, 2)
+	const (
+		player  = "252af321-89aa-426c-a534-399f551810ae"
+		unknown = "00000000-0000-4000-8000-00000000000a"
+		// 缓存的提交以签名内容中的uuid为准
+		remote = "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c"
+	)
+	central.add(server.uuid, signPayload(t, privkey, remote, player, "-1"))
+	err := insertSubmission(db, SubList{uuid: "11111111-0000-4000-8000-000000000100", nonce: "7a2d0b1f-4c8e-4f3b-8d62-1e9f8a7b6c5d", instance: defaultInstance,
+		player_uuid: player, point: -0.5, comment: "griefing", timestamp: 1627776000})
+	if err == nil {
+		err = addOverride(OverrideDeny, player, "banned in game", "")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	threshold := -1.0
+	start := time.Now().Unix()
+	err = runUpdate(context.Background(), UpdateOptions{report: ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5}, threshold: &threshold})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := playerInfo(player, "Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.UUID != player || info.Name != "Steve" {
+		t.Errorf("playerInfo() = %s (%s)", info.UUID, info.Name)
+	}
+	if len(info.Submissions) != 1 || info.Submissions[0].Point != -0.5 || info.Submissions[0].Instance != defaultInstance || info.Submissions[0].Timestamp != 1627776000 {
+		t.Errorf("own submissions = %+v", info.Submissions)
+	}
+	if len(info.Remote) != 1 || info.Remote[0].UUID != remote || info.Remote[0].Server != server.uuid || info.Remote[0].ServerName != server.name ||
+		info.Remote[0].Point != -1 || info.Remote[0].Fetched < start {
+		t.Errorf("remote submissions = %+v", info.Remote)
+	}
+	// 本服务器的提交等级为5, 信任的服务器等级为1: -0.5 + -1 / 5
+	if info.Score == nil || math.Abs(*info.Score+0.7) > 1e-9 {
+		t.Errorf("score = %v, want -0.7", info.Score)
+	}
+	// 评分高于阈值, 但在强制封禁名单中
+	if info.Override == nil || info.Override.Kind != OverrideDeny || !info.Override.Active || info.Override.Note != "banned in game" {
+		t.Errorf("override = %+v", info.Override)
+	}
+	if info.Report == nil || !info.Report.Listed || !info.Report.Banned || info.Report.Threshold == nil || *info.Report.Threshold != threshold {
+		t.Errorf("report = %+v", info.Report)
+	}
+
+	// 没有任何数据的玩家
+	info, err = playerInfo(unknown, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Score != nil || info.Override != nil || info.Report == nil || info.Report.Listed || info.Report.Banned {
+		t.Errorf("playerInfo() of an unknown player = %+v", info)
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"submissions":[]`, `"remote":[]`, `"score":null`, `"override":null`, `"listed":false`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON %s does not contain %s", data, want)
+		}
+	}
+}
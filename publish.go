@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+)
+
+// publishVersion 发布的报告的格式版本
+const publishVersion = 1
+
+// ReportParams 生成报告所用的评分参数
+type ReportParams struct {
+	// Threshold 封禁的阈值, 未指定阈值时为nil, 这样的报告不能发布
+	Threshold   *float64 `json:"threshold"`
+	TrustDepth  int      `json:"trust_depth"`
+	Attenuation float64  `json:"attenuation"`
+	OnError     string   `json:"on_error"`
+}
+
+// ReportServer 为报告提供数据的服务器
+type ReportServer struct {
+	UUID        string  `json:"uuid"`
+	Fingerprint string  `json:"fingerprint"`
+	Weight      float64 `json:"weight"`
+}
+
+// ReportInputs 生成一次报告所用的输入, 以JSON保存在ReportRun中
+type ReportInputs struct {
+	// Submissions 计入报告的提交的uuid, 包括本服务器的提交
+	Submissions []string       `json:"submissions"`
+	Servers     []ReportServer `json:"servers"`
+	// Overrides 生效中的本地名单, 每项为 "玩家uuid 类型"
+	Overrides []string     `json:"overrides"`
+	Params    ReportParams `json:"params"`
+}
+
+// ReportDigest 发布的报告中输入的摘要
+type ReportDigest struct {
+	Submissions       int            `json:"submissions"`
+	SubmissionsSHA256 string         `json:"submissions_sha256"`
+	Servers           []ReportServer `json:"servers"`
+	ServersSHA256     string         `json:"servers_sha256"`
+	Overrides         int            `json:"overrides"`
+	OverridesSHA256   string         `json:"overrides_sha256"`
+	Params            ReportParams   `json:"params"`
+	ParamsSHA256      string         `json:"params_sha256"`
+}
+
+// PublishedPlayer 发布的报告中的一名玩家
+type PublishedPlayer struct {
+	UUID   string  `json:"uuid"`
+	Point  float64 `json:"point"`
+	Banned bool    `json:"banned"`
+}
+
+// PublishedReport 发布的信誉报告, 序列化为规范的JSON后由本服务器的私钥签名
+//
+// 报告的内容只取决于保存的报告快照及其输入, 同一次报告重复发布时内容相同.
+type PublishedReport struct {
+	Version   int    `json:"version"`
+	Generator string `json:"generator"`
+	// Issuer 签名所用公钥的指纹
+	Issuer   string `json:"issuer"`
+	ReportID int64  `json:"report_id"`
+	// Time 生成报告(执行update)的时间
+	Time    int64             `json:"time"`
+	Inputs  ReportDigest      `json:"inputs"`
+	Players []PublishedPlayer `json:"players"`
+}
+
+// canonical 返回排序后的副本, 使相同的输入得到相同的序列化结果
+func (in ReportInputs) canonical() ReportInputs {
+	out := ReportInputs{
+		Submissions: append([]string{}, in.Submissions...),
+		Servers:     append([]ReportServer{}, in.Servers...),
+		Overrides:   append([]string{}, in.Overrides...),
+		Params:      in.Params,
+	}
+	sort.Strings(out.Submissions)
+	sort.Strings(out.Overrides)
+	sort.Slice(out.Servers, func(i, j int) bool { return out.Servers[i].UUID < out.Servers[j].UUID })
+	return out
+}
+
+// hashLines 计算以换行符连接的各行的SHA-256
+func hashLines(lines []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashServers 计算服务器列表的SHA-256, 每行为 "uuid 指纹 权重"
+func hashServers(servers []ReportServer) string {
+	var lines []string
+	for _, s := range servers {
+		lines = append(lines, fmt.Sprintf("%s %s %s", s.UUID, s.Fingerprint, strconv.FormatFloat(s.Weight, 'g', -1, 64)))
+	}
+	return hashLines(lines)
+}
+
+// hashParams 计算评分参数JSON的SHA-256
+func hashParams(params ReportParams) (string, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return "", errors.New(T("序列化错误: ") + err.Error())
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// digest 计算输入的摘要
+func (in ReportInputs) digest() (ReportDigest, error) {
+	in = in.canonical()
+	params, err := hashParams(in.Params)
+	if err != nil {
+		return ReportDigest{}, err
+	}
+	return ReportDigest{
+		Submissions:       len(in.Submissions),
+		SubmissionsSHA256: hashLines(in.Submissions),
+		Servers:           in.Servers,
+		ServersSHA256:     hashServers(in.Servers),
+		Overrides:         len(in.Overrides),
+		OverridesSHA256:   hashLines(in.Overrides),
+		Params:            in.Params,
+		ParamsSHA256:      params,
+	}, nil
+}
+
+// buildPublishedReport 根据保存的报告生成要发布的报告, id为0时使用最近一次报告
+func buildPublishedReport(id int64) (PublishedReport, error) {
+	run, err := reportRun(id)
+	if err != nil {
+		return PublishedReport{}, err
+	}
+	// 未指定阈值时报告中的封禁状态只反映本地名单, 发布出去会被误解
+	if run.threshold == nil {
+		return PublishedReport{}, fmt.Errorf(T("报告 %d 没有指定封禁阈值, 无法发布, 请使用 less 参数重新执行 update"), run.id)
+	}
+	if run.inputs == "" {
+		return PublishedReport{}, fmt.Errorf(T("报告 %d 没有记录所用的输入, 请重新执行 update"), run.id)
+	}
+	var inputs ReportInputs
+	err = json.Unmarshal([]byte(run.inputs), &inputs)
+	if err != nil {
+		return PublishedReport{}, fmt.Errorf(T("无法读取报告 %d 的输入: %s"), run.id, err)
+	}
+	digest, err := inputs.digest()
+	if err != nil {
+		return PublishedReport{}, err
+	}
+
+	var pubkey string
+	err = db.QueryRow("SELECT public_key FROM Config").Scan(&pubkey)
+	if err != nil {
+		return PublishedReport{}, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	fingerprint, err := keyFingerprint(pubkey)
+	if err != nil {
+		return PublishedReport{}, err
+	}
+
+	snapshot, err := reportSnapshot(run.id)
+	if err != nil {
+		return PublishedReport{}, err
+	}
+	players := []PublishedPlayer{}
+	for _, entry := range snapshot {
+		players = append(players, PublishedPlayer{UUID: entry.player_uuid, Point: entry.point, Banned: entry.banned})
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].UUID < players[j].UUID })
+
+	return PublishedReport{
+		Version:   publishVersion,
+		Generator: "OpenMPRDB-CLI",
+		Issuer:    fingerprint,
+		ReportID:  run.id,
+		Time:      run.time,
+		Inputs:    digest,
+		Players:   players,
+	}, nil
+}
+
+// publishReport 签名并输出报告, output为空时输出到标准输出
+func publishReport(id int64, output string) (PublishedReport, error) {
+	report, err := buildPublishedReport(id)
+	if err != nil {
+		return report, err
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return report, errors.New(T("序列化错误: ") + err.Error())
+	}
+	signed, err := SignatureData(string(data))
+	if err != nil {
+		return report, err
+	}
+
+	if output == "" {
+		fmt.Println(signed)
+		return report, nil
+	}
+	err = writeFileAtomic(output, []byte(signed+"\n"), 0644)
+	if err != nil {
+		return report, errors.New(T("文件写入错误: ") + err.Error())
+	}
+	return report, nil
+}
+
+// findReportSigner 查找签名报告的公钥, 返回公钥和签名者的名称
+//
+// 未指定公钥文件和服务器时, 根据报告中的 issuer 在信任的服务器和本服务器中查找.
+func findReportSigner(armored, pubkeyPath, serverUUID string) (string, string, error) {
+	if pubkeyPath != "" {
+		data, err := os.ReadFile(pubkeyPath)
+		if err != nil {
+			return "", "", errors.New(T("读取指定公钥错误: ") + err.Error())
+		}
+		return string(data), pubkeyPath, nil
+	}
+
+	servers, err := serverList()
+	if err != nil {
+		return "", "", err
+	}
+	if serverUUID != "" {
+		for _, s := range servers {
+			if s.uuid == serverUUID {
+				return s.pubkey, fmt.Sprintf("%s[%s]", s.name, s.uuid), nil
+			}
+		}
+		return "", "", errors.New(T("未找到服务器: ") + serverUUID)
+	}
+
+	// 签名尚未验证, issuer 只用于查找公钥
+	message, err := crypto.NewClearTextMessageFromArmored(armored)
+	if err != nil {
+		return "", "", errors.New(T("无法解析签名的报告: ") + err.Error())
+	}
+	var report PublishedReport
+	err = json.Unmarshal(message.GetBinary(), &report)
+	if err != nil {
+		return "", "", errors.New(T("无法解析签名的报告: ") + err.Error())
+	}
+	for _, s := range servers {
+		fingerprint, err := keyFingerprint(s.pubkey)
+		if err == nil && fingerprint == report.Issuer {
+			return s.pubkey, fmt.Sprintf("%s[%s]", s.name, s.uuid), nil
+		}
+	}
+	var pubkey string
+	err = db.QueryRow("SELECT public_key FROM Config").Scan(&pubkey)
+	if err != nil {
+		return "", "", errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	if fingerprint, err := keyFingerprint(pubkey); err == nil && fingerprint == report.Issuer {
+		return pubkey, T("本服务器"), nil
+	}
+	return "", "", fmt.Errorf(T("未找到公钥指纹为 %s 的信任的服务器, 请使用 pubkey 或 server 指定签名者"), report.Issuer)
+}
+
+// verifyReport 验证他人发布的报告: 签名, 格式是否规范, 签名者是否为 issuer 以及可以重新计算的摘要
+//
+// 返回报告, 签名后的原始JSON和签名者的名称.
+func verifyReport(path, pubkeyPath, serverUUID string) (PublishedReport, string, string, error) {
+	var report PublishedReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, "", "", errors.New(T("读取报告错误: ") + err.Error())
+	}
+	pubkey, signer, err := findReportSigner(string(data), pubkeyPath, serverUUID)
+	if err != nil {
+		return report, "", "", err
+	}
+	text, err := helper.VerifyCleartextMessageArmored(pubkey, string(data), crypto.GetUnixTime())
+	if err != nil {
+		return report, "", "", errors.New(T("签名验证失败: ") + err.Error())
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&report)
+	if err != nil {
+		return report, "", "", errors.New(T("无法解析签名的报告: ") + err.Error())
+	}
+	if report.Version != publishVersion {
+		return report, "", "", fmt.Errorf(T("不支持的报告版本: %d"), report.Version)
+	}
+	canonical, err := json.Marshal(report)
+	if err != nil {
+		return report, "", "", errors.New(T("序列化错误: ") + err.Error())
+	}
+	if !bytes.Equal(canonical, []byte(text)) {
+		return report, "", "", errors.New(T("报告不是规范的JSON格式"))
+	}
+
+	fingerprint, err := keyFingerprint(pubkey)
+	if err != nil {
+		return report, "", "", err
+	}
+	if fingerprint != report.Issuer {
+		return report, "", "", fmt.Errorf(T("报告的 issuer %s 与签名者的公钥指纹 %s 不一致"), report.Issuer, fingerprint)
+	}
+
+	// 玩家须按uuid排序且不重复, 服务器列表和参数的摘要须与内容一致
+	for i := 1; i < len(report.Players); i++ {
+		if report.Players[i-1].UUID >= report.Players[i].UUID {
+			return report, "", "", errors.New(T("报告中的玩家未按uuid排序或有重复"))
+		}
+	}
+	if hashServers(report.Inputs.Servers) != report.Inputs.ServersSHA256 {
+		return report, "", "", errors.New(T("报告中的服务器列表与摘要不符"))
+	}
+	if report.Inputs.Params.Threshold == nil {
+		return report, "", "", errors.New(T("报告没有指定封禁阈值"))
+	}
+	params, err := hashParams(report.Inputs.Params)
+	if err != nil {
+		return report, "", "", err
+	}
+	if params != report.Inputs.ParamsSHA256 {
+		return report, "", "", errors.New(T("报告中的评分参数与摘要不符"))
+	}
+	return report, text, signer, nil
+}
+
+// printPublishedReport 输出报告的摘要
+func printPublishedReport(report PublishedReport, signer string) {
+	banned := 0
+	for _, p := range report.Players {
+		if p.Banned {
+			banned++
+		}
+	}
+	fmt.Printf(T("签名者: %s\n公钥指纹: %s\n报告: %d (%s)\n玩家: %d, 其中被封禁: %d\n"),
+		signer, report.Issuer, report.ReportID, time.Unix(report.Time, 0).Format("2006-01-02 15:04:05"), len(report.Players), banned)
+	fmt.Printf(T("提交: %d (sha256 %s)\n本地名单: %d (sha256 %s)\n"),
+		report.Inputs.Submissions, report.Inputs.SubmissionsSHA256, report.Inputs.Overrides, report.Inputs.OverridesSHA256)
+	fmt.Printf(T("参数: 阈值 %s, 信任深度 %d, 衰减系数 %g, 获取失败时 %s (sha256 %s)\n"),
+		formatThreshold(report.Inputs.Params.Threshold), report.Inputs.Params.TrustDepth, report.Inputs.Params.Attenuation, report.Inputs.Params.OnError, report.Inputs.ParamsSHA256)
+	fmt.Printf(T("服务器: %d (sha256 %s)\n"), len(report.Inputs.Servers), report.Inputs.ServersSHA256)
+	fmt.Println(T("\t\t服务器uuid\t\t|公钥指纹\t\t\t\t\t|权重"))
+	for _, s := range report.Inputs.Servers {
+		fmt.Printf("%s\t|%s\t|%.2f\n", s.UUID, s.Fingerprint, s.Weight)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+)
+
+func TestVerifyReport(t *testing.T) {
+	key, err := crypto.GenerateKey("OpenMPRDB-CLI test", "test@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privkey, err := key.Armor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkey, err := key.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	pubkeyPath := filepath.Join(dir, "rsa-pub.pem")
+	err = os.WriteFile(pubkeyPath, []byte(pubkey), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	threshold := -0.5
+	digest, err := ReportInputs{
+		Submissions: []string{"b", "a"},
+		Servers:     []ReportServer{{UUID: "00000000-0000-4000-8000-000000000002", Fingerprint: "ff", Weight: 1}},
+		Params:      ReportParams{Threshold: &threshold, TrustDepth: 1, Attenuation: 0.5, OnError: OnErrorFail},
+	}.digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := func() PublishedReport {
+		return PublishedReport{
+			Version:   publishVersion,
+			Generator: "OpenMPRDB-CLI",
+			Issuer:    key.GetFingerprint(),
+			ReportID:  3,
+			Time:      1627776000,
+			Inputs:    digest,
+			Players: []PublishedPlayer{
+				{UUID: "252af321-89aa-426c-a534-399f551810ae", Point: -1, Banned: true},
+				{UUID: "2b0d7f3e-8c4a-4f19-a6e2-5d9c1b7e3f80", Point: 0.5},
+			},
+		}
+	}
+	marshal := func(report PublishedReport) string {
+		data, err := json.Marshal(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		// tamper 修改签名后的报告, 为nil时不修改
+		tamper  func(string) string
+		wantErr string
+	}{
+		{name: "canonical", text: marshal(valid())},
+		{
+			name: "indented",
+			text: func() string {
+				data, _ := json.MarshalIndent(valid(), "", "  ")
+				return string(data)
+			}(),
+			wantErr: T("报告不是规范的JSON格式"),
+		},
+		{
+			name:    "fields reordered",
+			text:    strings.Replace(marshal(valid()), `{"version":1,"generator":"OpenMPRDB-CLI",`, `{"generator":"OpenMPRDB-CLI","version":1,`, 1),
+			wantErr: T("报告不是规范的JSON格式"),
+		},
+		{
+			name:    "number not in shortest form",
+			text:    strings.Replace(marshal(valid()), `"point":0.5`, `"point":0.50`, 1),
+			wantErr: T("报告不是规范的JSON格式"),
+		},
+		{
+			name:    "unknown field",
+			text:    strings.Replace(marshal(valid()), `{"version":1,`, `{"version":1,"comment":"",`, 1),
+			wantErr: T("无法解析签名的报告: "),
+		},
+		{
+			name: "unsupported version",
+			text: func() string {
+				report := valid()
+				report.Version = publishVersion + 1
+				return marshal(report)
+			}(),
+			wantErr: fmt.Sprintf(T("不支持的报告版本: %d"), publishVersion+1),
+		},
+		{
+			name: "players out of order",
+			text: func() string {
+				report := valid()
+				report.Players[0], report.Players[1] = report.Players[1], report.Players[0]
+				return marshal(report)
+			}(),
+			wantErr: T("报告中的玩家未按uuid排序或有重复"),
+		},
+		{
+			name: "duplicate player",
+			text: func() string {
+				report := valid()
+				report.Players[1].UUID = report.Players[0].UUID
+				return marshal(report)
+			}(),
+			wantErr: T("报告中的玩家未按uuid排序或有重复"),
+		},
+		{
+			name: "servers do not match digest",
+			text: func() string {
+				report := valid()
+				report.Inputs.Servers = []ReportServer{{UUID: "00000000-0000-4000-8000-000000000002", Fingerprint: "ff", Weight: 2}}
+				return marshal(report)
+			}(),
+			wantErr: T("报告中的服务器列表与摘要不符"),
+		},
+		{
+			name: "params do not match digest",
+			text: func() string {
+				report := valid()
+				report.Inputs.Params.TrustDepth = 2
+				return marshal(report)
+			}(),
+			wantErr: T("报告中的评分参数与摘要不符"),
+		},
+		{
+			name: "no threshold",
+			text: func() string {
+				report := valid()
+				report.Inputs.Params.Threshold = nil
+				return marshal(report)
+			}(),
+			wantErr: T("报告没有指定封禁阈值"),
+		},
+		{
+			name: "tampered after signing",
+			text: marshal(valid()),
+			tamper: func(signed string) string {
+				return strings.Replace(signed, `"banned":true`, `"banned":false`, 1)
+			},
+			wantErr: T("签名验证失败: "),
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := helper.SignCleartextMessageArmored(privkey, nil, tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				signed = tt.tamper(signed)
+			}
+			path := filepath.Join(dir, fmt.Sprintf("report-%d.asc", i))
+			err = os.WriteFile(path, []byte(signed+"\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, text, signer, err := verifyReport(path, pubkeyPath, "")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyReport() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyReport() error = %v", err)
+			}
+			if text != tt.text {
+				t.Errorf("verifyReport() text = %q, want %q", text, tt.text)
+			}
+			if signer != pubkeyPath {
+				t.Errorf("verifyReport() signer = %q, want %q", signer, pubkeyPath)
+			}
+			if marshal(report) != tt.text {
+				t.Errorf("verifyReport() report = %+v", report)
+			}
+		})
+	}
+}
+
+func TestPublishReport(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	privkey, server := addTestServer(t, central, 2)
+	const (
+		griefer = "252af321-89aa-426c-a534-399f551810ae"
+		other   = "2b0d7f3e-8c4a-4f19-a6e2-5d9c1b7e3f80"
+	)
+	central.add(server.uuid, signPayload(t, privkey, "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", griefer, "-1"))
+	central.add(server.uuid, signPayload(t, privkey, "7a2d0b1f-4c8e-4f3b-8d62-1e9f8a7b6c5d", other, "-1"))
+	err := insertSubmission(db, SubList{uuid: "11111111-0000-4000-8000-000000000100", nonce: "8b3e1c2a-5d9f-4a4c-9e73-2fa09b8c7d6e", instance: defaultInstance,
+		player_uuid: griefer, point: -0.5, comment: "griefing", timestamp: 1627776000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := func(threshold *float64) {
+		t.Helper()
+		err := runUpdate(context.Background(), UpdateOptions{report: ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5}, threshold: threshold})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 没有阈值的报告不能发布
+	update(nil)
+	if _, err := buildPublishedReport(0); err == nil || err.Error() != fmt.Sprintf(T("报告 %d 没有指定封禁阈值, 无法发布, 请使用 less 参数重新执行 update"), 1) {
+		t.Errorf("buildPublishedReport() without a threshold = %v", err)
+	}
+	threshold := -0.5
+	update(&threshold)
+	if _, err := buildPublishedReport(1); err == nil {
+		t.Error("buildPublishedReport(1) without a threshold succeeded")
+	}
+	if _, err := buildPublishedReport(9); err == nil {
+		t.Error("buildPublishedReport() of an unknown report succeeded")
+	}
+
+	path := filepath.Join(t.TempDir(), "report.asc")
+	published, err := publishReport(0, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := keyFingerprint(testLocalKey.public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverFingerprint, err := keyFingerprint(server.pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 本服务器的提交等级为5, 信任的服务器等级为1
+	want := []PublishedPlayer{{UUID: griefer, Point: -0.7, Banned: true}, {UUID: other, Point: -0.2}}
+	if published.ReportID != 2 || published.Issuer != fingerprint || published.Inputs.Submissions != 3 ||
+		len(published.Inputs.Servers) != 1 || published.Inputs.Servers[0].UUID != server.uuid || published.Inputs.Servers[0].Fingerprint != serverFingerprint ||
+		published.Inputs.Params.Threshold == nil || *published.Inputs.Params.Threshold != threshold {
+		t.Errorf("publishReport() = %+v", published)
+	}
+	if len(published.Players) != len(want) {
+		t.Fatalf("published players = %+v, want %+v", published.Players, want)
+	}
+	for i := range want {
+		got := published.Players[i]
+		if got.UUID != want[i].UUID || math.Abs(got.Point-want[i].Point) > 1e-9 || got.Banned != want[i].Banned {
+			t.Errorf("published player %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	// 本服务器验证自己发布的报告
+	report, _, signer, err := verifyReport(path, "", "")
+	if err != nil || signer != T("本服务器") || report.ReportID != published.ReportID || len(report.Players) != len(want) {
+		t.Errorf("verifyReport() = %+v, %q, %v", report, signer, err)
+	}
+
+	// 另一台信任本服务器的服务器验证报告
+	newTestDB(t)
+	useOtherKey(t)
+	if _, _, _, err := verifyReport(path, "", ""); err == nil {
+		t.Error("verifyReport() of a report from an untrusted server succeeded")
+	}
+	err = insertServer(testLocalUUID, "origin", testLocalKey.public, 3, defaultInstance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, signer, err := verifyReport(path, "", ""); err != nil || signer != fmt.Sprintf("origin[%s]", testLocalUUID) {
+		t.Errorf("verifyReport() by issuer = %q, %v", signer, err)
+	}
+	if _, _, signer, err := verifyReport(path, "", testLocalUUID); err != nil || signer != fmt.Sprintf("origin[%s]", testLocalUUID) {
+		t.Errorf("verifyReport() by server = %q, %v", signer, err)
+	}
+	if _, _, _, err := verifyReport(path, "", server.uuid); err == nil {
+		t.Error("verifyReport() with an unknown server succeeded")
+	}
+}
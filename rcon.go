@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"text/template"
+	"time"
+)
+
+// RCON 数据包的种类
+const (
+	rconAuth         = 3
+	rconAuthResponse = 2
+	rconCommand      = 2
+	rconResponse     = 0
+)
+
+// rconTimeout 连接以及每次读写的超时时间
+const rconTimeout = 10 * time.Second
+
+// rconMaxPacket 数据包的最大长度, 游戏服务器的单个响应最多4096字节
+const rconMaxPacket = 4096 + 10
+
+// RconOptions 将报告的变化推送到游戏服务器的参数
+type RconOptions struct {
+	// address 游戏服务器的RCON地址, 为空时不推送
+	address  string
+	password string
+	// ban, pardon 封禁和解除封禁的命令模板, 可以使用 .UUID, .Before 和 .After
+	ban    string
+	pardon string
+}
+
+// rconClient 一个已登录的RCON连接
+type rconClient struct {
+	conn net.Conn
+	id   int32
+}
+
+// dialRcon 连接游戏服务器并登录
+func dialRcon(address, password string) (*rconClient, error) {
+	conn, err := net.DialTimeout("tcp", address, rconTimeout)
+	if err != nil {
+		return nil, errors.New(T("RCON 连接错误: ") + err.Error())
+	}
+	c := &rconClient{conn: conn}
+	id, err := c.write(rconAuth, password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	for {
+		resID, kind, _, err := c.read()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// 部分服务器在登录结果前会先返回一个空的响应
+		if kind != rconAuthResponse {
+			continue
+		}
+		if resID == -1 || resID != id {
+			conn.Close()
+			return nil, errors.New(T("RCON 登录失败, 请检查密码"))
+		}
+		return c, nil
+	}
+}
+
+// write 发送一个数据包, 返回其编号
+func (c *rconClient) write(kind int32, body string) (int32, error) {
+	c.id++
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, int32(len(body)+10))
+	binary.Write(&buf, binary.LittleEndian, c.id)
+	binary.Write(&buf, binary.LittleEndian, kind)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+	c.conn.SetDeadline(time.Now().Add(rconTimeout))
+	_, err := c.conn.Write(buf.Bytes())
+	if err != nil {
+		return 0, errors.New(T("RCON 发送错误: ") + err.Error())
+	}
+	return c.id, nil
+}
+
+// read 读取一个数据包
+func (c *rconClient) read() (id, kind int32, body string, err error) {
+	c.conn.SetDeadline(time.Now().Add(rconTimeout))
+	var length int32
+	err = binary.Read(c.conn, binary.LittleEndian, &length)
+	if err == nil && (length < 10 || length > rconMaxPacket) {
+		err = fmt.Errorf(T("数据包长度异常: %d"), length)
+	}
+	if err != nil {
+		return 0, 0, "", errors.New(T("RCON 读取错误: ") + err.Error())
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(c.conn, data)
+	if err != nil {
+		return 0, 0, "", errors.New(T("RCON 读取错误: ") + err.Error())
+	}
+	id = int32(binary.LittleEndian.Uint32(data[0:4]))
+	kind = int32(binary.LittleEndian.Uint32(data[4:8]))
+	return id, kind, string(bytes.TrimRight(data[8:], "\x00")), nil
+}
+
+// command 执行一条命令并返回其输出, 只读取第一个响应包
+func (c *rconClient) command(cmd string) (string, error) {
+	id, err := c.write(rconCommand, cmd)
+	if err != nil {
+		return "", err
+	}
+	for {
+		resID, kind, body, err := c.read()
+		if err != nil {
+			return "", err
+		}
+		if resID == id && kind == rconResponse {
+			return body, nil
+		}
+	}
+}
+
+// Close 关闭连接
+func (c *rconClient) Close() error {
+	return c.conn.Close()
+}
+
+// checkCommandTemplate 检查命令模板
+func checkCommandTemplate(text string) error {
+	_, err := template.New("rcon").Parse(text)
+	if err != nil {
+		return errors.New(T("模板解析错误: ") + err.Error())
+	}
+	return nil
+}
+
+// renderCommand 使用玩家评分的变化生成命令
+func renderCommand(text string, change PlayerChange) (string, error) {
+	tmpl, err := template.New("rcon").Parse(text)
+	if err != nil {
+		return "", errors.New(T("模板解析错误: ") + err.Error())
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, change)
+	if err != nil {
+		return "", errors.New(T("模板执行错误: ") + err.Error())
+	}
+	return buf.String(), nil
+}
+
+// pushReport 将与上一次报告相比新封禁和解除封禁的玩家通过RCON推送到游戏服务器
+func pushReport(opts RconOptions, diff ReportDiff) error {
+	if opts.address == "" || len(diff.banned)+len(diff.cleared) == 0 {
+		return nil
+	}
+	var commands []string
+	for _, list := range []struct {
+		template string
+		entries  []DiffEntry
+	}{{opts.ban, diff.banned}, {opts.pardon, diff.cleared}} {
+		for _, i := range list.entries {
+			cmd, err := renderCommand(list.template, PlayerChange{UUID: i.player_uuid, Before: i.before, After: i.after})
+			if err != nil {
+				return err
+			}
+			commands = append(commands, cmd)
+		}
+	}
+
+	client, err := dialRcon(opts.address, opts.password)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	for i, cmd := range commands {
+		res, err := client.command(cmd)
+		if err != nil {
+			return fmt.Errorf(T("RCON 命令 %s 执行失败: %s, 其余 %d 条命令未执行"), cmd, err, len(commands)-i-1)
+		}
+		logger.Info("已执行 RCON 命令", F("command", cmd), F("response", res))
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRcon 模拟的游戏服务器RCON, 记录收到的命令
+type fakeRcon struct {
+	net.Listener
+	password string
+	mu       sync.Mutex
+	commands []string
+	logins   int
+}
+
+// newFakeRcon 在随机端口上启动模拟的RCON
+func newFakeRcon(t *testing.T, password string) *fakeRcon {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRcon{Listener: l, password: password}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+// writeRconPacket 发送一个数据包
+func writeRconPacket(w io.Writer, id, kind int32, body string) {
+	buf := make([]byte, 12, 14+len(body))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(body)+10))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(id))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(kind))
+	buf = append(append(buf, body...), 0, 0)
+	w.Write(buf)
+}
+
+// serve 处理一个连接, 与 Source 服务器一样在登录结果前先返回一个空的响应
+func (r *fakeRcon) serve(conn net.Conn) {
+	defer conn.Close()
+	authed := false
+	for {
+		var header [12]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		length := int32(binary.LittleEndian.Uint32(header[0:]))
+		id := int32(binary.LittleEndian.Uint32(header[4:]))
+		kind := int32(binary.LittleEndian.Uint32(header[8:]))
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		text := strings.TrimRight(string(body), "\x00")
+		switch {
+		case kind == rconAuth:
+			r.mu.Lock()
+			r.logins++
+			r.mu.Unlock()
+			writeRconPacket(conn, id, rconResponse, "")
+			if text != r.password {
+				id = -1
+			}
+			authed = text == r.password
+			writeRconPacket(conn, id, rconAuthResponse, "")
+		case kind == rconCommand && authed:
+			r.mu.Lock()
+			r.commands = append(r.commands, text)
+			r.mu.Unlock()
+			writeRconPacket(conn, id, rconResponse, "ok: "+text)
+		default:
+			return
+		}
+	}
+}
+
+func TestPushReport(t *testing.T) {
+	const (
+		banned  = "00000000-0000-4000-8000-00000000000a"
+		cleared = "00000000-0000-4000-8000-00000000000b"
+	)
+	diff := ReportDiff{
+		banned:  []DiffEntry{{player_uuid: banned, before: 0, after: -1.5}},
+		cleared: []DiffEntry{{player_uuid: cleared, before: -1, after: 0}},
+	}
+	server := newFakeRcon(t, "secret")
+	opts := RconOptions{
+		address:  server.Addr().String(),
+		password: "secret",
+		ban:      `ban {{.UUID}} score {{printf "%.1f" .After}}`,
+		pardon:   "pardon {{.UUID}}",
+	}
+
+	// 未指定地址或没有变化时不连接
+	err := pushReport(RconOptions{}, diff)
+	if err == nil {
+		err = pushReport(opts, ReportDiff{})
+	}
+	if err != nil || server.logins != 0 {
+		t.Fatalf("pushReport() without address or changes = %v after %d logins", err, server.logins)
+	}
+
+	err = pushReport(opts, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ban " + banned + " score -1.5", "pardon " + cleared}
+	server.mu.Lock()
+	got := server.commands
+	server.mu.Unlock()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+
+	opts.password = "wrong"
+	err = pushReport(opts, diff)
+	if err == nil || err.Error() != T("RCON 登录失败, 请检查密码") {
+		t.Errorf("pushReport() with a wrong password error = %v", err)
+	}
+	opts.password = "secret"
+	opts.ban = "ban {{.Name}}"
+	if pushReport(opts, diff) == nil {
+		t.Error("pushReport() with an invalid template succeeded")
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.commands) != len(want) {
+		t.Errorf("commands after failed pushes = %q", server.commands)
+	}
+}
+
+func TestRunUpdatePushesRcon(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	privkey, server := addTestServer(t, central, 2)
+	rcon := newFakeRcon(t, "secret")
+	threshold := -0.1
+	opts := UpdateOptions{
+		report:    ReportOptions{onError: OnErrorFail, trustDepth: 1, attenuation: 0.5},
+		threshold: &threshold,
+		rcon:      RconOptions{address: rcon.Addr().String(), password: "secret", ban: "ban {{.UUID}}", pardon: "pardon {{.UUID}}"},
+	}
+	const (
+		first  = "252af321-89aa-426c-a534-399f551810ae"
+		second = "00000000-0000-4000-8000-00000000000b"
+	)
+	// 第一次报告没有可比较的上一次报告, 不推送
+	central.add(server.uuid, signPayload(t, privkey, "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", first, "-1"))
+	err := runUpdate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	central.add(server.uuid, signPayload(t, privkey, "7a2d0b1f-4c8e-4f3b-8d62-1e9f8a7b6c5d", second, "-1"))
+	err = addOverride(OverrideAllow, first, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = runUpdate(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ban " + second, "pardon " + first}
+	rcon.mu.Lock()
+	defer rcon.mu.Unlock()
+	if fmt.Sprint(rcon.commands) != fmt.Sprint(want) {
+		t.Errorf("commands = %q, want %q", rcon.commands, want)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ReportEntry 报告快照中的一名玩家
+type ReportEntry struct {
+	player_uuid string
+	point       float64
+	banned      bool
+}
+
+// DiffEntry 两次报告之间一名玩家的变化
+type DiffEntry struct {
+	player_uuid string
+	before      float64
+	after       float64
+}
+
+// ReportDiff 两次报告之间的差异
+type ReportDiff struct {
+	from ReportRun
+	to   ReportRun
+	// banned 新被封禁的玩家
+	banned []DiffEntry
+	// cleared 不再被封禁的玩家
+	cleared []DiffEntry
+	// changed 评分变化超过阈值的玩家
+	changed []DiffEntry
+}
+
+// findReportRuns 根据since找到要比较的两次报告, to为最近一次报告
+//
+// since 为 "last" 时与上一次使用相同阈值的报告比较, 否则为报告编号.
+// 阈值不同的报告中被封禁的玩家不可比较, 因此只比较使用相同阈值的报告.
+func findReportRuns(since string) (from, to ReportRun, err error) {
+	to, err = reportRun(0)
+	if err != nil {
+		return
+	}
+
+	if since == "" || since == "last" {
+		var ok bool
+		from, ok, err = previousReportRun(to)
+		if err == nil && !ok {
+			err = errors.New(T("没有使用相同阈值的上一次报告, 无法比较"))
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(since, 10, 64)
+	if err != nil {
+		err = errors.New(T("无法识别的报告编号: ") + since)
+		return
+	}
+	from, err = reportRun(id)
+	if err != nil {
+		return
+	}
+	if !sameThreshold(from.threshold, to.threshold) {
+		err = fmt.Errorf(T("报告 %d 与报告 %d 的阈值不同 (%s, %s), 无法比较"), from.id, to.id, formatThreshold(from.threshold), formatThreshold(to.threshold))
+	}
+	return
+}
+
+// sameThreshold 判断两次报告的阈值是否相同
+func sameThreshold(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// formatThreshold 输出阈值, 未指定时为 "未指定"
+func formatThreshold(threshold *float64) string {
+	if threshold == nil {
+		return T("未指定")
+	}
+	return strconv.FormatFloat(*threshold, 'g', -1, 64)
+}
+
+// diffReports 比较两次报告, 评分变化的绝对值不小于delta的玩家会被列入changed
+func diffReports(from, to ReportRun, delta float64) (ReportDiff, error) {
+	diff := ReportDiff{from: from, to: to}
+	before, err := reportSnapshot(from.id)
+	if err != nil {
+		return diff, err
+	}
+	after, err := reportSnapshot(to.id)
+	if err != nil {
+		return diff, err
+	}
+
+	// 在任一次报告中出现的玩家, 未出现时视为0分且未被封禁
+	players := make(map[string]bool)
+	for player := range before {
+		players[player] = true
+	}
+	for player := range after {
+		players[player] = true
+	}
+	for player := range players {
+		b, a := before[player], after[player]
+		entry := DiffEntry{player_uuid: player, before: b.point, after: a.point}
+		switch {
+		case a.banned && !b.banned:
+			diff.banned = append(diff.banned, entry)
+		case b.banned && !a.banned:
+			diff.cleared = append(diff.cleared, entry)
+		}
+		if math.Abs(a.point-b.point) >= delta && a.point != b.point {
+			diff.changed = append(diff.changed, entry)
+		}
+	}
+
+	for _, list := range [][]DiffEntry{diff.banned, diff.cleared, diff.changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].player_uuid < list[j].player_uuid })
+	}
+	return diff, nil
+}
+
+// printReportDiff 输出两次报告之间的差异
+func printReportDiff(diff ReportDiff) {
+	fmt.Printf(T("报告 %d (%s) -> 报告 %d (%s)\n"),
+		diff.from.id, time.Unix(diff.from.time, 0).Format("2006-01-02 15:04:05"),
+		diff.to.id, time.Unix(diff.to.time, 0).Format("2006-01-02 15:04:05"))
+	sections := []struct {
+		title string
+		list  []DiffEntry
+	}{
+		{T("新封禁"), diff.banned},
+		{T("已解除"), diff.cleared},
+		{T("评分变化"), diff.changed},
+	}
+	for _, section := range sections {
+		fmt.Printf("%s (%d):\n", section.title, len(section.list))
+		if len(section.list) == 0 {
+			continue
+		}
+		fmt.Println(T("\t\t玩家uuid\t\t|之前\t|之后"))
+		for _, i := range section.list {
+			fmt.Println(fmt.Sprintf("%s\t|%.1f\t|%.1f", i.player_uuid, i.before, i.after))
+		}
+	}
+}
+
+// saveReport 保存本次update的报告及其输入, 并输出与上一次报告相比的变化
+func saveReport(threshold *float64, list []ReportList, inputs ReportInputs) (ReportDiff, error) {
+	data, err := json.Marshal(inputs.canonical())
+	if err != nil {
+		return ReportDiff{}, errors.New(T("序列化错误: ") + err.Error())
+	}
+	id, err := insertReportRun(threshold, list, string(data))
+	if err != nil {
+		return ReportDiff{}, err
+	}
+	to, err := reportRun(id)
+	if err != nil {
+		return ReportDiff{}, err
+	}
+	from, ok, err := previousReportRun(to)
+	if err != nil {
+		return ReportDiff{}, err
+	}
+	if !ok {
+		logger.Info("报告已保存", F("run_id", id))
+		return ReportDiff{to: to}, nil
+	}
+	diff, err := diffReports(from, to, math.Inf(1))
+	if err != nil {
+		return ReportDiff{}, err
+	}
+	logger.Info("报告已保存", F("run_id", id), F("banned", len(diff.banned)), F("cleared", len(diff.cleared)))
+	return diff, nil
+}
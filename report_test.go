@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestReportDiff(t *testing.T) {
+	newTestDB(t)
+	const (
+		stays     = "00000000-0000-4000-8000-00000000000a"
+		newBan    = "00000000-0000-4000-8000-00000000000b"
+		recovered = "00000000-0000-4000-8000-00000000000c"
+		gone      = "00000000-0000-4000-8000-00000000000d"
+		appeared  = "00000000-0000-4000-8000-00000000000e"
+	)
+	threshold := -1.0
+	other := -0.5
+	save := func(threshold *float64, list []ReportList) ReportDiff {
+		t.Helper()
+		diff, err := saveReport(threshold, list, ReportInputs{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return diff
+	}
+
+	first := save(&threshold, []ReportList{
+		{player_uuid: stays, point: -2},
+		{player_uuid: newBan, point: -0.8},
+		{player_uuid: recovered, point: -1.2},
+		{player_uuid: gone, point: -3},
+	})
+	if first.from.id != 0 || first.to.id == 0 || len(first.banned)+len(first.cleared) != 0 {
+		t.Errorf("first saveReport() = %+v, want no previous report", first)
+	}
+	// 阈值不同的报告不参与比较
+	save(&other, []ReportList{{player_uuid: stays, point: 0}})
+	save(nil, []ReportList{{player_uuid: stays, point: -5}})
+
+	second := save(&threshold, []ReportList{
+		{player_uuid: stays, point: -2.1},
+		{player_uuid: newBan, point: -1.5},
+		{player_uuid: recovered, point: 0.5},
+		{player_uuid: appeared, point: -1},
+	})
+	if second.from.id != first.to.id {
+		t.Errorf("saveReport() compared with report %d, want %d", second.from.id, first.to.id)
+	}
+	entries := func(list []DiffEntry) string {
+		var out []string
+		for _, i := range list {
+			out = append(out, fmt.Sprintf("%s %.1f %.1f", i.player_uuid, i.before, i.after))
+		}
+		return fmt.Sprint(out)
+	}
+	wantBanned := fmt.Sprint([]string{newBan + " -0.8 -1.5", appeared + " 0.0 -1.0"})
+	wantCleared := fmt.Sprint([]string{recovered + " -1.2 0.5", gone + " -3.0 0.0"})
+	if entries(second.banned) != wantBanned || entries(second.cleared) != wantCleared {
+		t.Errorf("saveReport() banned %s, cleared %s, want %s and %s", entries(second.banned), entries(second.cleared), wantBanned, wantCleared)
+	}
+	if len(second.changed) != 0 {
+		t.Errorf("saveReport() listed changed players: %s", entries(second.changed))
+	}
+
+	from, to, err := findReportRuns("last")
+	if err != nil || from.id != first.to.id || to.id != second.to.id {
+		t.Fatalf("findReportRuns(last) = %d, %d, %v, want %d, %d", from.id, to.id, err, first.to.id, second.to.id)
+	}
+	diff, err := diffReports(from, to, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanged := fmt.Sprint([]string{newBan + " -0.8 -1.5", recovered + " -1.2 0.5", gone + " -3.0 0.0", appeared + " 0.0 -1.0"})
+	if entries(diff.changed) != wantChanged {
+		t.Errorf("diffReports(delta 0.5) changed %s, want %s", entries(diff.changed), wantChanged)
+	}
+	diff, err = diffReports(from, to, math.Inf(1))
+	if err != nil || len(diff.changed) != 0 || entries(diff.banned) != wantBanned {
+		t.Errorf("diffReports(delta inf) = %+v, %v", diff, err)
+	}
+
+	_, _, err = findReportRuns(fmt.Sprint(first.to.id + 1))
+	if err == nil {
+		t.Error("findReportRuns() with a different threshold succeeded")
+	}
+	_, _, err = findReportRuns("neko")
+	if err == nil {
+		t.Error("findReportRuns() with a malformed id succeeded")
+	}
+	_, _, err = findReportRuns("100")
+	if err == nil {
+		t.Error("findReportRuns() with an unknown id succeeded")
+	}
+}
+
+func TestReportDiffWithoutThreshold(t *testing.T) {
+	newTestDB(t)
+	const (
+		scored = "00000000-0000-4000-8000-00000000000a"
+		denied = "00000000-0000-4000-8000-00000000000b"
+	)
+	_, _, err := findReportRuns("last")
+	if err == nil {
+		t.Error("findReportRuns() without any report succeeded")
+	}
+	// 未指定阈值时只有强制封禁的玩家记为被封禁
+	saveReport(nil, []ReportList{{player_uuid: scored, point: -5}}, ReportInputs{})
+	diff, err := saveReport(nil, []ReportList{{player_uuid: scored, point: -5}, {player_uuid: denied, override: OverrideDeny}}, ReportInputs{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.banned) != 1 || diff.banned[0].player_uuid != denied || len(diff.cleared) != 0 {
+		t.Errorf("saveReport() without threshold = %+v, want only %s banned", diff, denied)
+	}
+}
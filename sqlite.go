@@ -2,10 +2,12 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
-
-	"log"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -17,6 +19,18 @@ var db *sql.DB
 type ReportList struct {
 	player_uuid string
 	point       float64
+	// override 生效中的本地名单, OverrideAllow, OverrideDeny 或为空
+	override string
+}
+
+// Override 本地名单中的一项
+type Override struct {
+	player_uuid string
+	kind        string
+	note        string
+	// expires 过期时间, 为0时永不过期
+	expires int64
+	created int64
 }
 
 // SubList 提交列表
@@ -25,43 +39,299 @@ type SubList struct {
 	player_uuid string
 	comment     string
 	point       float64
-	level       int
+	// level 来源服务器的有效信任等级, 间接信任的服务器可能不是整数
+	level     float64
+	timestamp int64
+	// instance 提交到的中心服务器
+	instance string
+	// nonce 签名内容中的uuid, 同一提交发往多个中心服务器时相同
+	nonce string
+	// message 签名后的原始内容, 只有本服务器的提交才有
+	message string
+	// operator 提交的操作者, 只有本服务器的提交才有
+	operator string
+	// supersedes 被该提交替代的提交的uuid
+	supersedes string
+}
+
+// Instance 一个OpenMPRDB中心服务器, 以及本服务器在其上的注册信息
+type Instance struct {
+	name           string
+	server_address string
+	server_name    string
+	// uuid 本服务器在该中心服务器上的uuid
+	uuid string
+}
+
+// Rejection 被拒绝的远程提交
+type Rejection struct {
+	server_uuid string
+	server_name string
+	uuid        string
+	reason      string
+	content     string
+	time        int64
 }
 
 type ServerList struct {
-	uuid   string
-	name   string
-	pubkey string
-	level  int
-	end    bool
+	uuid      string
+	name      string
+	pubkey    string
+	level     int
+	disabled  bool
+	trust_url string
+	instance  string
+	end       bool
+	// weight 生成报告时使用的有效信任等级, 直接信任的服务器即为level
+	weight float64
+	// via 间接信任时, 声明信任该服务器的服务器uuid
+	via         string
+	depth       int
+	fingerprint string
 }
 
-//Init 初始化数据库, 当数据库文件不存在时将创建一个默认的数据库文件
-func init() {
+//prepareDB 初始化数据库, 当数据库文件不存在时将创建一个默认的数据库文件
+func prepareDB() error {
 	// 检查本地数据库是否存在
 	if !Exists(SqlPath) {
-		log.Println("数据库文件不存在, 将在默认位置初始化数据库文件")
+		logger.Info("数据库文件不存在, 将在默认位置初始化数据库文件", F("path", SqlPath))
 		// 初始化本地密钥
 		err := initializationKey()
 		if err != nil {
-			log.Fatalln(err)
+			return errors.New(T("生成密钥错误: ") + err.Error())
 		}
-		log.Println("密钥文件生成成功, 请妥善保管相关副本")
+		logger.Info("密钥文件生成成功, 请妥善保管相关副本")
 		InitializeDB()
-
 	}
+	return openDB()
+}
+
+// openDB 打开数据库并升级数据库结构
+func openDB() error {
 	var err error
 	// charset=utf 用于指示打开/新建文件时使用的字符编码类型
 	db, err = sql.Open("sqlite3", SqlPath+"?charset=utf&cache=shared&mode=memory")
 	if err != nil {
-		log.Fatalf("打开数据库错误: %s", err)
+		return errors.New(T("打开数据库错误: ") + err.Error())
 	}
 
 	// 尝试与数据库建立连接
 	err = db.Ping()
 	if err != nil {
-		log.Fatalf("连接数据库错误: %s", err)
+		return errors.New(T("连接数据库错误: ") + err.Error())
+	}
+
+	// 升级数据库结构
+	err = migrateDB()
+	if err != nil {
+		return errors.New(T("升级数据库错误: ") + err.Error())
 	}
+	return nil
+}
+
+// openDBReadOnly 以只读方式打开已有的数据库, 不会创建数据库文件或升级数据库结构
+func openDBReadOnly() error {
+	if !Exists(SqlPath) {
+		return errors.New(T("数据库文件不存在: ") + SqlPath)
+	}
+	var err error
+	// 只有 file: 形式的地址才会把 mode 交给 SQLite 处理
+	db, err = sql.Open("sqlite3", "file:"+SqlPath+"?mode=ro")
+	if err != nil {
+		return errors.New(T("打开数据库错误: ") + err.Error())
+	}
+	err = db.Ping()
+	if err != nil {
+		return errors.New(T("连接数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// migrations 数据库结构的变更, 按顺序执行, 下标+1即为对应的结构版本(PRAGMA user_version)
+var migrations = []string{
+	// 1: 表Rejection, 记录被拒绝的远程提交
+	`
+	CREATE TABLE IF NOT EXISTS Rejection(
+		server_uuid TEXT NULL,
+		uuid TEXT NULL,
+		reason TEXT NULL,
+		content TEXT NULL,
+		time INTEGER NULL,
+		UNIQUE(server_uuid, uuid)
+	);
+	`,
+	// 2: 表ServerCache, 缓存各服务器最近一次成功获取的数据
+	`
+	CREATE TABLE IF NOT EXISTS ServerCache(
+		server_uuid TEXT NULL,
+		uuid TEXT NULL,
+		player_uuid TEXT NULL,
+		comment TEXT NULL,
+		point REAL NULL,
+		timestamp INTEGER NULL,
+		fetched INTEGER NULL
+	);
+	CREATE INDEX IF NOT EXISTS ServerCache_server_uuid ON ServerCache(server_uuid);
+	`,
+	// 3: 服务器可被暂时停用
+	`
+	ALTER TABLE Server ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;
+	`,
+	// 4: 服务器发布其信任声明的地址
+	`
+	ALTER TABLE Server ADD COLUMN trust_url TEXT NULL;
+	`,
+	// 5: 表Instance, 支持在多个中心服务器上注册; 原有的注册信息作为实例default
+	`
+	CREATE TABLE IF NOT EXISTS Instance(
+		name TEXT NOT NULL UNIQUE,
+		server_address TEXT NOT NULL,
+		server_name TEXT NULL,
+		uuid TEXT NULL
+	);
+	INSERT INTO Instance (name, server_address, server_name, uuid)
+		SELECT 'default', server_address, server_name, uuid FROM Config WHERE server_address IS NOT NULL;
+	ALTER TABLE Server ADD COLUMN instance TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE Submission ADD COLUMN instance TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE Submission ADD COLUMN nonce TEXT NULL;
+	`,
+	// 6: 表Override, 本地的放行/强制封禁名单
+	`
+	CREATE TABLE IF NOT EXISTS Override(
+		player_uuid TEXT NOT NULL UNIQUE,
+		kind TEXT NOT NULL,
+		note TEXT NULL,
+		expires INTEGER NULL,
+		created INTEGER NOT NULL
+	);
+	`,
+	// 7: 表ReportRun与ReportSnapshot, 保存每次update生成的报告
+	`
+	CREATE TABLE IF NOT EXISTS ReportRun(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		threshold REAL NULL
+	);
+	CREATE TABLE IF NOT EXISTS ReportSnapshot(
+		run_id INTEGER NOT NULL,
+		player_uuid TEXT NOT NULL,
+		point REAL NOT NULL,
+		banned INTEGER NOT NULL,
+		UNIQUE(run_id, player_uuid)
+	);
+	`,
+	// 8: 表Notifier, 通知目标
+	`
+	CREATE TABLE IF NOT EXISTS Notifier(
+		name TEXT NOT NULL UNIQUE,
+		kind TEXT NOT NULL,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		template TEXT NULL
+	);
+	`,
+	// 9: 表Submission记录签名时间, 签名后的原始内容和操作者
+	`
+	ALTER TABLE Submission ADD COLUMN timestamp INTEGER NULL;
+	ALTER TABLE Submission ADD COLUMN message TEXT NULL;
+	ALTER TABLE Submission ADD COLUMN operator TEXT NULL;
+	`,
+	// 10: 表Submission的索引, 用于按条件查询
+	`
+	CREATE INDEX IF NOT EXISTS SubmissionPlayer ON Submission(player_uuid);
+	CREATE INDEX IF NOT EXISTS SubmissionTimestamp ON Submission(timestamp);
+	CREATE INDEX IF NOT EXISTS SubmissionPoint ON Submission(point);
+	`,
+	// 11: 表ServerCache按玩家查询的索引
+	`
+	CREATE INDEX IF NOT EXISTS ServerCache_player_uuid ON ServerCache(player_uuid);
+	`,
+	// 12: 表Submission记录被替代的提交, 表RevokedSubmission保存已撤回的提交
+	`
+	ALTER TABLE Submission ADD COLUMN supersedes TEXT NULL;
+	CREATE TABLE IF NOT EXISTS RevokedSubmission(
+		uuid TEXT NOT NULL,
+		nonce TEXT NULL,
+		instance TEXT NULL,
+		player_uuid TEXT NULL,
+		comment TEXT NULL,
+		point REAL NULL,
+		timestamp INTEGER NULL,
+		message TEXT NULL,
+		operator TEXT NULL,
+		supersedes TEXT NULL,
+		revoked INTEGER NOT NULL,
+		reason TEXT NULL,
+		superseded_by TEXT NULL
+	);
+	`,
+	// 13: 表AuditLog, 记录本地操作的审计日志, 只允许追加
+	`
+	CREATE TABLE IF NOT EXISTS AuditLog(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		operator TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT NOT NULL DEFAULT '',
+		detail TEXT NULL
+	);
+	CREATE INDEX IF NOT EXISTS AuditLogTime ON AuditLog(time);
+	CREATE TRIGGER IF NOT EXISTS AuditLogNoUpdate BEFORE UPDATE ON AuditLog
+	BEGIN
+		SELECT RAISE(ABORT, 'AuditLog is append-only');
+	END;
+	CREATE TRIGGER IF NOT EXISTS AuditLogNoDelete BEFORE DELETE ON AuditLog
+	BEGIN
+		SELECT RAISE(ABORT, 'AuditLog is append-only');
+	END;
+	`,
+	// 14: 表ReportRun增加inputs, 记录生成报告所用的提交, 服务器和参数
+	`
+	ALTER TABLE ReportRun ADD COLUMN inputs TEXT NULL;
+	`,
+	// 15: 表ServerFetch, 记录各服务器最近一次成功获取的时间, 获取到0条数据时也会记录
+	`
+	CREATE TABLE IF NOT EXISTS ServerFetch(
+		server_uuid TEXT NOT NULL UNIQUE,
+		fetched INTEGER NOT NULL
+	);
+	INSERT OR IGNORE INTO ServerFetch (server_uuid, fetched) SELECT server_uuid, MAX(fetched) FROM ServerCache GROUP BY server_uuid;
+	`,
+	// 16: 未指定阈值的报告不再将所有玩家记为被封禁
+	`
+	UPDATE ReportSnapshot SET banned = 0 WHERE run_id IN (SELECT id FROM ReportRun WHERE threshold IS NULL);
+	`,
+}
+
+// migrateDB 将数据库结构升级到最新版本
+func migrateDB() error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return errors.New(T("无法读取数据库版本: ") + err.Error())
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(migrations[version])
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf(T("执行第%d项变更失败: %s"), version+1, err)
+		}
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 //InitializeDB 创建默认数据库
@@ -69,14 +339,14 @@ func InitializeDB() {
 	// 创建数据库文件
 	db, err := sql.Open("sqlite3", SqlPath+"?charset=utf&mode=memory&cache=shared")
 	if err != nil {
-		log.Fatalf("打开数据库错误: %s", err)
+		logger.Fatal("打开数据库错误", F("error", err))
 	}
 	defer db.Close()
 
 	// 连接数据库文件
 	err = db.Ping()
 	if err != nil {
-		log.Fatalf("连接数据库错误: %s", err)
+		logger.Fatal("连接数据库错误", F("error", err))
 	}
 
 	// 创建各表
@@ -126,158 +396,728 @@ func InitializeDB() {
 	// 读取私钥
 	privkey, err := os.ReadFile("rsa-priv.pem")
 	if err != nil {
-		log.Fatalf("获取私钥错误: %s", err)
+		logger.Fatal("获取私钥错误", F("error", err))
 	}
 	// 读取公钥
 	pubkey, err := os.ReadFile("rsa-pub.pem")
 	if err != nil {
-		log.Fatalf("获取公钥错误: %s", err)
+		logger.Fatal("获取公钥错误", F("error", err))
 	}
 	// 存储
 	_, err = db.Exec("INSERT INTO Config (private_key, public_key) values(?,?)", privkey, pubkey)
 	if err != nil {
-		log.Fatalf("数据库错误: %s", err)
+		logger.Fatal("数据库错误", F("error", err))
 	}
 
 }
 
-// registerServer 存储注册服务器时返回的uuid和服务器名称
-func registerServer(server_name string, uuid string, server_address string) error {
-	_, err := db.Exec("UPDATE Config SET server_name = ?, uuid = ?, server_address = ?", server_name, uuid, server_address)
+// registerServer 存储注册服务器时返回的uuid和服务器名称, 同名的实例会被覆盖
+func registerServer(instance, server_name, uuid, server_address string) error {
+	_, err := db.Exec(`INSERT INTO Instance (name, server_address, server_name, uuid) values(?,?,?,?)
+		ON CONFLICT(name) DO UPDATE SET server_address = excluded.server_address, server_name = excluded.server_name, uuid = excluded.uuid`,
+		instance, server_address, server_name, uuid)
 	if err != nil {
-		return errors.New("本地数据库错误: " + err.Error())
+		return errors.New(T("本地数据库错误: ") + err.Error())
 	}
 	return nil
 }
 
+// instanceList 读取所有已注册的中心服务器
+func instanceList() ([]Instance, error) {
+	rows, err := db.Query("SELECT name, server_address, IFNULL(server_name, ''), IFNULL(uuid, '') FROM Instance ORDER BY name")
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	var list []Instance
+	for rows.Next() {
+		var data Instance
+		err := rows.Scan(&data.name, &data.server_address, &data.server_name, &data.uuid)
+		if err != nil {
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// getInstance 读取指定的中心服务器, 未注册时返回错误
+func getInstance(name string) (Instance, error) {
+	var data Instance
+	err := db.QueryRow("SELECT name, server_address, IFNULL(server_name, ''), IFNULL(uuid, '') FROM Instance WHERE name = ?", name).Scan(&data.name, &data.server_address, &data.server_name, &data.uuid)
+	if err == sql.ErrNoRows {
+		return data, fmt.Errorf(T("尚未在中心服务器 %s 上注册, 请先执行 register"), name)
+	}
+	if err != nil {
+		return data, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return data, nil
+}
+
+// submissionInstance 读取本地提交记录所属的中心服务器
+func submissionInstance(uuid string) (string, error) {
+	var instance string
+	err := db.QueryRow("SELECT instance FROM Submission WHERE uuid = ?", uuid).Scan(&instance)
+	if err != nil {
+		return "", err
+	}
+	return instance, nil
+}
+
 // newSubmission 向数据库中存入提交记录
-func newSubmission(uuid, player_uuid, comment string, point float64) error {
-	_, err := db.Exec("INSERT INTO Submission (uuid, player_uuid, comment, point) values(?,?,?,?)", uuid, player_uuid, comment, point)
+func newSubmission(data SubList) error {
+	return insertSubmission(db, data)
+}
+
+// execer sql.DB 与 sql.Tx 共有的方法
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertSubmission 在数据库或事务中存入提交记录
+func insertSubmission(e execer, data SubList) error {
+	var supersedes interface{}
+	if data.supersedes != "" {
+		supersedes = data.supersedes
+	}
+	_, err := e.Exec("INSERT INTO Submission (uuid, nonce, instance, player_uuid, comment, point, timestamp, message, operator, supersedes) values(?,?,?,?,?,?,?,?,?,?)",
+		data.uuid, data.nonce, data.instance, data.player_uuid, data.comment, data.point, data.timestamp, data.message, data.operator, supersedes)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// deleteSubmission 删除数据库中指定的提交记录, 并将其保存到表RevokedSubmission中
+func deleteSubmission(uuid, reason string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer tx.Rollback()
+	err = archiveSubmission(tx, uuid, reason, "")
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// replaceSubmission 在同一事务中撤回旧的提交并存入替代它的新提交
+func replaceSubmission(old, reason string, data SubList) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer tx.Rollback()
+	err = archiveSubmission(tx, old, reason, data.uuid)
+	if err != nil {
+		return err
+	}
+	data.supersedes = old
+	err = insertSubmission(tx, data)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// archiveSubmission 将提交移到表RevokedSubmission中, supersededBy 为替代它的提交, 可为空
+func archiveSubmission(tx *sql.Tx, uuid, reason, supersededBy string) error {
+	var by interface{}
+	if supersededBy != "" {
+		by = supersededBy
+	}
+	_, err := tx.Exec(`INSERT INTO RevokedSubmission (uuid, nonce, instance, player_uuid, comment, point, timestamp, message, operator, supersedes, revoked, reason, superseded_by)
+		SELECT uuid, nonce, instance, player_uuid, comment, point, timestamp, message, operator, supersedes, ?, ?, ? FROM Submission WHERE uuid = ?`,
+		time.Now().Unix(), reason, by, uuid)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	_, err = tx.Exec("DELETE FROM Submission WHERE uuid = ?", uuid)
 	if err != nil {
-		return errors.New("本地数据库错误: " + err.Error())
+		return errors.New(T("本地数据库错误: ") + err.Error())
 	}
 	return nil
 }
 
-// deleteSubmission 删除数据库中指定的提交记录
-func deleteSubmission(uuid string) error {
-	_, err := db.Exec("DELETE FROM Submission WHERE uuid = ?", uuid)
+// updateRestoredSubmission 将重新发布的提交的uuid和签名内容写入原提交的记录
+func updateRestoredSubmission(old string, data SubList) error {
+	_, err := db.Exec("UPDATE Submission SET uuid = ?, nonce = ?, timestamp = ?, message = ? WHERE uuid = ?", data.uuid, data.nonce, data.timestamp, data.message, old)
 	if err != nil {
-		return errors.New("本地数据库错误: " + err.Error())
+		return errors.New(T("本地数据库错误: ") + err.Error())
 	}
 	return nil
 }
 
-// serverList 吐出数据库Server表中的部分内容
-func serverList(c chan ServerList) {
-	rows, err := db.Query("SELECT * FROM Server")
+// serverList 读取数据库Server表中的所有服务器
+func serverList() ([]ServerList, error) {
+	rows, err := db.Query("SELECT server_name, uuid, public_key, level, disabled, IFNULL(trust_url, ''), instance FROM Server")
 	if err != nil {
-		close(c)
-		log.Panicf("本地数据库错误: %s\n", err)
-		return
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
 	}
 	defer rows.Close()
 
+	var list []ServerList
 	for rows.Next() {
 		var data ServerList
-		err := rows.Scan(&data.name, &data.uuid, &data.pubkey, &data.level)
+		err := rows.Scan(&data.name, &data.uuid, &data.pubkey, &data.level, &data.disabled, &data.trust_url, &data.instance)
 		if err != nil {
-			close(c)
-			log.Panicf("本地数据库错误: %s\n", err)
-			return
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
 		}
-		c <- data
+		data.weight = float64(data.level)
+		data.depth = 1
+		list = append(list, data)
 	}
-	close(c)
-	return
+	return list, rows.Err()
 }
 
-// subList 吐出数据库Submission表中的所有内容
-func subList(c chan SubList) {
-	rows, err := db.Query("SELECT * FROM Submission")
+// subList 读取数据库Submission表中的所有内容
+func subList() ([]SubList, error) {
+	return querySubmissions(SubmissionFilter{})
+}
+
+// querySubmissions 按条件查询本地提交
+func querySubmissions(filter SubmissionFilter) ([]SubList, error) {
+	where, args := filter.where()
+	orderBy, err := filter.orderBy()
 	if err != nil {
-		close(c)
-		log.Panicf("本地数据库错误: %s\n", err)
-		return
+		return nil, err
+	}
+	rows, err := db.Query("SELECT uuid, player_uuid, comment, point, instance, IFNULL(nonce, uuid), IFNULL(timestamp, 0), IFNULL(message, ''), IFNULL(operator, ''), IFNULL(supersedes, '') FROM Submission"+where+orderBy, args...)
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
 	}
 	defer rows.Close()
 
+	var list []SubList
 	for rows.Next() {
 		var data SubList
-		err := rows.Scan(&data.uuid, &data.player_uuid, &data.comment, &data.point)
+		err := rows.Scan(&data.uuid, &data.player_uuid, &data.comment, &data.point, &data.instance, &data.nonce, &data.timestamp, &data.message, &data.operator, &data.supersedes)
 		if err != nil {
-			close(c)
-			log.Panicf("本地数据库错误: %s\n", err)
-			return
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
 		}
 		data.level = 5
-		c <- data
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// countSubmissions 按条件统计本地提交的数量
+func countSubmissions(filter SubmissionFilter) (int, error) {
+	where, args := filter.where()
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM Submission"+where, args...).Scan(&count)
+	if err != nil {
+		return 0, errors.New(T("本地数据库错误: ") + err.Error())
 	}
-	close(c)
-	return
+	return count, nil
 }
 
 // insertServer 插入新的服务器信息
-func insertServer(uuid, name, pubkey_path string, level int) error {
-	// 读取本地公钥
-	pubkey, err := os.ReadFile(pubkey_path)
+func insertServer(uuid, name, pubkey string, level int, instance string) error {
+	// 服务器的uuid在本地唯一, 同一服务器不能在多个中心服务器下被信任
+	var existing string
+	err := db.QueryRow("SELECT instance FROM Server WHERE uuid = ?", uuid).Scan(&existing)
+	if err == nil {
+		return fmt.Errorf(T("服务器 %s 已在中心服务器 %s 下被信任"), uuid, existing)
+	}
+	if err != sql.ErrNoRows {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	_, err = db.Exec("INSERT INTO Server (server_name, uuid, public_key, level, instance) values(?,?,?,?,?)", name, uuid, pubkey, level, instance)
 	if err != nil {
-		return errors.New("读取指定公钥错误: " + err.Error())
+		return errors.New(T("本地数据库错误: ") + err.Error())
 	}
+	return nil
+}
 
-	_, err = db.Exec("INSERT INTO Server (server_name, uuid, public_key, level) values(?,?,?,?)", name, uuid, string(pubkey), level)
+// updateServer 修改指定服务器的一列, 服务器不存在时返回错误
+func updateServer(uuid, column string, value interface{}) error {
+	res, err := db.Exec("UPDATE Server SET "+column+" = ? WHERE uuid = ?", value, uuid)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
-		return errors.New("本地数据库错误: " + err.Error())
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	if n == 0 {
+		return errors.New(T("未找到服务器: ") + uuid)
 	}
 	return nil
 }
 
-// addReputation 插入玩家的声望数据
-func addReputation(data SubList) {
-	// 若表中存在该uuid, 则将将传入的数据与原先的数据相加; 否则插入新行
-	rows := db.QueryRow("SELECT player_uuid FROM Reputation WHERE player_uuid GLOB '?'", data.player_uuid)
-	if rows.Scan().Error() == "" {
-		_, err := db.Exec("UPDATE Reputation SET point = point + ?", (data.point * (float64(data.level) / 5)))
+// removeServer 删除指定的服务器, purge为真时一并删除其缓存和被拒绝的提交
+func removeServer(uuid string, purge bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM Server WHERE uuid = ?", uuid)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	if n == 0 {
+		return errors.New(T("未找到服务器: ") + uuid)
+	}
+	if purge {
+		for _, table := range []string{"ServerCache", "ServerFetch", "Rejection"} {
+			_, err = tx.Exec("DELETE FROM "+table+" WHERE server_uuid = ?", uuid)
+			if err != nil {
+				return errors.New(T("本地数据库错误: ") + err.Error())
+			}
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// insertRejection 记录一条被拒绝的远程提交, 同一提交只保留最近一次的记录
+func insertRejection(e execer, data Rejection) error {
+	_, err := e.Exec("INSERT OR REPLACE INTO Rejection (server_uuid, uuid, reason, content, time) values(?,?,?,?,?)", data.server_uuid, data.uuid, data.reason, data.content, data.time)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// rejectionList 读取被拒绝的远程提交, server不为空时只读取该服务器的记录
+func rejectionList(server string) ([]Rejection, error) {
+	rows, err := db.Query(`SELECT Rejection.server_uuid, IFNULL(Server.server_name, ''), Rejection.uuid, Rejection.reason, Rejection.content, Rejection.time
+		FROM Rejection LEFT JOIN Server ON Server.uuid = Rejection.server_uuid
+		WHERE ? = '' OR Rejection.server_uuid = ?
+		ORDER BY Rejection.time`, server, server)
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	var list []Rejection
+	for rows.Next() {
+		var data Rejection
+		err := rows.Scan(&data.server_uuid, &data.server_name, &data.uuid, &data.reason, &data.content, &data.time)
+		if err != nil {
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// cacheServerData 用新获取的数据替换指定服务器的缓存, 应在事务中调用
+func cacheServerData(e execer, server_uuid string, list []SubList, fetched int64) error {
+	_, err := e.Exec("DELETE FROM ServerCache WHERE server_uuid = ?", server_uuid)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	for _, data := range list {
+		_, err = e.Exec("INSERT INTO ServerCache (server_uuid, uuid, player_uuid, comment, point, timestamp, fetched) values(?,?,?,?,?,?,?)", server_uuid, data.uuid, data.player_uuid, data.comment, data.point, data.timestamp, fetched)
+		if err != nil {
+			return errors.New(T("本地数据库错误: ") + err.Error())
+		}
+	}
+	_, err = e.Exec("INSERT INTO ServerFetch (server_uuid, fetched) values(?,?) ON CONFLICT(server_uuid) DO UPDATE SET fetched = excluded.fetched", server_uuid, fetched)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// cachedServerData 读取指定服务器的缓存数据及其获取时间, 从未成功获取过时fetched为0
+func cachedServerData(server_uuid string) (list []SubList, fetched int64, err error) {
+	err = db.QueryRow("SELECT fetched FROM ServerFetch WHERE server_uuid = ?", server_uuid).Scan(&fetched)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	rows, err := db.Query("SELECT uuid, player_uuid, comment, point, timestamp FROM ServerCache WHERE server_uuid = ?", server_uuid)
+	if err != nil {
+		return nil, 0, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data SubList
+		err := rows.Scan(&data.uuid, &data.player_uuid, &data.comment, &data.point, &data.timestamp)
 		if err != nil {
-			log.Panicf("本地数据库错误: %s\n", err)
-			return
+			return nil, 0, errors.New(T("本地数据库错误: ") + err.Error())
 		}
-	} else {
-		_, err := db.Exec("INSERT INTO Reputation (player_uuid, point) values(?,?)", data.player_uuid, (data.point * (float64(data.level) / 5)))
+		list = append(list, data)
+	}
+	return list, fetched, rows.Err()
+}
+
+// cachedPlayerSubmissions 读取各服务器缓存的关于某个玩家的提交
+func cachedPlayerSubmissions(player_uuid string) ([]PlayerSubmission, error) {
+	rows, err := db.Query(`SELECT c.server_uuid, IFNULL(s.server_name, ''), c.uuid, c.comment, c.point, IFNULL(c.timestamp, 0), c.fetched
+		FROM ServerCache c LEFT JOIN Server s ON s.uuid = c.server_uuid
+		WHERE c.player_uuid = ? ORDER BY c.timestamp`, player_uuid)
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	list := []PlayerSubmission{}
+	for rows.Next() {
+		var data PlayerSubmission
+		err := rows.Scan(&data.Server, &data.ServerName, &data.UUID, &data.Comment, &data.Point, &data.Timestamp, &data.Fetched)
 		if err != nil {
-			log.Panicf("本地数据库错误: %s\n", err)
-			return
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
 		}
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// playerReputation 读取玩家在表Reputation中的评分, 不存在时返回nil
+func playerReputation(player_uuid string) (*float64, error) {
+	var point float64
+	err := db.QueryRow("SELECT point FROM Reputation WHERE player_uuid = ?", player_uuid).Scan(&point)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
 	}
+	return &point, nil
+}
 
-	return
+// addReputation 插入玩家的声望数据
+func addReputation(tx *sql.Tx, data SubList) error {
+	// 若表中存在该uuid, 则将将传入的数据与原先的数据相加; 否则插入新行
+	_, err := tx.Exec("INSERT INTO Reputation (player_uuid, point) values(?,?) ON CONFLICT(player_uuid) DO UPDATE SET point = point + excluded.point", data.player_uuid, (data.point * (data.level / 5)))
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
 }
 
 // resetReputation 重置表Reputation
-func resetReputation() {
-	_, err := db.Exec("delete from Reputation")
+func resetReputation(tx *sql.Tx) error {
+	_, err := tx.Exec("delete from Reputation")
 	if err != nil {
-		log.Panicf("本地数据库错误: %s\n", err)
-		return
+		return errors.New(T("本地数据库错误: ") + err.Error())
 	}
+	return nil
 }
 
-// serverList 吐出数据库Server表中的部分内容
-func reportList(c chan ReportList) error {
-	rows, err := db.Query("SELECT * FROM Reputation")
+// reportList 读取数据库Reputation表中的所有内容
+func reportList() ([]ReportList, error) {
+	rows, err := db.Query("SELECT player_uuid, point FROM Reputation")
 	if err != nil {
-		return errors.New("本地数据库错误: " + err.Error())
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
 	}
 	defer rows.Close()
 
+	var list []ReportList
 	for rows.Next() {
 		var data ReportList
 		err := rows.Scan(&data.player_uuid, &data.point)
 		if err != nil {
-			return errors.New("本地数据库错误: " + err.Error())
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// setOverride 将玩家加入本地名单, 已在名单中时覆盖原有的记录
+func setOverride(data Override) error {
+	var expires interface{}
+	if data.expires != 0 {
+		expires = data.expires
+	}
+	_, err := db.Exec(`INSERT INTO Override (player_uuid, kind, note, expires, created) values(?,?,?,?,?)
+		ON CONFLICT(player_uuid) DO UPDATE SET kind = excluded.kind, note = excluded.note, expires = excluded.expires, created = excluded.created`,
+		data.player_uuid, data.kind, data.note, expires, data.created)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// removeOverride 将玩家移出指定的本地名单
+func removeOverride(player_uuid, kind string) error {
+	res, err := db.Exec("DELETE FROM Override WHERE player_uuid = ? AND kind = ?", player_uuid, kind)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	if n == 0 {
+		return errors.New(T("玩家不在名单中: ") + player_uuid)
+	}
+	return nil
+}
+
+// overrideList 读取本地名单, kind为空时读取所有名单
+func overrideList(kind string) ([]Override, error) {
+	rows, err := db.Query("SELECT player_uuid, kind, IFNULL(note, ''), IFNULL(expires, 0), created FROM Override WHERE ? = '' OR kind = ? ORDER BY created", kind, kind)
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	var list []Override
+	for rows.Next() {
+		var data Override
+		err := rows.Scan(&data.player_uuid, &data.kind, &data.note, &data.expires, &data.created)
+		if err != nil {
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// ReportRun 一次update生成的报告
+type ReportRun struct {
+	id   int64
+	time int64
+	// threshold 该次报告使用的阈值, 未指定阈值时为nil
+	threshold *float64
+	// inputs 生成报告所用的输入, 为JSON对象, 升级前的报告为空
+	inputs string
+}
+
+// insertReportRun 保存一次报告的快照和所用的输入, 返回其编号
+func insertReportRun(threshold *float64, list []ReportList, inputs string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO ReportRun (time, threshold, inputs) values(?,?,?)", time.Now().Unix(), threshold, inputs)
+	if err != nil {
+		return 0, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	for _, i := range list {
+		_, err = tx.Exec("INSERT INTO ReportSnapshot (run_id, player_uuid, point, banned) values(?,?,?,?)", id, i.player_uuid, i.point, i.enforced(threshold))
+		if err != nil {
+			return 0, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return id, nil
+}
+
+// reportRuns 读取最近的limit次报告, 按时间倒序排列
+func reportRuns(limit int) ([]ReportRun, error) {
+	rows, err := db.Query("SELECT id, time, threshold FROM ReportRun ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	var list []ReportRun
+	for rows.Next() {
+		var data ReportRun
+		var threshold sql.NullFloat64
+		err := rows.Scan(&data.id, &data.time, &threshold)
+		if err != nil {
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		if threshold.Valid {
+			data.threshold = &threshold.Float64
+		}
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// reportRun 读取一次报告及其输入, id为0时读取最近一次报告
+func reportRun(id int64) (ReportRun, error) {
+	var data ReportRun
+	var threshold sql.NullFloat64
+	var inputs sql.NullString
+	row := db.QueryRow("SELECT id, time, threshold, inputs FROM ReportRun WHERE id = ?", id)
+	if id == 0 {
+		row = db.QueryRow("SELECT id, time, threshold, inputs FROM ReportRun ORDER BY id DESC LIMIT 1")
+	}
+	err := row.Scan(&data.id, &data.time, &threshold, &inputs)
+	if err == sql.ErrNoRows {
+		if id == 0 {
+			return data, errors.New(T("还没有保存过报告, 请先执行 update"))
+		}
+		return data, fmt.Errorf(T("未找到报告 %d: %s"), id, err)
+	}
+	if err != nil {
+		return data, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	if threshold.Valid {
+		data.threshold = &threshold.Float64
+	}
+	data.inputs = inputs.String
+	return data, nil
+}
+
+// previousReportRun 读取在run之前最近一次使用相同阈值的报告, 没有时ok为false
+func previousReportRun(run ReportRun) (data ReportRun, ok bool, err error) {
+	var threshold sql.NullFloat64
+	err = db.QueryRow("SELECT id, time, threshold FROM ReportRun WHERE id < ? AND threshold IS ? ORDER BY id DESC LIMIT 1", run.id, run.threshold).Scan(&data.id, &data.time, &threshold)
+	if err == sql.ErrNoRows {
+		return data, false, nil
+	}
+	if err != nil {
+		return data, false, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	if threshold.Valid {
+		data.threshold = &threshold.Float64
+	}
+	return data, true, nil
+}
+
+// reportSnapshot 读取某次报告的快照, 以玩家uuid为键
+func reportSnapshot(run_id int64) (map[string]ReportEntry, error) {
+	rows, err := db.Query("SELECT player_uuid, point, banned FROM ReportSnapshot WHERE run_id = ?", run_id)
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	snapshot := make(map[string]ReportEntry)
+	for rows.Next() {
+		var data ReportEntry
+		err := rows.Scan(&data.player_uuid, &data.point, &data.banned)
+		if err != nil {
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		snapshot[data.player_uuid] = data
+	}
+	return snapshot, rows.Err()
+}
+
+// insertNotifier 添加一个通知目标
+func insertNotifier(n Notifier) error {
+	_, err := db.Exec("INSERT INTO Notifier (name, kind, url, events, template) values(?,?,?,?,?)", n.name, n.kind, n.url, strings.Join(n.events, ","), n.template)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return nil
+}
+
+// removeNotifier 删除一个通知目标
+func removeNotifier(name string) error {
+	res, err := db.Exec("DELETE FROM Notifier WHERE name = ?", name)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	if n == 0 {
+		return errors.New(T("未找到通知目标: ") + name)
+	}
+	return nil
+}
+
+// notifierList 读取所有通知目标
+func notifierList() ([]Notifier, error) {
+	rows, err := db.Query("SELECT name, kind, url, events, IFNULL(template, '') FROM Notifier ORDER BY name")
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	var list []Notifier
+	for rows.Next() {
+		var data Notifier
+		var events string
+		err := rows.Scan(&data.name, &data.kind, &data.url, &events, &data.template)
+		if err != nil {
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
 		}
-		c <- data
+		if events != "" {
+			data.events = strings.Split(events, ",")
+		}
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// insertAudit 追加一条审计日志
+func insertAudit(data AuditEntry) error {
+	var detail interface{}
+	if data.Detail != nil {
+		detail = string(data.Detail)
+	}
+	_, err := db.Exec("INSERT INTO AuditLog (time, operator, action, target, detail) values(?,?,?,?,?)", data.Time, data.Operator, data.Action, data.Target, detail)
+	if err != nil {
+		return errors.New(T("本地数据库错误: ") + err.Error())
 	}
-	close(c)
 	return nil
 }
+
+// auditList 读取符合条件的审计日志, 按时间顺序排列; 指定limit时读取最新的limit条
+func auditList(filter AuditFilter) ([]AuditEntry, error) {
+	where, args := filter.where()
+	query := "SELECT id, time, operator, action, target, IFNULL(detail, '') FROM AuditLog" + where + " ORDER BY id DESC"
+	if filter.limit < 0 {
+		return nil, errors.New(T("limit 和 offset 不能为负数"))
+	}
+	if filter.limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.limit)
+	}
+	rows, err := db.Query("SELECT * FROM ("+query+") ORDER BY id", args...)
+	if err != nil {
+		return nil, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	defer rows.Close()
+
+	var list []AuditEntry
+	for rows.Next() {
+		var data AuditEntry
+		var detail string
+		err := rows.Scan(&data.ID, &data.Time, &data.Operator, &data.Action, &data.Target, &detail)
+		if err != nil {
+			return nil, errors.New(T("本地数据库错误: ") + err.Error())
+		}
+		if detail != "" {
+			data.Detail = json.RawMessage(detail)
+		}
+		list = append(list, data)
+	}
+	return list, rows.Err()
+}
+
+// hasLocalData 判断本地数据库中是否已有注册信息, 提交, 信任的服务器, 本地名单或审计日志
+func hasLocalData() (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM Instance) OR EXISTS(SELECT 1 FROM Submission) OR EXISTS(SELECT 1 FROM Server)
+		OR EXISTS(SELECT 1 FROM Override) OR EXISTS(SELECT 1 FROM AuditLog)`).Scan(&exists)
+	if err != nil {
+		return false, errors.New(T("本地数据库错误: ") + err.Error())
+	}
+	return exists, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/schollz/progressbar/v3"
+)
+
+// testLocalKey 测试共用的本地密钥, 只生成一次
+var testLocalKey struct {
+	once    sync.Once
+	private string
+	public  string
+	err     error
+}
+
+// newTestKey 生成一个测试用的密钥, 返回私钥和公钥
+func newTestKey(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := crypto.GenerateKey("OpenMPRDB-CLI test", "test@example.com", "x25519", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := key.Armor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := key.GetArmoredPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private, public
+}
+
+// newTestDB 在临时目录中初始化数据库和本地密钥, 并切换到该目录, 测试结束后恢复
+func newTestDB(t *testing.T) string {
+	t.Helper()
+	testLocalKey.once.Do(func() {
+		key, err := crypto.GenerateKey("OpenMPRDB-CLI test", "test@example.com", "x25519", 0)
+		if err == nil {
+			testLocalKey.private, err = key.Armor()
+		}
+		if err == nil {
+			testLocalKey.public, err = key.GetArmoredPublicKey()
+		}
+		testLocalKey.err = err
+	})
+	if testLocalKey.err != nil {
+		t.Fatal(testLocalKey.err)
+	}
+
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := SqlPath
+	SqlPath = filepath.Join(dir, "OpenMPRDB.db")
+	t.Cleanup(func() {
+		if db != nil {
+			db.Close()
+		}
+		SqlPath = path
+		os.Chdir(wd)
+	})
+
+	for name, content := range map[string]string{"rsa-priv.pem": testLocalKey.private, "rsa-pub.pem": testLocalKey.public} {
+		err = os.WriteFile(name, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	InitializeDB()
+	err = openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar = progressbar.DefaultSilent(0)
+	return dir
+}
+
+func TestUpdateServer(t *testing.T) {
+	newTestDB(t)
+	const uuid = "00000000-0000-4000-8000-000000000002"
+	err := insertServer(uuid, "Neko", "pubkey", 3, defaultInstance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for column, value := range map[string]interface{}{"level": 5, "server_name": "Nyan", "disabled": true} {
+		err = updateServer(uuid, column, value)
+		if err != nil {
+			t.Fatalf("updateServer(%s) error = %v", column, err)
+		}
+	}
+	list, err := serverList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].level != 5 || list[0].name != "Nyan" || !list[0].disabled {
+		t.Errorf("serverList() = %+v, want level 5, name Nyan and disabled", list)
+	}
+	err = updateServer("00000000-0000-4000-8000-000000000003", "level", 1)
+	if err == nil {
+		t.Error("updateServer() of an unknown server succeeded")
+	}
+}
+
+func TestRemoveServer(t *testing.T) {
+	for _, purge := range []bool{false, true} {
+		t.Run(fmt.Sprintf("purge=%v", purge), func(t *testing.T) {
+			newTestDB(t)
+			const uuid = "00000000-0000-4000-8000-000000000002"
+			err := insertServer(uuid, "Neko", "pubkey", 3, defaultInstance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = cacheServerData(tx, uuid, []SubList{{uuid: "6f1c9a0e-3b7d-4e2a-9c51-0d8e7f6a5b4c", player_uuid: "252af321-89aa-426c-a534-399f551810ae", point: -1}}, 1627776000)
+			if err == nil {
+				err = insertRejection(tx, Rejection{server_uuid: uuid, uuid: "7a2d0b1f-4c8e-4f3b-8d62-1e9f8a7b6c5d", reason: "bad", time: 1627776000})
+			}
+			if err == nil {
+				err = tx.Commit()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = removeServer(uuid, purge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list, err := serverList()
+			if err != nil || len(list) != 0 {
+				t.Errorf("serverList() = %+v, %v, want empty", list, err)
+			}
+			cached, fetched, err := cachedServerData(uuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rejections, err := rejectionList(uuid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := len(cached) == 1 && fetched != 0 && len(rejections) == 1
+			gone := len(cached) == 0 && fetched == 0 && len(rejections) == 0
+			if purge && !gone || !purge && !kept {
+				t.Errorf("after remove: %d cached at %d, %d rejections", len(cached), fetched, len(rejections))
+			}
+			if removeServer(uuid, purge) == nil {
+				t.Error("removing the server twice succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+	uuid "github.com/satori/go.uuid"
+)
+
+// TrustEntry 信任声明中的一项, 表示签发者信任某个服务器
+type TrustEntry struct {
+	uuid        string
+	level       int
+	fingerprint string
+	// trust_url 该服务器发布其信任声明的地址, 可为空
+	trust_url string
+}
+
+// TrustStatement 服务器发布的信任声明
+//
+// 明文格式如下, 每个被信任的服务器占一行trust字段:
+//
+//	type: trust
+//	server_uuid: <签发者uuid>
+//	timestamp: <unix时间戳>
+//	trust: <服务器uuid> <信任等级> <公钥指纹> [信任声明地址]
+type TrustStatement struct {
+	server_uuid string
+	timestamp   int64
+	entries     []TrustEntry
+}
+
+// parseTrustStatement 解析信任声明的明文内容, 未知字段会被忽略
+func parseTrustStatement(text string) (TrustStatement, error) {
+	var statement TrustStatement
+	var kind string
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		params := fieldRegexp.FindStringSubmatch(line)
+		if params == nil {
+			return statement, errors.New(T("无法识别的内容: ") + line)
+		}
+		switch params[1] {
+		case "type":
+			kind = params[2]
+		case "server_uuid":
+			id, err := uuid.FromString(params[2])
+			if err != nil {
+				return statement, errors.New(T("server_uuid格式错误: ") + err.Error())
+			}
+			statement.server_uuid = id.String()
+		case "timestamp":
+			timestamp, err := strconv.ParseInt(params[2], 10, 64)
+			if err != nil {
+				return statement, errors.New(T("timestamp格式错误: ") + err.Error())
+			}
+			statement.timestamp = timestamp
+		case "trust":
+			entry, err := parseTrustEntry(params[2])
+			if err != nil {
+				return statement, err
+			}
+			statement.entries = append(statement.entries, entry)
+		}
+	}
+
+	if kind != "trust" {
+		return statement, errors.New(T("不是信任声明: type: ") + kind)
+	}
+	if statement.server_uuid == "" {
+		return statement, errors.New(T("缺少字段: server_uuid"))
+	}
+	return statement, nil
+}
+
+// parseTrustEntry 解析信任声明中的一行trust字段
+func parseTrustEntry(value string) (TrustEntry, error) {
+	var entry TrustEntry
+	fields := strings.Fields(value)
+	if len(fields) < 3 || len(fields) > 4 {
+		return entry, errors.New(T("trust字段格式错误: ") + value)
+	}
+	id, err := uuid.FromString(fields[0])
+	if err != nil {
+		return entry, errors.New(T("trust字段uuid格式错误: ") + err.Error())
+	}
+	level, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return entry, errors.New(T("trust字段信任等级格式错误: ") + err.Error())
+	}
+	err = checkLevel(level)
+	if err != nil {
+		return entry, err
+	}
+	entry = TrustEntry{
+		uuid:        id.String(),
+		level:       level,
+		fingerprint: strings.ToLower(fields[2]),
+	}
+	if len(fields) == 4 {
+		entry.trust_url = fields[3]
+	}
+	return entry, nil
+}
+
+// publishTrustStatement 根据本地信任的服务器生成签名后的信任声明
+//
+// 声明以本服务器在指定中心服务器上的身份签发, 只包含位于该中心服务器上的服务器.
+func publishTrustStatement(instanceName string) (string, error) {
+	instance, err := getInstance(instanceName)
+	if err != nil {
+		return "", err
+	}
+
+	servers, err := serverList()
+	if err != nil {
+		return "", err
+	}
+
+	text := fmt.Sprintf("type: trust\r\nserver_uuid: %s\r\ntimestamp: %d", instance.uuid, time.Now().Unix())
+	for _, sl := range servers {
+		if sl.disabled || sl.instance != instance.name {
+			continue
+		}
+		fingerprint, err := keyFingerprint(sl.pubkey)
+		if err != nil {
+			return "", fmt.Errorf(T("服务器[%s]: %s"), sl.uuid, err)
+		}
+		text += fmt.Sprintf("\r\ntrust: %s %d %s", sl.uuid, sl.level, fingerprint)
+		if sl.trust_url != "" {
+			text += " " + sl.trust_url
+		}
+	}
+	return SignatureData(text)
+}
+
+// fetchTrustStatement 获取并验证某个服务器的信任声明
+func fetchTrustStatement(ctx context.Context, server ServerList) (TrustStatement, error) {
+	content, err := httpRequestContext(ctx, "GET", "text/plain", server.trust_url, "", nil)
+	if err != nil {
+		return TrustStatement{}, err
+	}
+	verifiedPlainText, err := helper.VerifyCleartextMessageArmored(server.pubkey, string(content), crypto.GetUnixTime())
+	if err != nil {
+		return TrustStatement{}, errors.New(T("信任声明验签失败: ") + err.Error())
+	}
+	statement, err := parseTrustStatement(verifiedPlainText)
+	if err != nil {
+		return TrustStatement{}, errors.New(T("信任声明解析失败: ") + err.Error())
+	}
+	if statement.server_uuid != server.uuid {
+		return TrustStatement{}, fmt.Errorf(T("信任声明的签发者不符: %s"), statement.server_uuid)
+	}
+	return statement, nil
+}
+
+// expandTrust 根据信任声明逐层扩展信任的服务器, 返回间接信任的服务器
+//
+// 间接信任的服务器的权重为 上一层的权重 * 声明中的等级 / 5 * attenuation,
+// 同一服务器经由多条路径到达时取最大的权重. 直接信任(包括已停用)的服务器和本服务器不会被重复加入.
+// 间接信任的服务器视为与声明者位于同一中心服务器, addresses 为各中心服务器的地址.
+// 无法获取或验证的信任声明和公钥会被跳过.
+func expandTrust(ctx context.Context, addresses map[string]string, direct []ServerList, depth int, attenuation float64) ([]ServerList, error) {
+	visited := make(map[string]bool)
+	instances, err := instanceList()
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range instances {
+		visited[instance.uuid] = true
+	}
+	all, err := serverList()
+	if err != nil {
+		return nil, err
+	}
+	for _, sl := range all {
+		visited[sl.uuid] = true
+	}
+
+	var result []ServerList
+	layer := direct
+	for d := 2; d <= depth && len(layer) > 0; d++ {
+		// 收集本层的候选服务器
+		candidates := make(map[string]ServerList)
+		var order []string
+		for _, issuer := range layer {
+			if issuer.trust_url == "" {
+				continue
+			}
+			statement, err := fetchTrustStatement(ctx, issuer)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				logger.Warn("已跳过服务器的信任声明", F("server_uuid", issuer.uuid), F("error", err))
+				continue
+			}
+			for _, entry := range statement.entries {
+				if visited[entry.uuid] {
+					continue
+				}
+				weight := issuer.weight * float64(entry.level) / 5 * attenuation
+				if c, ok := candidates[entry.uuid]; ok && c.weight >= weight {
+					continue
+				}
+				if _, ok := candidates[entry.uuid]; !ok {
+					order = append(order, entry.uuid)
+				}
+				candidates[entry.uuid] = ServerList{
+					uuid:        entry.uuid,
+					level:       entry.level,
+					weight:      weight,
+					via:         issuer.uuid,
+					depth:       d,
+					fingerprint: entry.fingerprint,
+					trust_url:   entry.trust_url,
+					instance:    issuer.instance,
+				}
+			}
+		}
+
+		// 获取候选服务器的公钥, 并与声明中的指纹比对
+		layer = nil
+		for _, id := range order {
+			sl := candidates[id]
+			visited[id] = true
+			var pubkey string
+			serverAddress, ok := addresses[sl.instance]
+			if ok {
+				pubkey, err = fetchServerKey(ctx, serverAddress, id)
+			} else {
+				err = fmt.Errorf(T("尚未在中心服务器 %s 上注册"), sl.instance)
+			}
+			if err == nil {
+				var fingerprint string
+				fingerprint, err = keyFingerprint(pubkey)
+				if err == nil && fingerprint != sl.fingerprint {
+					err = fmt.Errorf(T("公钥指纹不符: %s"), fingerprint)
+				}
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				logger.Warn("已跳过间接信任的服务器", F("server_uuid", id), F("error", err))
+				continue
+			}
+			sl.pubkey = pubkey
+			layer = append(layer, sl)
+		}
+		result = append(result, layer...)
+	}
+	return result, nil
+}
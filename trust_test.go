@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+)
+
+func TestParseTrustStatement(t *testing.T) {
+	const (
+		issuer = "00000000-0000-4000-8000-000000000002"
+		server = "00000000-0000-4000-8000-000000000003"
+	)
+	header := "type: trust\r\nserver_uuid: " + issuer + "\r\ntimestamp: 1627776000\r\n"
+	tests := []struct {
+		name    string
+		text    string
+		want    []TrustEntry
+		wantErr bool
+	}{
+		{name: "no entries", text: header},
+		{
+			name: "entries",
+			text: header + "trust: " + server + " 5 ABCDEF\r\ntrust: 00000000-0000-4000-8000-000000000004 1 0123 https://example.com/trust.txt",
+			want: []TrustEntry{
+				{uuid: server, level: 5, fingerprint: "abcdef"},
+				{uuid: "00000000-0000-4000-8000-000000000004", level: 1, fingerprint: "0123", trust_url: "https://example.com/trust.txt"},
+			},
+		},
+		{name: "unknown fields are ignored", text: header + "comment: hello\ntrust: " + server + " 3 ab", want: []TrustEntry{{uuid: server, level: 3, fingerprint: "ab"}}},
+		{name: "not a trust statement", text: strings.Replace(header, "type: trust", "type: submit", 1), wantErr: true},
+		{name: "missing type", text: strings.Replace(header, "type: trust\r\n", "", 1), wantErr: true},
+		{name: "missing issuer", text: "type: trust\r\ntimestamp: 1627776000", wantErr: true},
+		{name: "malformed issuer", text: strings.Replace(header, issuer, "neko", 1), wantErr: true},
+		{name: "malformed timestamp", text: strings.Replace(header, "1627776000", "now", 1), wantErr: true},
+		{name: "unrecognised line", text: header + "hello", wantErr: true},
+		{name: "too few fields", text: header + "trust: " + server + " 5", wantErr: true},
+		{name: "too many fields", text: header + "trust: " + server + " 5 ab https://example.com extra", wantErr: true},
+		{name: "malformed uuid", text: header + "trust: neko 5 ab", wantErr: true},
+		{name: "malformed level", text: header + "trust: " + server + " five ab", wantErr: true},
+		{name: "level out of range", text: header + "trust: " + server + " 6 ab", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTrustStatement(tt.text)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTrustStatement() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTrustStatement() error = %v", err)
+			}
+			if got.server_uuid != issuer || got.timestamp != 1627776000 || fmt.Sprint(got.entries) != fmt.Sprint(tt.want) {
+				t.Errorf("parseTrustStatement() = %+v, want entries %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// trustTestServer 信任扩展测试中的一个服务器
+type trustTestServer struct {
+	uuid        string
+	privkey     string
+	pubkey      string
+	fingerprint string
+}
+
+// newTrustTestServer 生成服务器的密钥, 并在中心服务器上登记
+func newTrustTestServer(t *testing.T, central *fakeCentral, n int) trustTestServer {
+	t.Helper()
+	s := trustTestServer{uuid: fmt.Sprintf("00000000-0000-4000-8000-%012d", n)}
+	s.privkey, s.pubkey = newTestKey(t)
+	fingerprint, err := keyFingerprint(s.pubkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.fingerprint = fingerprint
+	central.register(s.uuid, fmt.Sprintf("server-%d", n), s.pubkey)
+	return s
+}
+
+// publish 签名并发布服务器的信任声明, 每一行为 "uuid 等级 指纹 [地址]"
+func (s trustTestServer) publish(t *testing.T, central *fakeCentral, entries ...string) {
+	t.Helper()
+	text := fmt.Sprintf("type: trust\r\nserver_uuid: %s\r\ntimestamp: 1627776000", s.uuid)
+	for _, entry := range entries {
+		text += "\r\ntrust: " + entry
+	}
+	signed, err := helper.SignCleartextMessageArmored(s.privkey, nil, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	central.mu.Lock()
+	central.statements[s.uuid] = signed
+	central.mu.Unlock()
+}
+
+// url 服务器信任声明的地址
+func (s trustTestServer) url(central *fakeCentral) string {
+	return central.URL + "/trust/" + s.uuid
+}
+
+func TestExpandTrust(t *testing.T) {
+	newTestDB(t)
+	central := newTestCentral(t)
+	var servers []trustTestServer
+	for n := 2; n <= 9; n++ {
+		servers = append(servers, newTrustTestServer(t, central, n))
+	}
+	a, a2, b, c, d, e, x, disabled := servers[0], servers[1], servers[2], servers[3], servers[4], servers[5], servers[6], servers[7]
+	const self = "00000000-0000-4000-8000-000000000001"
+
+	// a 与 a2 为直接信任的服务器
+	for _, s := range []trustTestServer{a, a2} {
+		err := insertServer(s.uuid, s.uuid, s.pubkey, 5, defaultInstance)
+		if err == nil {
+			err = updateServer(s.uuid, "trust_url", s.url(central))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 停用的服务器不会被间接信任
+	err := insertServer(disabled.uuid, "disabled", disabled.pubkey, 1, defaultInstance)
+	if err == nil {
+		err = updateServer(disabled.uuid, "disabled", true)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.publish(t, central,
+		b.uuid+" 5 "+b.fingerprint+" "+b.url(central),
+		c.uuid+" 1 "+c.fingerprint,
+		// 指纹与中心服务器上的公钥不符
+		e.uuid+" 5 "+strings.Repeat("0", len(e.fingerprint)),
+		x.uuid+" 1 "+x.fingerprint,
+		self+" 5 "+a.fingerprint,
+		disabled.uuid+" 5 "+disabled.fingerprint,
+	)
+	// 同一服务器经由多条路径到达时取最大的权重
+	a2.publish(t, central, x.uuid+" 5 "+x.fingerprint)
+	// c 已在上一层加入, 不会被重复加入
+	b.publish(t, central, d.uuid+" 5 "+d.fingerprint, c.uuid+" 5 "+c.fingerprint)
+
+	direct, err := serverList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var enabled []ServerList
+	for _, sl := range direct {
+		if !sl.disabled {
+			enabled = append(enabled, sl)
+		}
+	}
+	addresses := map[string]string{defaultInstance: central.URL}
+
+	type want struct {
+		weight float64
+		via    string
+		depth  int
+	}
+	tests := []struct {
+		depth int
+		want  map[string]want
+	}{
+		{depth: 1, want: map[string]want{}},
+		{depth: 2, want: map[string]want{
+			b.uuid: {weight: 2.5, via: a.uuid, depth: 2},
+			c.uuid: {weight: 0.5, via: a.uuid, depth: 2},
+			x.uuid: {weight: 2.5, via: a2.uuid, depth: 2},
+		}},
+		{depth: 3, want: map[string]want{
+			b.uuid: {weight: 2.5, via: a.uuid, depth: 2},
+			c.uuid: {weight: 0.5, via: a.uuid, depth: 2},
+			x.uuid: {weight: 2.5, via: a2.uuid, depth: 2},
+			d.uuid: {weight: 1.25, via: b.uuid, depth: 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("depth=%d", tt.depth), func(t *testing.T) {
+			got, err := expandTrust(context.Background(), addresses, enabled, tt.depth, 0.5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("expandTrust() returned %d servers, want %d", len(got), len(tt.want))
+			}
+			for _, sl := range got {
+				w, ok := tt.want[sl.uuid]
+				if !ok {
+					t.Errorf("unexpected server %s via %s", sl.uuid, sl.via)
+					continue
+				}
+				if math.Abs(sl.weight-w.weight) > 1e-9 || sl.via != w.via || sl.depth != w.depth || sl.pubkey == "" || sl.instance != defaultInstance {
+					t.Errorf("server %s = weight %g via %s at depth %d, want %+v", sl.uuid, sl.weight, sl.via, sl.depth, w)
+				}
+			}
+		})
+	}
+}
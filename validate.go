@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxCommentLength 理由的最大长度(字符数)
+const maxCommentLength = 200
+
+// playerUUIDRegexp 匹配完整带连字符或完全不带连字符的玩家uuid, 只有部分连字符的写法不匹配
+var playerUUIDRegexp = regexp.MustCompile(`^(?i)(?:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}|[0-9a-f]{32})$`)
+
+// normalizePlayerUUID 检查玩家uuid, 并统一为小写带连字符的格式
+//
+// 只接受 252af321-89aa-426c-a534-399f551810ae 和 252af32189aa426ca534399f551810ae 两种写法.
+func normalizePlayerUUID(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !playerUUIDRegexp.MatchString(value) {
+		return "", errors.New(T("玩家uuid格式错误: ") + value)
+	}
+	hex := strings.ToLower(strings.ReplaceAll(value, "-", ""))
+	return fmt.Sprintf("%s-%s-%s-%s-%s", hex[0:8], hex[8:12], hex[12:16], hex[16:20], hex[20:32]), nil
+}
+
+// checkPoint 检查评分在 -1 ~ 1 之间, 且最多一位小数, 与签名内容中的 %.1f 一致
+func checkPoint(point float64) error {
+	if math.IsNaN(point) || math.IsInf(point, 0) || point < -1 || point > 1 {
+		return fmt.Errorf(T("评分必须在 -1 ~ 1 之间: %g"), point)
+	}
+	if math.Abs(point*10-math.Round(point*10)) > 1e-9 {
+		return fmt.Errorf(T("评分最多一位小数: %g"), point)
+	}
+	return nil
+}
+
+// checkComment 检查理由不为空, 长度不超过maxCommentLength, 且不含换行(包括 U+2028, U+2029)等控制字符
+//
+// 理由直接写在签名内容的 comment: 行中, 换行会破坏提交的格式.
+func checkComment(comment string) error {
+	if !utf8.ValidString(comment) {
+		return errors.New(T("理由不是有效的UTF-8文本"))
+	}
+	if strings.TrimSpace(comment) == "" {
+		return errors.New(T("理由不能为空"))
+	}
+	if n := utf8.RuneCountInString(comment); n > maxCommentLength {
+		return fmt.Errorf(T("理由过长: %d 个字符 (最多 %d 个)"), n, maxCommentLength)
+	}
+	for _, r := range comment {
+		if unicode.IsControl(r) || r == '\u2028' || r == '\u2029' {
+			return fmt.Errorf(T("理由中不能包含换行或控制字符: %q"), r)
+		}
+	}
+	return nil
+}
+
+// validateSubmission 在签名之前检查一条新提交, 返回统一格式后的玩家uuid
+//
+// 命令行, 批量导入等所有新建提交的途径都应先经过此检查.
+func validateSubmission(player string, point float64, comment string) (string, error) {
+	player, err := normalizePlayerUUID(player)
+	if err != nil {
+		return "", err
+	}
+	err = checkPoint(point)
+	if err != nil {
+		return "", err
+	}
+	err = checkComment(comment)
+	if err != nil {
+		return "", err
+	}
+	return player, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePlayerUUID(t *testing.T) {
+	const want = "252af321-89aa-426c-a534-399f551810ae"
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "hyphenated", value: want, want: want},
+		{name: "without hyphens", value: "252af32189aa426ca534399f551810ae", want: want},
+		{name: "upper case", value: "252AF321-89AA-426C-A534-399F551810AE", want: want},
+		{name: "surrounding spaces", value: "  252af32189aa426ca534399f551810ae\t", want: want},
+		{name: "empty", value: "", wantErr: true},
+		{name: "player name", value: "Steve", wantErr: true},
+		{name: "too short", value: "252af321-89aa-426c-a534-399f551810a", wantErr: true},
+		{name: "too long", value: "252af32189aa426ca534399f551810ae0", wantErr: true},
+		{name: "not hex", value: "252af321-89aa-426c-a534-399f551810ag", wantErr: true},
+		{name: "braces", value: "{252af321-89aa-426c-a534-399f551810ae}", wantErr: true},
+		{name: "partially dashed", value: "252af32189aa-426c-a534399f551810ae", wantErr: true},
+		{name: "single dash", value: "252af321-89aa426ca534399f551810ae", wantErr: true},
+		{name: "misplaced dashes", value: "252af3218-9aa-426c-a534-399f551810ae", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizePlayerUUID(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizePlayerUUID(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizePlayerUUID(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPoint(t *testing.T) {
+	tests := []struct {
+		point   float64
+		wantErr bool
+	}{
+		{point: -1},
+		{point: 1},
+		{point: 0},
+		{point: -0.5},
+		{point: 0.3},
+		{point: 1.1, wantErr: true},
+		{point: -1.5, wantErr: true},
+		{point: 0.25, wantErr: true},
+		{point: 0.01, wantErr: true},
+		{point: math.NaN(), wantErr: true},
+		{point: math.Inf(1), wantErr: true},
+		{point: math.Inf(-1), wantErr: true},
+	}
+	for _, tt := range tests {
+		err := checkPoint(tt.point)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkPoint(%g) error = %v, wantErr %v", tt.point, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		comment string
+		wantErr bool
+	}{
+		{name: "plain", comment: "griefing"},
+		{name: "non-ascii", comment: "恶意破坏"},
+		{name: "max length", comment: strings.Repeat("啊", maxCommentLength)},
+		{name: "too long", comment: strings.Repeat("a", maxCommentLength+1), wantErr: true},
+		{name: "empty", comment: "", wantErr: true},
+		{name: "only spaces", comment: "   ", wantErr: true},
+		{name: "newline", comment: "line one\nline two", wantErr: true},
+		{name: "carriage return", comment: "line one\rline two", wantErr: true},
+		{name: "tab", comment: "a\tb", wantErr: true},
+		{name: "line separator", comment: "line one\u2028line two", wantErr: true},
+		{name: "paragraph separator", comment: "line one\u2029line two", wantErr: true},
+		{name: "invalid utf-8", comment: "bad \xff byte", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkComment(tt.comment)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkComment(%q) error = %v, wantErr %v", tt.comment, err, tt.wantErr)
+			}
+		})
+	}
+}